@@ -15,6 +15,16 @@
 
 (def backend-address (str "http://"(env :backend-address)))
 
+(defn backend-headers
+  "Headers to authenticate with the backend, making the request on behalf of the session user.
+  Their GitHub token lets the backend resolve if they're an admin"
+  [{:keys [username token]}]
+  (merge {"Authorization" (str "Bearer "(env :backend-token))}
+         (when-not (empty? username)
+           {"X-Pair-Impersonate-User" username})
+         (when-not (empty? token)
+           {"X-Pair-GitHub-Token" token})))
+
 (s/fdef text->env
   :args (s/cat :text string?)
   :ret map?)
@@ -72,28 +82,28 @@
          (pluralize minutes "minute"))))
 
 (defn fetch-from-backend
-  [url]
-  (client/get url {:timeout 7000}
+  [user url]
+  (client/get url {:timeout 7000 :headers (backend-headers user)}
               (fn [{:keys [status headers body error]}] ;; asynchronous response handling
                 (if error
                   (do (println "Failed, exception is " error) nil)
                   (json/decode body true)))))
 
 (defn fetch-instance
-  "Fetch raw data for each of our main instance endpoints"
-  [instance-id]
+  "Fetch raw data for each of our main instance endpoints, on behalf of the session user"
+  [user instance-id]
   (let [endpoint (str backend-address "/api/instance/kubernetes/"instance-id)
         urls [[:instance endpoint]
               [:kubeconfig (str endpoint "/kubeconfig")]
               [:tmate-ssh (str endpoint "/tmate/ssh")]
               [:tmate-web (str endpoint "/tmate/web")]
               [:ingresses (str endpoint "/ingresses")]]
-        futures (doall (map (fn [[name url]] [name (fetch-from-backend url)]) urls))
+        futures (doall (map (fn [[name url]] [name (fetch-from-backend user url)]) urls))
         results (doall (map (fn [[name future]] [name (deref future)]) futures))]
     (into {} results)))
 
 (defn launch
-  [{:keys [username token emails]} {:keys [name project timezone envvars facility type guests fullname email repos kubernetesNodeCount noGitHubToken] :as params}]
+  [{:keys [username token emails] :as user} {:keys [name project timezone envvars facility type guests fullname email repos kubernetesNodeCount noGitHubToken] :as params}]
   (let [backend (str "http://"(env :backend-address)"/api/instance")
         instance-spec {:type type
                        :facility facility
@@ -112,7 +122,7 @@
                                :fullname fullname
                                :email email
                                :extraEmails emails}}
-        response (-> (http/post backend {:form-params instance-spec :content-type :json})
+        response (-> (http/post backend {:form-params instance-spec :content-type :json :headers (backend-headers user)})
                      (:body)
                      (json/decode true))
         {{api-response :response} :metadata
@@ -132,8 +142,8 @@
      :status (str api-response": "phase)}))
 
 (defn get-instance
-  [instance-id]
-  (let [{:keys [instance kubeconfig tmate-ssh tmate-web ingresses dns cert]} (fetch-instance instance-id)
+  [user instance-id]
+  (let [{:keys [instance kubeconfig tmate-ssh tmate-web ingresses dns cert]} (fetch-instance user instance-id)
         created-at (status->created-at (:status instance))]
     {:instance-id (or (-> instance :spec :name) instance-id)
      :owner (-> instance :spec :setup :user)
@@ -158,8 +168,8 @@
      :age (if (nil? created-at) nil (relative-age created-at))}))
 
 (defn get-all-instances
-  [{:keys [username admin-member]}]
-  (let [raw-instances (try+ (-> (http/get (str backend-address"/api/instance/kubernetes"))
+  [{:keys [username admin-member] :as user}]
+  (let [raw-instances (try+ (-> (http/get (str backend-address"/api/instance/kubernetes") {:headers (backend-headers user)})
                                 :body (json/decode true) :list)
                             (catch Object _
                               (log/warn "Couldn't get instances")
@@ -179,5 +189,7 @@
                  (= (:owner %) username)) instances))))
 
 (defn delete-instance
-  [instance-id]
-  (http/delete (str backend-address"/api/instance/kubernetes/"instance-id)))
+  "Delete an instance on behalf of a user"
+  [user instance-id]
+  (http/delete (str backend-address"/api/instance/kubernetes/"instance-id)
+               {:headers (backend-headers user)}))
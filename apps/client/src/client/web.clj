@@ -64,17 +64,19 @@
 
   (POST "/instances/id/:id/delete" {{:keys [user instance]} :session
                                     {:keys [instance-id]} :params}
-        (packet/delete-instance instance-id)
+        (packet/delete-instance user instance-id)
         (res/redirect "/instances"))
 
-  (GET "/public-instances/:uid/:instance-id" {{:keys [uid instance-id]} :params}
-       (let [instance (packet/get-instance instance-id)]
+  (GET "/public-instances/:uid/:instance-id" {{:keys [uid instance-id]} :params
+                                              {:keys [user]} :session}
+       (let [instance (packet/get-instance user instance-id)]
          (if (and (:uid instance)(= uid (:uid instance)))
            (views/instance instance {:username "guest"})
            (assoc (res/redirect "/") :session nil))))
 
-  (GET "/public-instances/:uid/:instance-id/kubeconfig" {{:keys [uid instance-id]} :params}
-       (let [instance (packet/get-instance instance-id)]
+  (GET "/public-instances/:uid/:instance-id/kubeconfig" {{:keys [uid instance-id]} :params
+                                                         {:keys [user]} :session}
+       (let [instance (packet/get-instance user instance-id)]
          (if (and (:uid instance)(= uid (:uid instance)))
            {:status 200 :body (:kubeconfig instance)}
            (assoc (res/redirect "/") :session nil))))
@@ -102,7 +104,7 @@
   [handler]
   (fn [req]
     (if-let [instance-id (second (re-find #"/instances/id/([a-zA-Z0-9-]*)" (:uri req)))]
-       (let [instance (packet/get-instance instance-id)
+       (let [instance (packet/get-instance (-> req :session :user) instance-id)
              non-nil-instance (select-keys instance (for [[k v] instance :when (not (nil? v))] k))
              response (handler (assoc-in req [:session :instance] instance))]
          response)
@@ -0,0 +1,71 @@
+package common
+
+import (
+	"fmt"
+	"log"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+// Cluster-API versions
+const (
+	// ClusterAPIVersion is the version of the Cluster-API groups which instances are written with
+	ClusterAPIVersion = "v1beta1"
+	// ClusterAPIVersionFallback is the version used for management clusters which don't serve ClusterAPIVersion yet
+	ClusterAPIVersionFallback = "v1alpha3"
+)
+
+// misc Cluster-API version vars
+var (
+	// clusterAPIServedVersions are the versions served of each Cluster-API group, set by DiscoverClusterAPIVersions
+	clusterAPIServedVersions = map[string]string{
+		"cluster.x-k8s.io":                ClusterAPIVersion,
+		"controlplane.cluster.x-k8s.io":   ClusterAPIVersion,
+		"bootstrap.cluster.x-k8s.io":      ClusterAPIVersion,
+		"infrastructure.cluster.x-k8s.io": ClusterAPIVersion,
+	}
+)
+
+// DiscoverClusterAPIVersions ...
+// finds which version of each Cluster-API group the management cluster serves, falling back to v1alpha3 where v1beta1 isn't served
+func DiscoverClusterAPIVersions(discoveryClient discovery.DiscoveryInterface) (err error) {
+	for group := range clusterAPIServedVersions {
+		version := ClusterAPIVersion
+		for _, candidate := range []string{ClusterAPIVersion, ClusterAPIVersionFallback} {
+			_, err = discoveryClient.ServerResourcesForGroupVersion(schema.GroupVersion{Group: group, Version: candidate}.String())
+			if err != nil && apierrors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("Failed to discover versions of '%v', %v", group, err)
+			}
+			version = candidate
+			break
+		}
+		clusterAPIServedVersions[group] = version
+		log.Printf("Using '%v/%v'\n", group, version)
+	}
+	return nil
+}
+
+// ClusterAPIServedVersion ...
+// returns the version of a Cluster-API group which the management cluster serves
+func ClusterAPIServedVersion(group string) string {
+	version, ok := clusterAPIServedVersions[group]
+	if ok != true {
+		return ClusterAPIVersion
+	}
+	return version
+}
+
+// ClusterAPIServedResource ...
+// returns a Cluster-API resource at the version which the management cluster serves.
+// Resources of other groups are returned as is
+func ClusterAPIServedResource(groupVersionResource schema.GroupVersionResource) schema.GroupVersionResource {
+	if _, ok := clusterAPIServedVersions[groupVersionResource.Group]; ok != true {
+		return groupVersionResource
+	}
+	groupVersionResource.Version = ClusterAPIServedVersion(groupVersionResource.Group)
+	return groupVersionResource
+}
@@ -0,0 +1,210 @@
+/*
+	authentication of API requests
+*/
+
+package common
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+)
+
+// identityContextKey ...
+// the key for storing an authenticated identity on a request context
+type identityContextKey struct{}
+
+// auth related vars
+var (
+	// AuthGroupAdmins is the default group of admin identities
+	AuthGroupAdmins = "pair:admins"
+	// AuthGroupImpersonators is the group of identities which may act on behalf of other users
+	AuthGroupImpersonators = "pair:impersonators"
+	// AuthImpersonateUserHeader is the header an impersonator uses to declare the user it's acting for
+	AuthImpersonateUserHeader = "X-Pair-Impersonate-User"
+)
+
+// GetAuthTokens ...
+// returns the static API tokens, mapped to their identities.
+// Declared as space separated entries of 'token:username[:group,group]'
+func GetAuthTokens() map[string]types.Identity {
+	tokens := map[string]types.Identity{}
+	for _, entry := range strings.Fields(GetEnvOrDefault("APP_AUTH_TOKENS", "")) {
+		entrySplit := strings.SplitN(entry, ":", 3)
+		if len(entrySplit) < 2 || entrySplit[0] == "" || entrySplit[1] == "" {
+			log.Println("Ignoring invalid entry in APP_AUTH_TOKENS")
+			continue
+		}
+		identity := types.Identity{
+			Username: entrySplit[1],
+			Method:   types.IdentityMethodToken,
+		}
+		if len(entrySplit) == 3 && entrySplit[2] != "" {
+			identity.Groups = strings.Split(entrySplit[2], ",")
+		}
+		tokens[entrySplit[0]] = identity
+	}
+	return tokens
+}
+
+// GetAuthOIDCIssuer ...
+// returns the issuer of OIDC JWTs to accept
+func GetAuthOIDCIssuer() string {
+	return GetEnvOrDefault("APP_AUTH_OIDC_ISSUER", "")
+}
+
+// GetAuthOIDCJWKSURL ...
+// returns the URL of the JWKS to verify OIDC JWTs with.
+// When not set, it is discovered through the issuer
+func GetAuthOIDCJWKSURL() string {
+	return GetEnvOrDefault("APP_AUTH_OIDC_JWKS_URL", "")
+}
+
+// GetAuthOIDCAudience ...
+// returns the audience that OIDC JWTs must be issued for
+func GetAuthOIDCAudience() string {
+	return GetEnvOrDefault("APP_AUTH_OIDC_AUDIENCE", "")
+}
+
+// GetAuthOIDCUsernameClaim ...
+// returns the JWT claim to use as the username
+func GetAuthOIDCUsernameClaim() string {
+	return GetEnvOrDefault("APP_AUTH_OIDC_USERNAME_CLAIM", "preferred_username")
+}
+
+// GetAuthOIDCGroupsClaim ...
+// returns the JWT claim to use as the groups
+func GetAuthOIDCGroupsClaim() string {
+	return GetEnvOrDefault("APP_AUTH_OIDC_GROUPS_CLAIM", "groups")
+}
+
+// GetAuthAdminGroups ...
+// returns the groups which make an identity an admin
+func GetAuthAdminGroups() []string {
+	return strings.Split(GetEnvOrDefault("APP_AUTH_ADMIN_GROUPS", AuthGroupAdmins), ",")
+}
+
+// IdentityHasGroup ...
+// returns if an identity is a member of any of the groups
+func IdentityHasGroup(identity types.Identity, groups ...string) bool {
+	for _, group := range identity.Groups {
+		for _, g := range groups {
+			if g != "" && group == g {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ContextWithIdentity ...
+// returns a copy of a context, holding an identity
+func ContextWithIdentity(ctx context.Context, identity types.Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext ...
+// returns the authenticated identity of a context
+func IdentityFromContext(ctx context.Context) (identity types.Identity, ok bool) {
+	identity, ok = ctx.Value(identityContextKey{}).(types.Identity)
+	return identity, ok
+}
+
+// IdentityFromRequest ...
+// returns the authenticated identity of a request
+func IdentityFromRequest(r *http.Request) (identity types.Identity, ok bool) {
+	return IdentityFromContext(r.Context())
+}
+
+// getBearerToken ...
+// returns the bearer token from the Authorization header of a request
+func getBearerToken(r *http.Request) string {
+	authorization := r.Header.Get("Authorization")
+	authorizationSplit := strings.SplitN(authorization, " ", 2)
+	if len(authorizationSplit) != 2 || strings.EqualFold(authorizationSplit[0], "Bearer") != true {
+		return ""
+	}
+	return strings.TrimSpace(authorizationSplit[1])
+}
+
+// authenticateStaticToken ...
+// returns the identity for a static API token
+func authenticateStaticToken(token string) (identity types.Identity, ok bool) {
+	for staticToken, staticIdentity := range GetAuthTokens() {
+		if subtle.ConstantTimeCompare([]byte(staticToken), []byte(token)) == 1 {
+			identity, ok = staticIdentity, true
+		}
+	}
+	return identity, ok
+}
+
+// AuthenticateToken ...
+// returns the identity for a bearer token, trying static API tokens then OIDC JWTs
+func AuthenticateToken(token string) (identity types.Identity, err error) {
+	if token == "" {
+		return types.Identity{}, fmt.Errorf("No bearer token provided")
+	}
+	if staticIdentity, ok := authenticateStaticToken(token); ok {
+		identity = staticIdentity
+	} else if GetAuthOIDCIssuer() != "" && LooksLikeJWT(token) {
+		identity, err = AuthenticateOIDCToken(token)
+		if err != nil {
+			return types.Identity{}, err
+		}
+	} else {
+		return types.Identity{}, fmt.Errorf("Invalid bearer token")
+	}
+	identity.Admin = IdentityHasGroup(identity, GetAuthAdminGroups()...)
+	return identity, nil
+}
+
+// Authentication ...
+// authenticate all requests by bearer token, storing the identity in the request context
+func Authentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		identity, err := AuthenticateToken(getBearerToken(r))
+		if err != nil {
+			log.Printf("Failed to authenticate request %v %v from %v: %v\n", r.Method, r.URL, r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sharingio-pair"`)
+			JSONResponse(r, w, http.StatusUnauthorized, types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Unauthorized",
+				},
+			})
+			return
+		}
+		if impersonateUser := r.Header.Get(AuthImpersonateUserHeader); impersonateUser != "" {
+			if IdentityHasGroup(identity, AuthGroupImpersonators) != true {
+				log.Printf("Identity '%v' is not permitted to impersonate '%v'\n", identity.Username, impersonateUser)
+				JSONResponse(r, w, http.StatusForbidden, types.JSONMessageResponse{
+					Metadata: types.JSONResponseMetadata{
+						Response: "Forbidden",
+					},
+				})
+				return
+			}
+			identity = types.Identity{
+				Username:     impersonateUser,
+				Method:       identity.Method,
+				Impersonator: identity.Username,
+			}
+		}
+		if githubToken := GetGitHubTokenFromRequest(r); identity.Admin != true && githubToken != "" {
+			admin, err := GitHubAccountIsAdmin(identity.Username, githubToken)
+			if err != nil {
+				log.Printf("Failed to resolve if '%v' is an admin, %v\n", identity.Username, err)
+			}
+			identity.Admin = admin
+		}
+		next.ServeHTTP(w, r.WithContext(ContextWithIdentity(r.Context(), identity)))
+	})
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+)
+
+func TestGetBearerToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		expected      string
+	}{
+		{name: "bearer token", authorization: "Bearer abc", expected: "abc"},
+		{name: "lowercase scheme", authorization: "bearer abc", expected: "abc"},
+		{name: "surrounding space", authorization: "Bearer  abc ", expected: "abc"},
+		{name: "another scheme", authorization: "Basic YWJjOmRlZg==", expected: ""},
+		{name: "no token", authorization: "Bearer", expected: ""},
+		{name: "no header", authorization: "", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/instance", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			token := getBearerToken(r)
+			if token != tt.expected {
+				t.Errorf("expected token '%v', got '%v'", tt.expected, token)
+			}
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	t.Setenv("APP_AUTH_OIDC_ISSUER", "")
+	t.Setenv("APP_AUTH_ADMIN_GROUPS", "")
+	t.Setenv("APP_AUTH_TOKENS", "user-token:BobyMCbobs admin-token:hh:pair:admins client-token:client:pair:impersonators,clients other-token:calebwoodbine:clients")
+
+	tests := []struct {
+		name             string
+		method           string
+		headers          map[string]string
+		expectedCode     int
+		expectedIdentity *types.Identity
+	}{
+		{
+			name:         "no token",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "invalid token",
+			headers:      map[string]string{"Authorization": "Bearer wrong-token"},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "preflight requests don't need a token",
+			method:       http.MethodOptions,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:             "user token",
+			headers:          map[string]string{"Authorization": "Bearer user-token"},
+			expectedCode:     http.StatusOK,
+			expectedIdentity: &types.Identity{Username: "BobyMCbobs", Method: types.IdentityMethodToken},
+		},
+		{
+			name:             "admin group token",
+			headers:          map[string]string{"Authorization": "Bearer admin-token"},
+			expectedCode:     http.StatusOK,
+			expectedIdentity: &types.Identity{Username: "hh", Method: types.IdentityMethodToken, Groups: []string{"pair:admins"}, Admin: true},
+		},
+		{
+			name: "impersonator acting for a user",
+			headers: map[string]string{
+				"Authorization":           "Bearer client-token",
+				AuthImpersonateUserHeader: "calebwoodbine",
+			},
+			expectedCode:     http.StatusOK,
+			expectedIdentity: &types.Identity{Username: "calebwoodbine", Method: types.IdentityMethodToken, Impersonator: "client"},
+		},
+		{
+			name:             "impersonator acting as itself",
+			headers:          map[string]string{"Authorization": "Bearer client-token"},
+			expectedCode:     http.StatusOK,
+			expectedIdentity: &types.Identity{Username: "client", Method: types.IdentityMethodToken, Groups: []string{"pair:impersonators", "clients"}},
+		},
+		{
+			name: "impersonating without being an impersonator",
+			headers: map[string]string{
+				"Authorization":           "Bearer other-token",
+				AuthImpersonateUserHeader: "BobyMCbobs",
+			},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name: "impersonating without a valid token",
+			headers: map[string]string{
+				"Authorization":           "Bearer wrong-token",
+				AuthImpersonateUserHeader: "BobyMCbobs",
+			},
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var identity *types.Identity
+			handler := Authentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if i, ok := IdentityFromRequest(r); ok == true {
+					identity = &i
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/api/instance", nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.expectedCode {
+				t.Fatalf("expected status code %v, got %v", tt.expectedCode, w.Code)
+			}
+			if tt.expectedCode == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("expected a WWW-Authenticate header")
+			}
+			if reflect.DeepEqual(identity, tt.expectedIdentity) != true {
+				t.Errorf("expected identity %#v, got %#v", tt.expectedIdentity, identity)
+			}
+		})
+	}
+}
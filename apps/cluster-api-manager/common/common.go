@@ -80,8 +80,13 @@ func GetAdminEmailDomain() string {
 
 // GetGitHubAdminOrgs ...
 // returns the GitHub admin orgs
-func GetGitHubAdminOrgs() []string {
-	return strings.Split(GetEnvOrDefault("APP_GITHUB_ADMIN_ORGS", ""), ",")
+func GetGitHubAdminOrgs() (orgs []string) {
+	for _, org := range strings.Split(GetEnvOrDefault("APP_GITHUB_ADMIN_ORGS", ""), ",") {
+		if org = strings.TrimSpace(org); org != "" {
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs
 }
 
 // GetNonAdminInstanceMaxAmount ...
@@ -201,20 +206,3 @@ func GetEmailDomainFromEmail(email string) string {
 	}
 	return ""
 }
-
-// AccountIsAdmin ...
-// determine if account is an admin
-func AccountIsAdmin(emails []types.GitHubEmail) bool {
-	fmt.Println("EMAILS ::::", emails)
-	adminEmailDomain := GetAdminEmailDomain()
-	if adminEmailDomain == "" {
-		fmt.Println("No admin orgs declared, assuming any account is admin")
-		return true
-	}
-	for _, e := range emails {
-		if GetEmailDomainFromEmail(e.Email) == adminEmailDomain {
-			return true
-		}
-	}
-	return false
-}
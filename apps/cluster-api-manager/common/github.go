@@ -0,0 +1,188 @@
+/*
+	resolving admins from GitHub accounts
+*/
+
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+)
+
+// githubAdminCacheEntry ...
+// a resolved admin status of a GitHub account
+type githubAdminCacheEntry struct {
+	admin     bool
+	err       error
+	expiresAt time.Time
+}
+
+// githubAdminCache ...
+// resolved admin statuses, keyed by a hash of the username and token
+type githubAdminCache struct {
+	sync.Mutex
+	entries map[string]githubAdminCacheEntry
+}
+
+// misc GitHub vars
+var (
+	// AuthGitHubTokenHeader is the header a caller declares it's GitHub token in, for resolving if it's an admin
+	AuthGitHubTokenHeader = "X-Pair-GitHub-Token"
+	githubAdmins          = githubAdminCache{entries: map[string]githubAdminCacheEntry{}}
+	githubHTTPClient      = &http.Client{Timeout: 10 * time.Second}
+)
+
+// GetGitHubAPIBaseURL ...
+// returns the base URL of the GitHub API
+func GetGitHubAPIBaseURL() string {
+	return strings.TrimSuffix(GetEnvOrDefault("APP_GITHUB_API_BASE_URL", "https://api.github.com"), "/")
+}
+
+// GetGitHubAdminCacheTTL ...
+// returns how long to remember if a GitHub account is an admin
+func GetGitHubAdminCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(GetEnvOrDefault("APP_GITHUB_ADMIN_CACHE_TTL", "10m"))
+	if err != nil || ttl < 0 {
+		log.Println("Invalid APP_GITHUB_ADMIN_CACHE_TTL, using 10m")
+		return 10 * time.Minute
+	}
+	return ttl
+}
+
+// GetGitHubAdminFailureCacheTTL ...
+// returns how long to remember that resolving if a GitHub account is an admin failed,
+// so that bad or rate limited tokens don't query GitHub on every request
+func GetGitHubAdminFailureCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(GetEnvOrDefault("APP_GITHUB_ADMIN_FAILURE_CACHE_TTL", "1m"))
+	if err != nil || ttl < 0 {
+		log.Println("Invalid APP_GITHUB_ADMIN_FAILURE_CACHE_TTL, using 1m")
+		return time.Minute
+	}
+	return ttl
+}
+
+// githubGetJSONInto ...
+// decode the JSON response of a GET request to the GitHub API, as the owner of a token, into output
+func githubGetJSONInto(token string, endpoint string, output interface{}) error {
+	url := GetGitHubAPIBaseURL() + endpoint
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "token "+token)
+	resp, err := githubHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response status '%v' from '%v'", resp.Status, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(output)
+}
+
+// resolveGitHubAdmin ...
+// returns if the GitHub account of a token belongs to username and has a verified email in the admin domain or is a member of an admin org
+func resolveGitHubAdmin(username string, token string) (admin bool, err error) {
+	user := struct {
+		Login string `json:"login"`
+	}{}
+	err = githubGetJSONInto(token, "/user", &user)
+	if err != nil {
+		return false, fmt.Errorf("Failed to get GitHub user, %v", err)
+	}
+	if strings.EqualFold(user.Login, username) != true {
+		return false, fmt.Errorf("GitHub token belongs to '%v', not '%v'", user.Login, username)
+	}
+
+	if adminEmailDomain := GetAdminEmailDomain(); adminEmailDomain != "" {
+		emails := []types.GitHubEmail{}
+		err = githubGetJSONInto(token, "/user/emails", &emails)
+		if err != nil {
+			return false, fmt.Errorf("Failed to get GitHub emails, %v", err)
+		}
+		for _, e := range emails {
+			if e.Verified == true && strings.EqualFold(GetEmailDomainFromEmail(e.Email), adminEmailDomain) {
+				return true, nil
+			}
+		}
+	}
+
+	if adminOrgs := GetGitHubAdminOrgs(); len(adminOrgs) > 0 {
+		orgs := []struct {
+			Login string `json:"login"`
+		}{}
+		err = githubGetJSONInto(token, "/user/orgs", &orgs)
+		if err != nil {
+			return false, fmt.Errorf("Failed to get GitHub orgs, %v", err)
+		}
+		for _, org := range orgs {
+			for _, adminOrg := range adminOrgs {
+				if strings.EqualFold(org.Login, adminOrg) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// GitHubAccountIsAdmin ...
+// returns if the GitHub account of a token belongs to username and is an admin, remembering the result for the cache TTL
+// and failures for the failure cache TTL.
+// No account is an admin when neither an admin email domain or orgs are declared
+func GitHubAccountIsAdmin(username string, token string) (admin bool, err error) {
+	if username == "" || token == "" {
+		return false, nil
+	}
+	if GetAdminEmailDomain() == "" && len(GetGitHubAdminOrgs()) == 0 {
+		return false, nil
+	}
+	keySum := sha256.Sum256([]byte(username + ":" + token))
+	key := hex.EncodeToString(keySum[:])
+
+	githubAdmins.Lock()
+	entry, ok := githubAdmins.entries[key]
+	githubAdmins.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.admin, entry.err
+	}
+
+	admin, err = resolveGitHubAdmin(username, token)
+	ttl := GetGitHubAdminCacheTTL()
+	if err != nil {
+		admin = false
+		ttl = GetGitHubAdminFailureCacheTTL()
+	}
+
+	now := time.Now()
+	githubAdmins.Lock()
+	defer githubAdmins.Unlock()
+	for k, e := range githubAdmins.entries {
+		if now.After(e.expiresAt) {
+			delete(githubAdmins.entries, k)
+		}
+	}
+	githubAdmins.entries[key] = githubAdminCacheEntry{
+		admin:     admin,
+		err:       err,
+		expiresAt: now.Add(ttl),
+	}
+	return admin, err
+}
+
+// GetGitHubTokenFromRequest ...
+// returns the GitHub token declared in the header of a request
+func GetGitHubTokenFromRequest(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get(AuthGitHubTokenHeader))
+}
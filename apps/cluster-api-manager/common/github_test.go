@@ -0,0 +1,206 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+)
+
+// newGitHubAPIServer ...
+// returns a fake GitHub API, where gho_<login> tokens belong to each login and
+// requests counts the requests made to it
+func newGitHubAPIServer(t *testing.T, requests *int32) *httptest.Server {
+	logins := map[string]string{
+		"token gho_bobymcbobs":    "BobyMCbobs",
+		"token gho_calebwoodbine": "calebwoodbine",
+		"token gho_hh":            "hh",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		login, ok := logins[r.Header.Get("Authorization")]
+		if ok != true {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/user":
+			json.NewEncoder(w).Encode(map[string]string{"login": login})
+		case "/user/orgs":
+			orgs := []map[string]string{{"login": "kubernetes"}}
+			if login == "BobyMCbobs" {
+				orgs = append(orgs, map[string]string{"login": "sharingio"})
+			}
+			json.NewEncoder(w).Encode(orgs)
+		case "/user/emails":
+			emails := []types.GitHubEmail{{Email: login + "@example.com", Verified: true}}
+			if login == "hh" {
+				emails = append(emails, types.GitHubEmail{Email: "hh@ii.coop", Verified: true})
+			}
+			if login == "calebwoodbine" {
+				emails = append(emails, types.GitHubEmail{Email: "caleb@ii.coop", Verified: false})
+			}
+			json.NewEncoder(w).Encode(emails)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("APP_GITHUB_API_BASE_URL", server.URL)
+	githubAdmins.Lock()
+	githubAdmins.entries = map[string]githubAdminCacheEntry{}
+	githubAdmins.Unlock()
+	return server
+}
+
+func TestGitHubAccountIsAdmin(t *testing.T) {
+	var requests int32
+	newGitHubAPIServer(t, &requests)
+
+	tests := []struct {
+		name        string
+		orgs        string
+		emailDomain string
+		username    string
+		token       string
+		expected    bool
+		wantErr     bool
+	}{
+		{name: "member of an admin org", orgs: "sharingio", username: "bobymcbobs", token: "gho_bobymcbobs", expected: true},
+		{name: "not a member of an admin org", orgs: "sharingio", username: "calebwoodbine", token: "gho_calebwoodbine"},
+		{name: "verified email in the admin domain", emailDomain: "ii.coop", username: "hh", token: "gho_hh", expected: true},
+		{name: "unverified email in the admin domain", emailDomain: "ii.coop", username: "calebwoodbine", token: "gho_calebwoodbine"},
+		{name: "no admin orgs or domain", username: "bobymcbobs", token: "gho_bobymcbobs"},
+		{name: "token of another account", orgs: "sharingio", username: "calebwoodbine", token: "gho_bobymcbobs", wantErr: true},
+		{name: "invalid token", orgs: "sharingio", username: "bobymcbobs", token: "gho_invalid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_GITHUB_ADMIN_ORGS", tt.orgs)
+			t.Setenv("APP_ADMIN_EMAIL_DOMAIN", tt.emailDomain)
+			admin, err := GitHubAccountIsAdmin(tt.username, tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if admin != tt.expected {
+				t.Errorf("expected admin %v, got %v", tt.expected, admin)
+			}
+		})
+	}
+}
+
+func TestGitHubAccountIsAdminCache(t *testing.T) {
+	var requests int32
+	newGitHubAPIServer(t, &requests)
+	t.Setenv("APP_GITHUB_ADMIN_ORGS", "sharingio")
+	t.Setenv("APP_ADMIN_EMAIL_DOMAIN", "")
+
+	tests := []struct {
+		name             string
+		failureTTL       string
+		token            string
+		expectedRequests int32
+	}{
+		{name: "successful lookups are remembered", token: "gho_bobymcbobs", expectedRequests: 2},
+		{name: "failed lookups are remembered", token: "gho_invalid", expectedRequests: 1},
+		{name: "failed lookups are forgotten without a failure TTL", failureTTL: "0s", token: "gho_invalid", expectedRequests: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_GITHUB_ADMIN_FAILURE_CACHE_TTL", tt.failureTTL)
+			githubAdmins.Lock()
+			githubAdmins.entries = map[string]githubAdminCacheEntry{}
+			githubAdmins.Unlock()
+			atomic.StoreInt32(&requests, 0)
+			for i := 0; i < 3; i++ {
+				GitHubAccountIsAdmin("BobyMCbobs", tt.token)
+			}
+			if atomic.LoadInt32(&requests) != tt.expectedRequests {
+				t.Errorf("expected %v requests to GitHub, got %v", tt.expectedRequests, requests)
+			}
+		})
+	}
+}
+
+func TestAuthenticationGitHubAdmin(t *testing.T) {
+	var requests int32
+	newGitHubAPIServer(t, &requests)
+	t.Setenv("APP_GITHUB_ADMIN_ORGS", "sharingio")
+	t.Setenv("APP_ADMIN_EMAIL_DOMAIN", "")
+	t.Setenv("APP_AUTH_OIDC_ISSUER", "")
+	t.Setenv("APP_AUTH_ADMIN_GROUPS", "")
+	t.Setenv("APP_AUTH_TOKENS", "user-token:BobyMCbobs client-token:client:pair:impersonators other-token:calebwoodbine")
+
+	tests := []struct {
+		name             string
+		headers          map[string]string
+		expectedIdentity types.Identity
+	}{
+		{
+			name: "GitHub account in an admin org",
+			headers: map[string]string{
+				"Authorization":       "Bearer user-token",
+				AuthGitHubTokenHeader: "gho_bobymcbobs",
+			},
+			expectedIdentity: types.Identity{Username: "BobyMCbobs", Method: types.IdentityMethodToken, Admin: true},
+		},
+		{
+			name: "GitHub account of an impersonated user in an admin org",
+			headers: map[string]string{
+				"Authorization":           "Bearer client-token",
+				AuthImpersonateUserHeader: "bobymcbobs",
+				AuthGitHubTokenHeader:     "gho_bobymcbobs",
+			},
+			expectedIdentity: types.Identity{Username: "bobymcbobs", Method: types.IdentityMethodToken, Impersonator: "client", Admin: true},
+		},
+		{
+			name: "GitHub account not in an admin org",
+			headers: map[string]string{
+				"Authorization":       "Bearer other-token",
+				AuthGitHubTokenHeader: "gho_calebwoodbine",
+			},
+			expectedIdentity: types.Identity{Username: "calebwoodbine", Method: types.IdentityMethodToken},
+		},
+		{
+			name: "GitHub account of someone else",
+			headers: map[string]string{
+				"Authorization":       "Bearer other-token",
+				AuthGitHubTokenHeader: "gho_bobymcbobs",
+			},
+			expectedIdentity: types.Identity{Username: "calebwoodbine", Method: types.IdentityMethodToken},
+		},
+		{
+			name: "invalid GitHub token",
+			headers: map[string]string{
+				"Authorization":       "Bearer user-token",
+				AuthGitHubTokenHeader: "gho_invalid",
+			},
+			expectedIdentity: types.Identity{Username: "BobyMCbobs", Method: types.IdentityMethodToken},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var identity types.Identity
+			handler := Authentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				identity, _ = IdentityFromRequest(r)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/api/instance", nil)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status code %v, got %v", http.StatusOK, w.Code)
+			}
+			if reflect.DeepEqual(identity, tt.expectedIdentity) != true {
+				t.Errorf("expected identity %#v, got %#v", tt.expectedIdentity, identity)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+/*
+	storing objects in S3 compatible object storage, such as MinIO
+*/
+
+package common
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ObjectStorageObject ...
+// an object in the bucket
+type ObjectStorageObject struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// ObjectStorageNotFoundError ...
+// an object which isn't in the bucket
+type ObjectStorageNotFoundError struct {
+	Key string
+}
+
+func (e ObjectStorageNotFoundError) Error() string {
+	return fmt.Sprintf("Object '%v' not found", e.Key)
+}
+
+// objectStorageListResult ...
+// a page of the response of ListObjectsV2
+type objectStorageListResult struct {
+	Contents              []ObjectStorageObject `xml:"Contents"`
+	IsTruncated           bool                  `xml:"IsTruncated"`
+	NextContinuationToken string                `xml:"NextContinuationToken"`
+}
+
+// misc object storage vars
+var (
+	objectStorageHTTPClient = &http.Client{Timeout: 5 * time.Minute}
+	// objectStorageEmptyPayloadHash is the hash of a request without a body
+	objectStorageEmptyPayloadHash = fmt.Sprintf("%x", sha256.Sum256([]byte{}))
+)
+
+// GetObjectStorageEndpoint ...
+// returns the URL of the S3 compatible API, such as http://minio:9000
+func GetObjectStorageEndpoint() string {
+	return strings.TrimSuffix(GetEnvOrDefault("APP_BACKUP_S3_ENDPOINT", ""), "/")
+}
+
+// GetObjectStorageBucket ...
+// returns the bucket to store objects in
+func GetObjectStorageBucket() string {
+	return GetEnvOrDefault("APP_BACKUP_S3_BUCKET", "")
+}
+
+// GetObjectStorageRegion ...
+// returns the region of the bucket, which requests are signed for
+func GetObjectStorageRegion() string {
+	return GetEnvOrDefault("APP_BACKUP_S3_REGION", "us-east-1")
+}
+
+// ObjectStorageEnabled ...
+// returns if object storage is configured
+func ObjectStorageEnabled() bool {
+	return GetObjectStorageEndpoint() != "" && GetObjectStorageBucket() != ""
+}
+
+// objectStorageEscapePath ...
+// returns a key escaped for the path of a request, keeping it's slashes.
+// Every byte besides the unreserved characters is escaped, as signing expects
+func objectStorageEscapePath(key string) string {
+	escaped := strings.Builder{}
+	for _, b := range []byte(key) {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9', b == '-', b == '_', b == '.', b == '~', b == '/':
+			escaped.WriteByte(b)
+		default:
+			escaped.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return escaped.String()
+}
+
+// objectStorageHMAC ...
+// returns the HMAC-SHA256 of data with key
+func objectStorageHMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signObjectStorageRequest ...
+// sign a request with AWS Signature Version 4, using the access key in APP_BACKUP_S3_ACCESS_KEY_ID and APP_BACKUP_S3_SECRET_ACCESS_KEY
+func signObjectStorageRequest(req *http.Request, path string, query string, payloadHash string, now time.Time) {
+	accessKeyID := GetEnvOrDefault("APP_BACKUP_S3_ACCESS_KEY_ID", "")
+	secretAccessKey := GetEnvOrDefault("APP_BACKUP_S3_SECRET_ACCESS_KEY", "")
+	region := GetObjectStorageRegion()
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := now.UTC().Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%v\nx-amz-content-sha256:%v\nx-amz-date:%v\n", req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		query,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		fmt.Sprintf("%x", sha256.Sum256([]byte(canonicalRequest))),
+	}, "\n")
+	signingKey := objectStorageHMAC([]byte("AWS4"+secretAccessKey), date)
+	signingKey = objectStorageHMAC(signingKey, region)
+	signingKey = objectStorageHMAC(signingKey, "s3")
+	signingKey = objectStorageHMAC(signingKey, "aws4_request")
+	signature := hex.EncodeToString(objectStorageHMAC(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v", accessKeyID, scope, signedHeaders, signature))
+}
+
+// objectStorageRequest ...
+// perform a signed request against an object in the bucket, or the bucket itself when key is empty.
+// The bucket is addressed by path, as MinIO expects by default
+func objectStorageRequest(method string, key string, query url.Values, body []byte) (data []byte, err error) {
+	if ObjectStorageEnabled() != true {
+		return nil, fmt.Errorf("Object storage is not configured")
+	}
+	path := "/" + objectStorageEscapePath(GetObjectStorageBucket())
+	if key != "" {
+		path += "/" + objectStorageEscapePath(key)
+	}
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+	endpoint := GetObjectStorageEndpoint() + path
+	if canonicalQuery != "" {
+		endpoint += "?" + canonicalQuery
+	}
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := objectStorageEmptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = fmt.Sprintf("%x", sha256.Sum256(body))
+	}
+	signObjectStorageRequest(req, path, canonicalQuery, payloadHash, time.Now())
+	resp, err := objectStorageHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		return nil, ObjectStorageNotFoundError{Key: key}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Unexpected response status '%v' from object storage, %v", resp.Status, string(data))
+	}
+	return data, nil
+}
+
+// ObjectStoragePut ...
+// store an object in the bucket, replacing any with the same key
+func ObjectStoragePut(key string, data []byte) (err error) {
+	_, err = objectStorageRequest(http.MethodPut, key, nil, data)
+	if err != nil {
+		return fmt.Errorf("Failed to store object '%v', %v", key, err)
+	}
+	return nil
+}
+
+// ObjectStorageGet ...
+// returns an object in the bucket, or an ObjectStorageNotFoundError
+func ObjectStorageGet(key string) (data []byte, err error) {
+	data, err = objectStorageRequest(http.MethodGet, key, nil, nil)
+	if _, notFound := err.(ObjectStorageNotFoundError); notFound == true {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to get object '%v', %v", key, err)
+	}
+	return data, nil
+}
+
+// ObjectStorageDelete ...
+// delete an object in the bucket, which succeeds if it doesn't exist
+func ObjectStorageDelete(key string) (err error) {
+	_, err = objectStorageRequest(http.MethodDelete, key, nil, nil)
+	if _, notFound := err.(ObjectStorageNotFoundError); notFound == true {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to delete object '%v', %v", key, err)
+	}
+	return nil
+}
+
+// ObjectStorageList ...
+// returns the objects in the bucket with keys starting with prefix, sorted by key
+func ObjectStorageList(prefix string) (objects []ObjectStorageObject, err error) {
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		data, err := objectStorageRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list objects, %v", err)
+		}
+		var result objectStorageListResult
+		err = xml.Unmarshal(data, &result)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse list of objects, %v", err)
+		}
+		objects = append(objects, result.Contents...)
+		if result.IsTruncated != true || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
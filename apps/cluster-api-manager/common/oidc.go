@@ -0,0 +1,338 @@
+/*
+	verification of OIDC JWTs
+*/
+
+package common
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+)
+
+// JSONWebKey ...
+// a public key from a JWKS
+type JSONWebKey struct {
+	KeyID string `json:"kid"`
+	Type  string `json:"kty"`
+	Use   string `json:"use"`
+	N     string `json:"n"`
+	E     string `json:"e"`
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// JSONWebKeySet ...
+// a set of public keys
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// jwtHeader ...
+// fields in the header of a JWT
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// jwksCache ...
+// public keys fetched from the JWKS URL
+type jwksCache struct {
+	sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// misc OIDC vars
+var (
+	jwks                = jwksCache{}
+	jwksCacheTTL        = 10 * time.Minute
+	jwksMinRefreshDelay = 30 * time.Second
+	jwtClockSkew        = time.Minute
+	oidcHTTPClient      = &http.Client{Timeout: 10 * time.Second}
+)
+
+// LooksLikeJWT ...
+// returns if a token is shaped like a JWT
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// httpGetJSONInto ...
+// decode the JSON response of a GET request into output
+func httpGetJSONInto(url string, output interface{}) error {
+	resp, err := oidcHTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response status '%v' from '%v'", resp.Status, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(output)
+}
+
+// discoverJWKSURL ...
+// returns the JWKS URL for the issuer, from the configuration or OIDC discovery
+func discoverJWKSURL() (string, error) {
+	if jwksURL := GetAuthOIDCJWKSURL(); jwksURL != "" {
+		return jwksURL, nil
+	}
+	discovery := struct {
+		JWKSURI string `json:"jwks_uri"`
+	}{}
+	err := httpGetJSONInto(strings.TrimSuffix(GetAuthOIDCIssuer(), "/")+"/.well-known/openid-configuration", &discovery)
+	if err != nil {
+		return "", fmt.Errorf("Failed to discover OIDC configuration, %v", err)
+	}
+	if discovery.JWKSURI == "" {
+		return "", fmt.Errorf("OIDC configuration has no jwks_uri")
+	}
+	return discovery.JWKSURI, nil
+}
+
+// decodeBase64URLBigInt ...
+// decode a base64url field into a big int
+func decodeBase64URLBigInt(input string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(input)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// PublicKey ...
+// returns a JSONWebKey as a crypto public key
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Type {
+	case "RSA":
+		n, err := decodeBase64URLBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URLBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("Unsupported curve '%v'", k.Curve)
+		}
+		x, err := decodeBase64URLBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URLBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("Unsupported key type '%v'", k.Type)
+	}
+}
+
+// getJWKSKey ...
+// returns the public key for a key ID, refetching the JWKS when the key is unknown or the cache expired
+func getJWKSKey(keyID string) (crypto.PublicKey, error) {
+	jwks.Lock()
+	defer jwks.Unlock()
+	key, found := jwks.keys[keyID]
+	sinceFetch := time.Since(jwks.fetchedAt)
+	if (found && sinceFetch < jwksCacheTTL) || (!found && sinceFetch < jwksMinRefreshDelay) {
+		if !found {
+			return nil, fmt.Errorf("Unknown key ID '%v'", keyID)
+		}
+		return key, nil
+	}
+
+	jwksURL, err := discoverJWKSURL()
+	if err != nil {
+		return nil, err
+	}
+	var keySet JSONWebKeySet
+	if err := httpGetJSONInto(jwksURL, &keySet); err != nil {
+		return nil, fmt.Errorf("Failed to fetch JWKS, %v", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range keySet.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		publicKey, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.KeyID] = publicKey
+	}
+	jwks.keys = keys
+	jwks.fetchedAt = time.Now()
+	key, found = jwks.keys[keyID]
+	if !found {
+		return nil, fmt.Errorf("Unknown key ID '%v'", keyID)
+	}
+	return key, nil
+}
+
+// verifyJWTSignature ...
+// verify the signature of a JWT's signing input with a public key
+func verifyJWTSignature(algorithm string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	var hash crypto.Hash
+	switch algorithm[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("Unsupported algorithm '%v'", algorithm)
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(signingInput))
+	digest := hasher.Sum(nil)
+
+	switch algorithm[:2] {
+	case "RS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("Key is not an RSA key")
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("Key is not an EC key")
+		}
+		size := len(signature) / 2
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if ecdsa.Verify(ecKey, digest, r, s) != true {
+			return fmt.Errorf("Invalid signature")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("Unsupported algorithm '%v'", algorithm)
+	}
+}
+
+// claimAsStrings ...
+// returns a claim, which may be a string or a list of strings, as a slice
+func claimAsStrings(claim interface{}) (output []string) {
+	switch value := claim.(type) {
+	case string:
+		output = append(output, value)
+	case []interface{}:
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				output = append(output, s)
+			}
+		}
+	}
+	return output
+}
+
+// claimAsTime ...
+// returns a NumericDate claim as a time
+func claimAsTime(claim interface{}) (t time.Time, ok bool) {
+	value, ok := claim.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// AuthenticateOIDCToken ...
+// verify an OIDC JWT against the configured issuer and JWKS, returning its identity
+func AuthenticateOIDCToken(token string) (identity types.Identity, err error) {
+	tokenSplit := strings.Split(token, ".")
+	if len(tokenSplit) != 3 {
+		return identity, fmt.Errorf("Malformed JWT")
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(tokenSplit[0])
+	if err != nil {
+		return identity, fmt.Errorf("Malformed JWT header, %v", err)
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return identity, fmt.Errorf("Malformed JWT header, %v", err)
+	}
+	if len(header.Algorithm) != 5 {
+		return identity, fmt.Errorf("Unsupported algorithm '%v'", header.Algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(tokenSplit[2])
+	if err != nil {
+		return identity, fmt.Errorf("Malformed JWT signature, %v", err)
+	}
+	key, err := getJWKSKey(header.KeyID)
+	if err != nil {
+		return identity, err
+	}
+	if err := verifyJWTSignature(header.Algorithm, key, tokenSplit[0]+"."+tokenSplit[1], signature); err != nil {
+		return identity, fmt.Errorf("Failed to verify JWT signature, %v", err)
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(tokenSplit[1])
+	if err != nil {
+		return identity, fmt.Errorf("Malformed JWT payload, %v", err)
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
+		return identity, fmt.Errorf("Malformed JWT payload, %v", err)
+	}
+	if issuer, _ := claims["iss"].(string); issuer != GetAuthOIDCIssuer() {
+		return identity, fmt.Errorf("Unexpected JWT issuer '%v'", issuer)
+	}
+	if audience := GetAuthOIDCAudience(); audience != "" {
+		audienceFound := false
+		for _, aud := range claimAsStrings(claims["aud"]) {
+			if aud == audience {
+				audienceFound = true
+			}
+		}
+		if !audienceFound {
+			return identity, fmt.Errorf("JWT not issued for audience '%v'", audience)
+		}
+	}
+	now := time.Now()
+	expiry, ok := claimAsTime(claims["exp"])
+	if !ok || now.After(expiry.Add(jwtClockSkew)) {
+		return identity, fmt.Errorf("JWT has expired")
+	}
+	if notBefore, ok := claimAsTime(claims["nbf"]); ok && now.Add(jwtClockSkew).Before(notBefore) {
+		return identity, fmt.Errorf("JWT is not valid yet")
+	}
+
+	identity.Username, _ = claims[GetAuthOIDCUsernameClaim()].(string)
+	if identity.Username == "" {
+		return identity, fmt.Errorf("JWT has no '%v' claim", GetAuthOIDCUsernameClaim())
+	}
+	identity.Groups = claimAsStrings(claims[GetAuthOIDCGroupsClaim()])
+	identity.Method = types.IdentityMethodOIDC
+	return identity, nil
+}
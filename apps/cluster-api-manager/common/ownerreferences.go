@@ -0,0 +1,67 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// misc owner reference vars
+var (
+	// instanceClusterGroupVersionResource is the API which serves the Cluster of each instance
+	instanceClusterGroupVersionResource = schema.GroupVersionResource{Version: ClusterAPIVersion, Group: "cluster.x-k8s.io", Resource: "clusters"}
+)
+
+// ClusterOwnerReference ...
+// returns an OwnerReference to a Cluster, for the resources of it's instance to be garbage collected with it
+func ClusterOwnerReference(cluster *unstructured.Unstructured) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: cluster.GetAPIVersion(),
+		Kind:       cluster.GetKind(),
+		Name:       cluster.GetName(),
+		UID:        cluster.GetUID(),
+	}
+}
+
+// GetInstanceClusterOwnerReference ...
+// returns an OwnerReference to the Cluster of an instance
+func GetInstanceClusterOwnerReference(dynamicClient dynamic.Interface, instanceName string) (ownerReference metav1.OwnerReference, err error) {
+	cluster, err := dynamicClient.Resource(ClusterAPIServedResource(instanceClusterGroupVersionResource)).Namespace(GetTargetNamespace()).Get(context.TODO(), instanceName, metav1.GetOptions{})
+	if err != nil {
+		return metav1.OwnerReference{}, fmt.Errorf("Failed to get Cluster for instance '%v', %v", instanceName, err)
+	}
+	return ClusterOwnerReference(cluster), nil
+}
+
+// AddOwnerReference ...
+// adds an OwnerReference to an object if it's not already an owner, returning if it was added
+func AddOwnerReference(obj metav1.Object, ownerReference metav1.OwnerReference) bool {
+	ownerReferences := obj.GetOwnerReferences()
+	for _, existingOwnerReference := range ownerReferences {
+		if existingOwnerReference.UID == ownerReference.UID {
+			return false
+		}
+	}
+	obj.SetOwnerReferences(append(ownerReferences, ownerReference))
+	return true
+}
+
+// RemoveOwnerReference ...
+// removes an OwnerReference from an object, returning if it was an owner
+func RemoveOwnerReference(obj metav1.Object, ownerReference metav1.OwnerReference) bool {
+	ownerReferences := []metav1.OwnerReference{}
+	removed := false
+	for _, existingOwnerReference := range obj.GetOwnerReferences() {
+		if existingOwnerReference.UID == ownerReference.UID {
+			removed = true
+			continue
+		}
+		ownerReferences = append(ownerReferences, existingOwnerReference)
+	}
+	obj.SetOwnerReferences(ownerReferences)
+	return removed
+}
@@ -75,6 +75,13 @@ func UpsertDNSEndpoint(dynamicClientset dynamic.Interface, entry Entry, instance
 			},
 		},
 	}
+	// owned by the instance's Cluster, to be garbage collected with it
+	ownerReference, err := common.GetInstanceClusterOwnerReference(dynamicClientset, instanceName)
+	if err != nil {
+		log.Printf("Not setting owner of DNSEndpoint, %v\n", err)
+	} else {
+		endpoint.ObjectMeta.OwnerReferences = []metav1.OwnerReference{ownerReference}
+	}
 	groupVersionResource := schema.GroupVersionResource{Version: "v1alpha1", Group: "externaldns.k8s.io", Resource: "dnsendpoints"}
 	asUnstructured, err := common.ObjectToUnstructured(endpoint)
 	asUnstructured.SetGroupVersionKind(schema.GroupVersionKind{Version: groupVersionResource.Version, Group: groupVersionResource.Group, Kind: "DNSEndpoint"})
@@ -0,0 +1,77 @@
+package instances
+
+import (
+	"strings"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+)
+
+// InstanceAction ...
+// an action taken on an instance by an identity
+type InstanceAction string
+
+// instance actions
+const (
+	// InstanceActionRead is fetching an instance and it's kubeconfig or ingresses
+	InstanceActionRead InstanceAction = "Read"
+	// InstanceActionAttach is fetching an instance's tmate sessions
+	InstanceActionAttach InstanceAction = "Attach"
+	// InstanceActionManage is reconciling an instance's DNS, certs and nodes
+	InstanceActionManage InstanceAction = "Manage"
+	// InstanceActionDelete is deleting an instance
+	InstanceActionDelete InstanceAction = "Delete"
+	// InstanceActionReveal is fetching the secret env values of an instance
+	InstanceActionReveal InstanceAction = "Reveal"
+)
+
+// InstanceRole ...
+// the relationship of an identity to an instance
+type InstanceRole string
+
+// instance roles
+const (
+	InstanceRoleNone  InstanceRole = "None"
+	InstanceRoleGuest InstanceRole = "Guest"
+	InstanceRoleOwner InstanceRole = "Owner"
+	InstanceRoleAdmin InstanceRole = "Admin"
+)
+
+// instanceRoleActions ...
+// the actions which each role may take
+var instanceRoleActions = map[InstanceRole][]InstanceAction{
+	InstanceRoleGuest: {InstanceActionRead, InstanceActionAttach},
+	InstanceRoleOwner: {InstanceActionRead, InstanceActionAttach, InstanceActionManage, InstanceActionDelete, InstanceActionReveal},
+	InstanceRoleAdmin: {InstanceActionRead, InstanceActionAttach, InstanceActionManage, InstanceActionDelete},
+}
+
+// GetInstanceRole ...
+// returns the role of an identity on an instance.
+// Owners which are admins keep the owner role, so that they may still reveal their secret env
+func GetInstanceRole(instance InstanceSpec, identity types.Identity) InstanceRole {
+	if identity.Username != "" && strings.EqualFold(instance.Setup.User, identity.Username) {
+		return InstanceRoleOwner
+	}
+	if identity.Admin == true {
+		return InstanceRoleAdmin
+	}
+	if identity.Username == "" {
+		return InstanceRoleNone
+	}
+	for _, guest := range instance.Setup.Guests {
+		if guest != "" && strings.EqualFold(guest, identity.Username) {
+			return InstanceRoleGuest
+		}
+	}
+	return InstanceRoleNone
+}
+
+// IdentityCanOnInstance ...
+// returns if an identity is permitted to take an action on an instance
+func IdentityCanOnInstance(instance InstanceSpec, identity types.Identity, action InstanceAction) bool {
+	for _, a := range instanceRoleActions[GetInstanceRole(instance, identity)] {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
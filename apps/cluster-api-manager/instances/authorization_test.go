@@ -0,0 +1,105 @@
+package instances
+
+import (
+	"testing"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+)
+
+func TestGetInstanceRole(t *testing.T) {
+	instance := InstanceSpec{
+		Setup: types.SetupSpec{
+			User:   "BobyMCbobs",
+			Guests: []string{"", "CalebWoodbine"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		identity types.Identity
+		expected InstanceRole
+	}{
+		{name: "owner", identity: types.Identity{Username: "BobyMCbobs"}, expected: InstanceRoleOwner},
+		{name: "owner in another case", identity: types.Identity{Username: "bobymcbobs"}, expected: InstanceRoleOwner},
+		{name: "guest in another case", identity: types.Identity{Username: "calebwoodbine"}, expected: InstanceRoleGuest},
+		{name: "admin", identity: types.Identity{Username: "hh", Admin: true}, expected: InstanceRoleAdmin},
+		{name: "admin which owns the instance", identity: types.Identity{Username: "BobyMCbobs", Admin: true}, expected: InstanceRoleOwner},
+		{name: "admin which is a guest", identity: types.Identity{Username: "calebwoodbine", Admin: true}, expected: InstanceRoleAdmin},
+		{name: "someone else", identity: types.Identity{Username: "zachmandeville"}, expected: InstanceRoleNone},
+		{name: "no username doesn't match an empty guest", identity: types.Identity{}, expected: InstanceRoleNone},
+		{name: "impersonated owner", identity: types.Identity{Username: "BobyMCbobs", Impersonator: "client"}, expected: InstanceRoleOwner},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role := GetInstanceRole(instance, tt.identity)
+			if role != tt.expected {
+				t.Errorf("expected role '%v', got '%v'", tt.expected, role)
+			}
+		})
+	}
+}
+
+func TestIdentityCanOnInstance(t *testing.T) {
+	instance := InstanceSpec{
+		Setup: types.SetupSpec{
+			User:   "BobyMCbobs",
+			Guests: []string{"calebwoodbine"},
+		},
+	}
+	identities := map[InstanceRole]types.Identity{
+		InstanceRoleNone:  {Username: "zachmandeville"},
+		InstanceRoleGuest: {Username: "calebwoodbine"},
+		InstanceRoleOwner: {Username: "BobyMCbobs"},
+		InstanceRoleAdmin: {Username: "hh", Admin: true},
+	}
+	adminOwner := types.Identity{Username: "BobyMCbobs", Admin: true}
+
+	tests := []struct {
+		action  InstanceAction
+		allowed map[InstanceRole]bool
+	}{
+		{
+			action:  InstanceActionRead,
+			allowed: map[InstanceRole]bool{InstanceRoleGuest: true, InstanceRoleOwner: true, InstanceRoleAdmin: true},
+		},
+		{
+			action:  InstanceActionAttach,
+			allowed: map[InstanceRole]bool{InstanceRoleGuest: true, InstanceRoleOwner: true, InstanceRoleAdmin: true},
+		},
+		{
+			action:  InstanceActionManage,
+			allowed: map[InstanceRole]bool{InstanceRoleOwner: true, InstanceRoleAdmin: true},
+		},
+		{
+			action:  InstanceActionDelete,
+			allowed: map[InstanceRole]bool{InstanceRoleOwner: true, InstanceRoleAdmin: true},
+		},
+		{
+			// NOTE only the owner may reveal secret env, not even admins which don't own it
+			action:  InstanceActionReveal,
+			allowed: map[InstanceRole]bool{InstanceRoleOwner: true},
+		},
+		{
+			action:  InstanceAction("Unknown"),
+			allowed: map[InstanceRole]bool{},
+		},
+	}
+	for _, tt := range tests {
+		for role, identity := range identities {
+			t.Run(string(tt.action)+"/"+string(role), func(t *testing.T) {
+				allowed := IdentityCanOnInstance(instance, identity, tt.action)
+				if allowed != tt.allowed[role] {
+					t.Errorf("expected '%v' to be allowed to '%v': %v, got %v", role, tt.action, tt.allowed[role], allowed)
+				}
+			})
+		}
+		t.Run(string(tt.action)+"/AdminOwner", func(t *testing.T) {
+			// admins which own the instance may take every action of both roles
+			expected := tt.allowed[InstanceRoleOwner] || tt.allowed[InstanceRoleAdmin]
+			allowed := IdentityCanOnInstance(instance, adminOwner, tt.action)
+			if allowed != expected {
+				t.Errorf("expected an admin owner to be allowed to '%v': %v, got %v", tt.action, expected, allowed)
+			}
+		})
+	}
+}
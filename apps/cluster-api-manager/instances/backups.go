@@ -0,0 +1,320 @@
+package instances
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// HomeBackup ...
+// an archive of the home directory of an instance's Environment, kept in object storage after the instance is deleted
+// swagger:response backup
+type HomeBackup struct {
+	// Name is the instance and when it was backed up, such as bobymcbobs-exjk-20220601T120000Z
+	Name      string    `json:"name"`
+	User      string    `json:"user"`
+	Instance  string    `json:"instance"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// HomeBackupArchive ...
+// the gzipped tar of the home directory in a backup
+// swagger:response backupArchive
+type HomeBackupArchive struct {
+	// in: body
+	Body []byte
+}
+
+// HomeBackupNotFoundError ...
+// a backup which doesn't exist
+type HomeBackupNotFoundError struct {
+	Name string
+}
+
+func (e HomeBackupNotFoundError) Error() string {
+	return fmt.Sprintf("Backup '%v' not found", e.Name)
+}
+
+// misc backup vars
+var (
+	// instanceHomeBackedUpAtAnnotation is when the home directory of an instance was last backed up, on it's Cluster
+	instanceHomeBackedUpAtAnnotation = "io.sharing.pair-homeBackedUpAt"
+	// homeBackupTimeFormat is the time in the name of a backup
+	homeBackupTimeFormat = "20060102T150405Z"
+	// homeBackupNamePattern is the names of backups, as an instance name and when it was backed up
+	homeBackupNamePattern              = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?)-([0-9]{8}T[0-9]{6}Z)$`)
+	instanceDefaultBackupIntervalHours = 24
+	instanceDefaultBackupRetention     = 7
+)
+
+// GetBackupInterval ...
+// get how often the home directory of each instance is backed up, where zero only backs up on delete
+func GetBackupInterval() time.Duration {
+	hours, err := strconv.Atoi(common.GetEnvOrDefault("APP_BACKUP_INTERVAL_HOURS", strconv.Itoa(instanceDefaultBackupIntervalHours)))
+	if err != nil || hours < 0 {
+		hours = instanceDefaultBackupIntervalHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// GetBackupRetention ...
+// get how many backups of each instance are kept, removing the oldest
+func GetBackupRetention() int {
+	retention, err := strconv.Atoi(common.GetEnvOrDefault("APP_BACKUP_RETENTION", strconv.Itoa(instanceDefaultBackupRetention)))
+	if err != nil || retention < 1 {
+		retention = instanceDefaultBackupRetention
+	}
+	return retention
+}
+
+// homeBackupKey ...
+// returns the key of a backup of a user in object storage
+func homeBackupKey(user string, name string) string {
+	return strings.ToLower(user) + "/" + name + ".tar.gz"
+}
+
+// homeBackupFromObject ...
+// returns the backup of an object in object storage, or false if it isn't one
+func homeBackupFromObject(object common.ObjectStorageObject) (backup HomeBackup, ok bool) {
+	split := strings.SplitN(object.Key, "/", 2)
+	if len(split) != 2 || strings.HasSuffix(split[1], ".tar.gz") != true {
+		return HomeBackup{}, false
+	}
+	name := strings.TrimSuffix(split[1], ".tar.gz")
+	match := homeBackupNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return HomeBackup{}, false
+	}
+	createdAt, err := time.Parse(homeBackupTimeFormat, match[3])
+	if err != nil {
+		return HomeBackup{}, false
+	}
+	return HomeBackup{
+		Name:      name,
+		User:      split[0],
+		Instance:  match[1],
+		Size:      object.Size,
+		CreatedAt: createdAt,
+	}, true
+}
+
+// ListHomeBackups ...
+// returns the backups of a user, newest first
+func ListHomeBackups(user string) (backups []HomeBackup, err error) {
+	if common.ObjectStorageEnabled() != true {
+		return nil, fmt.Errorf("Backups are not configured")
+	}
+	objects, err := common.ObjectStorageList(strings.ToLower(user) + "/")
+	if err != nil {
+		return nil, err
+	}
+	backups = []HomeBackup{}
+	for _, object := range objects {
+		if backup, ok := homeBackupFromObject(object); ok == true {
+			backups = append(backups, backup)
+		}
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// GetHomeBackup ...
+// returns the archive of a backup of a user
+func GetHomeBackup(user string, name string) (archive []byte, err error) {
+	if common.ObjectStorageEnabled() != true {
+		return nil, fmt.Errorf("Backups are not configured")
+	}
+	if homeBackupNamePattern.MatchString(name) != true {
+		return nil, HomeBackupNotFoundError{Name: name}
+	}
+	archive, err = common.ObjectStorageGet(homeBackupKey(user, name))
+	if _, notFound := err.(common.ObjectStorageNotFoundError); notFound == true {
+		return nil, HomeBackupNotFoundError{Name: name}
+	}
+	return archive, err
+}
+
+// DeleteHomeBackup ...
+// delete a backup of a user
+func DeleteHomeBackup(user string, name string) (err error) {
+	if common.ObjectStorageEnabled() != true {
+		return fmt.Errorf("Backups are not configured")
+	}
+	if homeBackupNamePattern.MatchString(name) != true {
+		return HomeBackupNotFoundError{Name: name}
+	}
+	backups, err := ListHomeBackups(user)
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups {
+		if backup.Name == name {
+			return common.ObjectStorageDelete(homeBackupKey(user, name))
+		}
+	}
+	return HomeBackupNotFoundError{Name: name}
+}
+
+// validateRestoreBackup ...
+// returns an error if an instance restores from a backup which it's user doesn't have
+func validateRestoreBackup(instance InstanceSpec) (err error) {
+	if instance.Setup.RestoreBackup == "" {
+		return nil
+	}
+	if instance.Type != InstanceTypeKubernetes {
+		return fmt.Errorf("Only Kubernetes instances may restore from a backup")
+	}
+	backups, err := ListHomeBackups(instance.Setup.User)
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups {
+		if backup.Name == instance.Setup.RestoreBackup {
+			return nil
+		}
+	}
+	return HomeBackupNotFoundError{Name: instance.Setup.RestoreBackup}
+}
+
+// storeHomeBackup ...
+// store an archive of the home directory of an instance as a new backup of it's user, removing it's oldest backups beyond the retention
+func storeHomeBackup(instance InstanceSpec, archive []byte) (backup HomeBackup, err error) {
+	now := time.Now().UTC()
+	backup = HomeBackup{
+		Name:      instance.Name + "-" + now.Format(homeBackupTimeFormat),
+		User:      strings.ToLower(instance.Setup.User),
+		Instance:  instance.Name,
+		Size:      int64(len(archive)),
+		CreatedAt: now,
+	}
+	err = common.ObjectStoragePut(homeBackupKey(instance.Setup.User, backup.Name), archive)
+	if err != nil {
+		return HomeBackup{}, err
+	}
+	log.Printf("Backed up %v byte home directory of instance '%v' as '%v'\n", len(archive), instance.Name, backup.Name)
+
+	backups, err := ListHomeBackups(instance.Setup.User)
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return backup, nil
+	}
+	kept := 0
+	for _, existing := range backups {
+		if existing.Instance != instance.Name {
+			continue
+		}
+		kept++
+		if kept <= GetBackupRetention() {
+			continue
+		}
+		err = common.ObjectStorageDelete(homeBackupKey(instance.Setup.User, existing.Name))
+		if err != nil {
+			log.Printf("%#v\n", err)
+			continue
+		}
+		log.Printf("Removed backup '%v' beyond the retention of instance '%v'\n", existing.Name, instance.Name)
+	}
+	return backup, nil
+}
+
+// KubernetesBackupHome ...
+// back up the home directory of a Kubernetes instance's Environment, or of it's snapshot while it's hibernated
+func KubernetesBackupHome(name string, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) (backup HomeBackup, err error) {
+	if common.ObjectStorageEnabled() != true {
+		return HomeBackup{}, fmt.Errorf("Backups are not configured")
+	}
+	instance, err := GetSpec(name, dynamicClient)
+	if err != nil {
+		return HomeBackup{}, err
+	}
+	if instance.Name == "" {
+		return HomeBackup{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+	hibernated, err := KubernetesIsHibernated(name, dynamicClient)
+	if err != nil {
+		return HomeBackup{}, err
+	}
+	var archive []byte
+	if hibernated == true {
+		archive, err = kubernetesGetHomeSnapshot(clientset, name)
+		if err != nil {
+			return HomeBackup{}, err
+		}
+		if archive == nil {
+			return HomeBackup{}, fmt.Errorf("Hibernated instance '%v' has no home directory snapshot", name)
+		}
+	} else {
+		err = KubernetesGetInstanceEnvironmentPodReadiness(clientset, name, instance.Setup.UserLowercase)
+		if err != nil {
+			return HomeBackup{}, InstanceUpdateInvalidError{Reason: fmt.Sprintf("Unable to back up, %v", err.Error())}
+		}
+		archive, err = kubernetesArchiveHome(clientset, instance)
+		if err != nil {
+			return HomeBackup{}, err
+		}
+	}
+	backup, err = storeHomeBackup(instance, archive)
+	if err != nil {
+		return HomeBackup{}, err
+	}
+	err = setResourceAnnotation(dynamicClient, clusterAPIv1beta1.GroupVersion.WithResource("clusters"), name, instanceHomeBackedUpAtAnnotation, backup.CreatedAt.Format(time.RFC3339))
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+	}
+	return backup, nil
+}
+
+// KubernetesBackupHomeIfDue ...
+// back up the home directory of a running Kubernetes instance, once the backup interval has passed since it's last backup.
+// Returns nil when backups aren't configured, the instance isn't due or it's Environment isn't ready yet
+func KubernetesBackupHomeIfDue(name string, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) (backup *HomeBackup, err error) {
+	interval := GetBackupInterval()
+	if common.ObjectStorageEnabled() != true || interval == 0 {
+		return nil, nil
+	}
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	cluster, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(common.GetTargetNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return nil, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+	if cluster.GetAnnotations()[instanceHibernatedAtAnnotation] != "" {
+		return nil, nil
+	}
+	// NOTE instances are first backed up an interval after they're created
+	lastBackedUpAt := cluster.GetCreationTimestamp().Time
+	if backedUpAt, err := time.Parse(time.RFC3339, cluster.GetAnnotations()[instanceHomeBackedUpAtAnnotation]); err == nil {
+		lastBackedUpAt = backedUpAt
+	}
+	if time.Since(lastBackedUpAt) < interval {
+		return nil, nil
+	}
+	instance, err := GetInstanceSpecOfCluster(cluster, dynamicClient)
+	if err != nil {
+		return nil, err
+	}
+	if KubernetesGetInstanceEnvironmentPodReadiness(clientset, name, instance.Setup.UserLowercase) != nil {
+		return nil, nil
+	}
+	created, err := KubernetesBackupHome(name, clientset, dynamicClient)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
@@ -0,0 +1,253 @@
+package instances
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+)
+
+// CatalogEntry ...
+// a value which may be chosen for an instance
+type CatalogEntry struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// AdminOnly entries may only be chosen by admins
+	AdminOnly bool `json:"adminOnly,omitempty"`
+	// Groups limit the entry to members of any of them, and admins
+	Groups []string `json:"groups,omitempty"`
+	// Available is if the entry may be chosen by the caller
+	Available bool `json:"available"`
+}
+
+// CatalogCategory ...
+// the values which may be chosen for a field of an instance.
+// A category without options accepts any value
+type CatalogCategory struct {
+	Default string         `json:"default"`
+	Options []CatalogEntry `json:"options"`
+}
+
+// Catalog ...
+// the node sizes, OS images, facilities and versions which instances may use
+// swagger:response catalog
+type Catalog struct {
+	NodeSizes           CatalogCategory `json:"nodeSizes"`
+	NodeOSes            CatalogCategory `json:"nodeOSes"`
+	Facilities          CatalogCategory `json:"facilities"`
+	KubernetesVersions  CatalogCategory `json:"kubernetesVersions"`
+	EnvironmentVersions CatalogCategory `json:"environmentVersions"`
+}
+
+// catalogFieldNames ...
+// the fields of an instance which are chosen from the catalog
+var catalogFieldNames = []string{"nodeSize", "nodeOS", "facility", "setup.kubernetesVersion", "setup.environmentVersion"}
+
+// catalogEntries ...
+// returns entries for names
+func catalogEntries(names ...string) (entries []CatalogEntry) {
+	for _, name := range names {
+		entries = append(entries, CatalogEntry{Name: name})
+	}
+	return entries
+}
+
+// defaultCatalog ...
+// returns the catalog for the infrastructure provider, when APP_CATALOG doesn't declare a category
+func defaultCatalog() Catalog {
+	catalog := Catalog{
+		NodeSizes:           CatalogCategory{Default: GetInstanceDefaultNodeSize()},
+		NodeOSes:            CatalogCategory{Default: GetInstanceDefaultNodeOS()},
+		KubernetesVersions:  CatalogCategory{Default: GetKubernetesVersion(), Options: catalogEntries(instanceDefaultKubernetesVersions...)},
+		EnvironmentVersions: CatalogCategory{Default: GetEnvironmentVersion(), Options: catalogEntries(instanceDefaultEnvironmentVersion)},
+	}
+	// NOTE the Docker provider doesn't use node sizes, OS images or facilities, so any are accepted
+	if GetInfrastructureProvider().Name() == (PacketProvider{}).Name() {
+		catalog.NodeSizes.Options = append(catalogEntries(instanceDefaultNodeSize, "c3.medium.x86", "m3.small.x86"),
+			CatalogEntry{Name: "m3.large.x86", AdminOnly: true},
+			CatalogEntry{Name: "n3.xlarge.x86", AdminOnly: true},
+		)
+		catalog.NodeOSes.Options = catalogEntries(instanceDefaultNodeOS)
+		catalog.Facilities.Options = catalogEntries("sv15", "sjc1", "da11", "dc13", "ny5", "am6", "any")
+	}
+	return catalog
+}
+
+// withDefault ...
+// returns a category with it's default as an option, so that a configured default is always valid
+func (c CatalogCategory) withDefault() CatalogCategory {
+	if c.Default == "" || len(c.Options) == 0 || c.Find(c.Default) != nil {
+		return c
+	}
+	c.Options = append([]CatalogEntry{{Name: c.Default}}, c.Options...)
+	return c
+}
+
+// GetCatalog ...
+// returns the catalog, from the categories declared as JSON in APP_CATALOG and the defaults for the rest
+func GetCatalog() (catalog Catalog) {
+	catalog = defaultCatalog()
+	if declared := common.GetEnvOrDefault("APP_CATALOG", ""); declared != "" {
+		configured := Catalog{}
+		err := json.Unmarshal([]byte(declared), &configured)
+		if err != nil {
+			log.Printf("Failed to parse APP_CATALOG, %v\n", err)
+		} else {
+			override := func(category *CatalogCategory, configured CatalogCategory) {
+				if configured.Default != "" || len(configured.Options) > 0 {
+					*category = configured
+				}
+			}
+			override(&catalog.NodeSizes, configured.NodeSizes)
+			override(&catalog.NodeOSes, configured.NodeOSes)
+			override(&catalog.Facilities, configured.Facilities)
+			override(&catalog.KubernetesVersions, configured.KubernetesVersions)
+			override(&catalog.EnvironmentVersions, configured.EnvironmentVersions)
+		}
+	}
+	catalog.NodeSizes = catalog.NodeSizes.withDefault()
+	catalog.NodeOSes = catalog.NodeOSes.withDefault()
+	catalog.Facilities = catalog.Facilities.withDefault()
+	catalog.KubernetesVersions = catalog.KubernetesVersions.withDefault()
+	catalog.EnvironmentVersions = catalog.EnvironmentVersions.withDefault()
+	return catalog
+}
+
+// Find ...
+// returns the entry of a name in the category, or nil if it doesn't have one
+func (c CatalogCategory) Find(name string) *CatalogEntry {
+	for i := range c.Options {
+		if c.Options[i].Name == name {
+			return &c.Options[i]
+		}
+	}
+	return nil
+}
+
+// IsAvailable ...
+// returns if an entry may be chosen by an admin or a member of groups
+func (e CatalogEntry) IsAvailable(admin bool, groups []string) bool {
+	if admin == true {
+		return true
+	}
+	if e.AdminOnly == true {
+		return false
+	}
+	if len(e.Groups) == 0 {
+		return true
+	}
+	for _, group := range groups {
+		for _, g := range e.Groups {
+			if group == g {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ForCaller ...
+// returns the catalog with the availability of each entry set for an admin or a member of groups
+func (c Catalog) ForCaller(admin bool, groups []string) Catalog {
+	forCaller := func(category CatalogCategory) CatalogCategory {
+		options := make([]CatalogEntry, 0, len(category.Options))
+		for _, entry := range category.Options {
+			entry.Available = entry.IsAvailable(admin, groups)
+			options = append(options, entry)
+		}
+		category.Options = options
+		return category
+	}
+	c.NodeSizes = forCaller(c.NodeSizes)
+	c.NodeOSes = forCaller(c.NodeOSes)
+	c.Facilities = forCaller(c.Facilities)
+	c.KubernetesVersions = forCaller(c.KubernetesVersions)
+	c.EnvironmentVersions = forCaller(c.EnvironmentVersions)
+	return c
+}
+
+// ApplyCatalogDefaults ...
+// returns an instance with the catalog defaults for the fields which aren't set
+func ApplyCatalogDefaults(instance InstanceSpec) InstanceSpec {
+	catalog := GetCatalog()
+	instance.NodeSize = common.ReturnValueOrDefault(instance.NodeSize, catalog.NodeSizes.Default)
+	instance.NodeOS = common.ReturnValueOrDefault(instance.NodeOS, catalog.NodeOSes.Default)
+	instance.Facility = common.ReturnValueOrDefault(instance.Facility, catalog.Facilities.Default)
+	instance.Setup.EnvironmentVersion = common.ReturnValueOrDefault(instance.Setup.EnvironmentVersion, catalog.EnvironmentVersions.Default)
+	if instance.Type == InstanceTypeKubernetes {
+		instance.Setup.KubernetesVersion = common.ReturnValueOrDefault(instance.Setup.KubernetesVersion, catalog.KubernetesVersions.Default)
+	}
+	return instance
+}
+
+// catalogFields ...
+// returns the fields of an instance which are chosen from the catalog, with their category, after defaults and env overrides
+func catalogFields(catalog Catalog, instance InstanceSpec) (names []string, fields map[string]string, categories map[string]CatalogCategory) {
+	instance = UpdateInstanceSpecIfEnvOverrides(instance)
+	fields = map[string]string{
+		"nodeSize":                 common.ReturnValueOrDefault(instance.NodeSize, catalog.NodeSizes.Default),
+		"nodeOS":                   common.ReturnValueOrDefault(instance.NodeOS, catalog.NodeOSes.Default),
+		"facility":                 common.ReturnValueOrDefault(instance.Facility, catalog.Facilities.Default),
+		"setup.environmentVersion": common.ReturnValueOrDefault(instance.Setup.EnvironmentVersion, catalog.EnvironmentVersions.Default),
+	}
+	categories = map[string]CatalogCategory{
+		"nodeSize":                 catalog.NodeSizes,
+		"nodeOS":                   catalog.NodeOSes,
+		"facility":                 catalog.Facilities,
+		"setup.environmentVersion": catalog.EnvironmentVersions,
+		"setup.kubernetesVersion":  catalog.KubernetesVersions,
+	}
+	if instance.Type == InstanceTypeKubernetes {
+		fields["setup.kubernetesVersion"] = common.ReturnValueOrDefault(instance.Setup.KubernetesVersion, catalog.KubernetesVersions.Default)
+	}
+	names = append(names, catalogFieldNames...)
+	for i, pool := range instance.WorkerPools {
+		poolFields := []struct{ field, value string }{{"nodeSize", pool.NodeSize}, {"nodeOS", pool.NodeOS}}
+		for _, poolField := range poolFields {
+			name := fmt.Sprintf("workerPools[%v].%v", i, poolField.field)
+			names = append(names, name)
+			fields[name] = poolField.value
+			categories[name] = categories[poolField.field]
+		}
+	}
+	return names, fields, categories
+}
+
+// ValidateInstanceCatalog ...
+// returns an error if a field of an instance isn't in the catalog
+func ValidateInstanceCatalog(instance InstanceSpec) (err error) {
+	names, fields, categories := catalogFields(GetCatalog(), instance)
+	invalid := []string{}
+	for _, field := range names {
+		value := fields[field]
+		if value == "" || len(categories[field].Options) == 0 {
+			continue
+		}
+		if categories[field].Find(value) == nil {
+			invalid = append(invalid, fmt.Sprintf("%v '%v'", field, value))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("Not in the catalog, %v", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// CheckCatalogAvailability ...
+// returns an error if a field of an instance is in the catalog, but not available to an admin or a member of groups
+func CheckCatalogAvailability(instance InstanceSpec, admin bool, groups []string) (err error) {
+	names, fields, categories := catalogFields(GetCatalog(), instance)
+	unavailable := []string{}
+	for _, field := range names {
+		entry := categories[field].Find(fields[field])
+		if entry != nil && entry.IsAvailable(admin, groups) != true {
+			unavailable = append(unavailable, fmt.Sprintf("%v '%v'", field, fields[field]))
+		}
+	}
+	if len(unavailable) > 0 {
+		return fmt.Errorf("Not available to you from the catalog, %v", strings.Join(unavailable, ", "))
+	}
+	return nil
+}
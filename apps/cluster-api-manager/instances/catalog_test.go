@@ -0,0 +1,185 @@
+package instances
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetCatalog(t *testing.T) {
+	names := func(category CatalogCategory) (names []string) {
+		for _, entry := range category.Options {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name                       string
+		catalog                    string
+		kubernetesVersion          string
+		expectedKubernetesDefault  string
+		expectedKubernetesVersions []string
+		expectedFacilities         []string
+	}{
+		{
+			name:                       "the defaults",
+			expectedKubernetesDefault:  "1.23.5",
+			expectedKubernetesVersions: []string{"1.22.8", "1.23.5", "1.23.6", "1.24.0"},
+			expectedFacilities:         []string{"sv15", "sjc1", "da11", "dc13", "ny5", "am6", "any"},
+		},
+		{
+			name:                       "a configured default version is always an option",
+			kubernetesVersion:          "1.21.0",
+			expectedKubernetesDefault:  "1.21.0",
+			expectedKubernetesVersions: []string{"1.21.0", "1.22.8", "1.23.5", "1.23.6", "1.24.0"},
+			expectedFacilities:         []string{"sv15", "sjc1", "da11", "dc13", "ny5", "am6", "any"},
+		},
+		{
+			name:                       "declared categories replace the defaults",
+			catalog:                    `{"kubernetesVersions":{"default":"1.24.0","options":[{"name":"1.24.0"},{"name":"1.24.1"}]}}`,
+			expectedKubernetesDefault:  "1.24.0",
+			expectedKubernetesVersions: []string{"1.24.0", "1.24.1"},
+			expectedFacilities:         []string{"sv15", "sjc1", "da11", "dc13", "ny5", "am6", "any"},
+		},
+		{
+			name:                       "declared defaults are added to the options",
+			catalog:                    `{"facilities":{"default":"sv15","options":[{"name":"da11"}]}}`,
+			expectedKubernetesDefault:  "1.23.5",
+			expectedKubernetesVersions: []string{"1.22.8", "1.23.5", "1.23.6", "1.24.0"},
+			expectedFacilities:         []string{"sv15", "da11"},
+		},
+		{
+			name:                       "an invalid catalog uses the defaults",
+			catalog:                    `{"facilities":`,
+			expectedKubernetesDefault:  "1.23.5",
+			expectedKubernetesVersions: []string{"1.22.8", "1.23.5", "1.23.6", "1.24.0"},
+			expectedFacilities:         []string{"sv15", "sjc1", "da11", "dc13", "ny5", "am6", "any"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_INFRASTRUCTURE_PROVIDER", "packet")
+			t.Setenv("APP_CATALOG", tt.catalog)
+			t.Setenv("APP_INSTANCE_KUBERNETES_VERSION", tt.kubernetesVersion)
+			catalog := GetCatalog()
+			if catalog.KubernetesVersions.Default != tt.expectedKubernetesDefault {
+				t.Errorf("expected default Kubernetes version '%v', got '%v'", tt.expectedKubernetesDefault, catalog.KubernetesVersions.Default)
+			}
+			if versions := names(catalog.KubernetesVersions); reflect.DeepEqual(versions, tt.expectedKubernetesVersions) != true {
+				t.Errorf("expected Kubernetes versions %v, got %v", tt.expectedKubernetesVersions, versions)
+			}
+			if facilities := names(catalog.Facilities); reflect.DeepEqual(facilities, tt.expectedFacilities) != true {
+				t.Errorf("expected facilities %v, got %v", tt.expectedFacilities, facilities)
+			}
+		})
+	}
+}
+
+func TestCatalogEntryIsAvailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    CatalogEntry
+		admin    bool
+		groups   []string
+		expected bool
+	}{
+		{name: "open to everyone", entry: CatalogEntry{Name: "c3.small.x86"}, expected: true},
+		{name: "admin only for a non-admin", entry: CatalogEntry{Name: "m3.large.x86", AdminOnly: true}, groups: []string{"ii"}, expected: false},
+		{name: "admin only for an admin", entry: CatalogEntry{Name: "m3.large.x86", AdminOnly: true}, admin: true, expected: true},
+		{name: "a member of a group", entry: CatalogEntry{Name: "c3.medium.x86", Groups: []string{"pair:teachers", "ii"}}, groups: []string{"ii"}, expected: true},
+		{name: "not a member of a group", entry: CatalogEntry{Name: "c3.medium.x86", Groups: []string{"pair:teachers"}}, groups: []string{"ii"}, expected: false},
+		{name: "without groups for an entry with groups", entry: CatalogEntry{Name: "c3.medium.x86", Groups: []string{"pair:teachers"}}, expected: false},
+		{name: "an admin for an entry with groups", entry: CatalogEntry{Name: "c3.medium.x86", Groups: []string{"pair:teachers"}}, admin: true, expected: true},
+		{name: "admin only with groups for a member", entry: CatalogEntry{Name: "n3.xlarge.x86", AdminOnly: true, Groups: []string{"ii"}}, groups: []string{"ii"}, expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			available := tt.entry.IsAvailable(tt.admin, tt.groups)
+			if available != tt.expected {
+				t.Errorf("expected available %v, got %v", tt.expected, available)
+			}
+		})
+	}
+}
+
+func TestCatalogForCaller(t *testing.T) {
+	catalog := Catalog{
+		NodeSizes: CatalogCategory{
+			Default: "c3.small.x86",
+			Options: []CatalogEntry{
+				{Name: "c3.small.x86"},
+				{Name: "m3.large.x86", AdminOnly: true},
+				{Name: "c3.medium.x86", Groups: []string{"pair:teachers"}},
+			},
+		},
+		KubernetesVersions: CatalogCategory{
+			Default: "1.23.5",
+			Options: []CatalogEntry{
+				{Name: "1.23.5"},
+				{Name: "1.24.0", Groups: []string{"pair:testers"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name                       string
+		admin                      bool
+		groups                     []string
+		expectedNodeSizes          []bool
+		expectedKubernetesVersions []bool
+	}{
+		{name: "a non-admin without groups", expectedNodeSizes: []bool{true, false, false}, expectedKubernetesVersions: []bool{true, false}},
+		{name: "a member of groups", groups: []string{"pair:teachers"}, expectedNodeSizes: []bool{true, false, true}, expectedKubernetesVersions: []bool{true, false}},
+		{name: "an admin", admin: true, expectedNodeSizes: []bool{true, true, true}, expectedKubernetesVersions: []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forCaller := catalog.ForCaller(tt.admin, tt.groups)
+			available := func(category CatalogCategory) (available []bool) {
+				for _, entry := range category.Options {
+					available = append(available, entry.Available)
+				}
+				return available
+			}
+			if nodeSizes := available(forCaller.NodeSizes); reflect.DeepEqual(nodeSizes, tt.expectedNodeSizes) != true {
+				t.Errorf("expected node sizes to be available %v, got %v", tt.expectedNodeSizes, nodeSizes)
+			}
+			if versions := available(forCaller.KubernetesVersions); reflect.DeepEqual(versions, tt.expectedKubernetesVersions) != true {
+				t.Errorf("expected Kubernetes versions to be available %v, got %v", tt.expectedKubernetesVersions, versions)
+			}
+			if forCaller.NodeSizes.Default != catalog.NodeSizes.Default || len(forCaller.Facilities.Options) != 0 {
+				t.Errorf("expected the rest of the catalog to be kept, got %#v", forCaller)
+			}
+		})
+	}
+	for _, entry := range catalog.NodeSizes.Options {
+		if entry.Available == true {
+			t.Errorf("expected the catalog not to be modified, got %#v", catalog.NodeSizes)
+		}
+	}
+}
+
+func TestValidateInstanceCatalog(t *testing.T) {
+	t.Setenv("APP_INFRASTRUCTURE_PROVIDER", "packet")
+	t.Setenv("APP_CATALOG", "")
+	t.Setenv("APP_INSTANCE_KUBERNETES_VERSION", "")
+
+	tests := []struct {
+		name     string
+		instance InstanceSpec
+		wantErr  bool
+	}{
+		{name: "the defaults", instance: InstanceSpec{Type: InstanceTypeKubernetes}},
+		{name: "values in the catalog", instance: InstanceSpec{Type: InstanceTypeKubernetes, NodeSize: "m3.large.x86", Facility: "da11"}},
+		{name: "a node size not in the catalog", instance: InstanceSpec{Type: InstanceTypeKubernetes, NodeSize: "t1.small.x86"}, wantErr: true},
+		{name: "a worker pool node size not in the catalog", instance: InstanceSpec{Type: InstanceTypeKubernetes, WorkerPools: []InstanceWorkerPool{{Name: "a", NodeSize: "t1.small.x86"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInstanceCatalog(tt.instance)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package instances
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// KubernetesCloneSpec ...
+// returns the spec for a new instance of user like a Kubernetes instance, with it's guests, repos, env, nodes, facility and versions.
+// The name, lifetime, GitHub token and backup of the instance aren't cloned, nor it's owner's name, emails and secret env for another user
+func KubernetesCloneSpec(name string, user string, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) (clone InstanceSpec, err error) {
+	instance, err := KubernetesGet(name, dynamicClient, clientset)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	if instance.Spec.Name == "" {
+		return InstanceSpec{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+	source := instance.Spec
+	clone = InstanceSpec{
+		Type:                InstanceTypeKubernetes,
+		NodeSize:            source.NodeSize,
+		NodeOS:              source.NodeOS,
+		KubernetesNodeCount: source.KubernetesNodeCount,
+		Facility:            source.Facility,
+		RegistryMirrors:     source.RegistryMirrors,
+		WorkerPools:         source.WorkerPools,
+	}
+	clone.Setup.User = user
+	clone.Setup.Guests = source.Setup.Guests
+	clone.Setup.Repos = source.Setup.Repos
+	clone.Setup.Env = withoutSecretEnv(source.Setup.Env)
+	clone.Setup.Timezone = source.Setup.Timezone
+	clone.Setup.KubernetesVersion = source.Setup.KubernetesVersion
+	clone.Setup.EnvironmentRepository = source.Setup.EnvironmentRepository
+	clone.Setup.EnvironmentVersion = source.Setup.EnvironmentVersion
+	if strings.EqualFold(source.Setup.User, user) == true {
+		clone.Setup.Fullname = source.Setup.Fullname
+		clone.Setup.Email = source.Setup.Email
+		clone.Setup.ExtraEmails = source.Setup.ExtraEmails
+		clone.Setup.Env, err = getSecretEnv(source, dynamicClient)
+		if err != nil {
+			return InstanceSpec{}, err
+		}
+	}
+	return clone, nil
+}
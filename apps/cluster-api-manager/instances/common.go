@@ -3,23 +3,36 @@ package instances
 import (
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
 	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
 )
 
 // misc default vars
 var (
-	instanceDefaultNodeSize              = "c3.small.x86"
-	instanceDefaultNodeOS                = "ubuntu_20_04"
-	instanceDefaultTimezone              = "Pacific/Auckland"
-	instanceDefaultEnvironmentRepository = "registry.gitlab.com/sharingio/environment/environment"
-	instanceDefaultEnvironmentVersion    = "2022.03.30.1618"
-	instanceDefaultKubernetesVersion     = "1.23.5"
+	instanceDefaultNodeSize               = "c3.small.x86"
+	instanceDefaultNodeOS                 = "ubuntu_20_04"
+	instanceDefaultTimezone               = "Pacific/Auckland"
+	instanceDefaultEnvironmentRepository  = "registry.gitlab.com/sharingio/environment/environment"
+	instanceDefaultEnvironmentVersion     = "2022.03.30.1618"
+	instanceDefaultKubernetesVersion      = "1.23.5"
+	instanceDefaultInfrastructureProvider = "packet"
+	instanceDefaultLifetimeHours          = 24
+	instanceDefaultMaxLifetimeHours       = 72
+	instanceDefaultAdminMaxLifetimeHours  = 720
+	instanceDefaultHomeSnapshotMaxMB      = 512
+	instanceDefaultMaxKubernetesNodeCount = 3
 )
 
+// instanceDefaultKubernetesVersions are those in the catalog when it's not configured, which instances may be created with or upgraded to
+var instanceDefaultKubernetesVersions = []string{"1.22.8", "1.23.5", "1.23.6", "1.24.0"}
+
 // GetEnvironmentRepository ...
 // get the container repository of where environment is
 func GetEnvironmentRepository() string {
@@ -50,6 +63,57 @@ func GetInstanceDefaultNodeSize() string {
 	return common.GetEnvOrDefault("APP_INSTANCE_NODE_SIZE", instanceDefaultNodeSize)
 }
 
+// GetInfrastructureProviderName ...
+// get the name of the infrastructure provider to create Kubernetes instances with
+func GetInfrastructureProviderName() string {
+	return common.GetEnvOrDefault("APP_INFRASTRUCTURE_PROVIDER", instanceDefaultInfrastructureProvider)
+}
+
+// getHoursFromEnvOrDefault ...
+// get a positive number of hours from an env, as a duration
+func getHoursFromEnvOrDefault(envName string, defaultHours int) time.Duration {
+	hours, err := strconv.Atoi(common.GetEnvOrDefault(envName, strconv.Itoa(defaultHours)))
+	if err != nil || hours < 1 {
+		hours = defaultHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// GetInstanceDefaultLifetime ...
+// get how long an instance lives for before it expires, when no lifetime is requested
+func GetInstanceDefaultLifetime() time.Duration {
+	return getHoursFromEnvOrDefault("APP_INSTANCE_DEFAULT_LIFETIME_HOURS", instanceDefaultLifetimeHours)
+}
+
+// GetInstanceMaxLifetime ...
+// get the longest an instance may live for from now, for admins or non-admins
+func GetInstanceMaxLifetime(admin bool) time.Duration {
+	if admin == true {
+		return getHoursFromEnvOrDefault("APP_INSTANCE_ADMIN_MAX_LIFETIME_HOURS", instanceDefaultAdminMaxLifetimeHours)
+	}
+	return getHoursFromEnvOrDefault("APP_INSTANCE_MAX_LIFETIME_HOURS", instanceDefaultMaxLifetimeHours)
+}
+
+// GetHomeSnapshotMaxBytes ...
+// get the largest home directory snapshot to store when hibernating an instance
+func GetHomeSnapshotMaxBytes() int {
+	maxMB, err := strconv.Atoi(common.GetEnvOrDefault("APP_HOME_SNAPSHOT_MAX_MB", strconv.Itoa(instanceDefaultHomeSnapshotMaxMB)))
+	if err != nil || maxMB < 1 {
+		maxMB = instanceDefaultHomeSnapshotMaxMB
+	}
+	return maxMB * 1024 * 1024
+}
+
+// GetInstanceMaxKubernetesNodeCount ...
+// get the most worker nodes a Kubernetes instance may have
+func GetInstanceMaxKubernetesNodeCount() int {
+	max, err := strconv.Atoi(common.GetEnvOrDefault("APP_INSTANCE_MAX_KUBERNETES_NODE_COUNT", strconv.Itoa(instanceDefaultMaxKubernetesNodeCount)))
+	if err != nil || max < 0 {
+		max = instanceDefaultMaxKubernetesNodeCount
+	}
+	return max
+}
+
 // GenerateName ...
 // given a username, append a 4 byte string to the end
 func GenerateName(instance InstanceSpec) (name string) {
@@ -95,3 +159,29 @@ func GetValueFromEnvSlice(input []map[string]string, key string) string {
 	}
 	return ""
 }
+
+// AddResource ...
+// adds an object to the rendered resources, as the kind given
+func (m *InstanceManifests) AddResource(obj interface{}, groupVersionKind schema.GroupVersionKind) (err error) {
+	asUnstructured, err := common.ObjectToUnstructured(obj)
+	if err != nil {
+		return fmt.Errorf("Failed to unstructure %v, %#v", groupVersionKind.Kind, err)
+	}
+	asUnstructured.SetGroupVersionKind(groupVersionKind)
+	m.Resources = append(m.Resources, asUnstructured.Object)
+	return nil
+}
+
+// YAML ...
+// returns the rendered resources as a multi-document YAML stream
+func (m InstanceManifests) YAML() (output string, err error) {
+	documents := []string{}
+	for _, resource := range m.Resources {
+		document, err := yaml.Marshal(resource)
+		if err != nil {
+			return "", fmt.Errorf("Failed to marshal resource as YAML, %#v", err)
+		}
+		documents = append(documents, string(document))
+	}
+	return strings.Join(documents, "---\n"), nil
+}
@@ -0,0 +1,95 @@
+package instances
+
+import (
+	"fmt"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clusterAPIPacketv1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
+	clusterAPIPacketv1beta1 "sigs.k8s.io/cluster-api-provider-packet/api/v1beta1"
+	clusterAPIv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	cabpkv1alpha3 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1alpha3"
+	cabpkv1beta1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1"
+	clusterAPIControlPlaneKubeadmv1alpha3 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
+	clusterAPIControlPlaneKubeadmv1beta1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// fallbackVersionOf ...
+// returns an empty object of the fallback version of a Cluster-API object
+func fallbackVersionOf(hub conversion.Hub) (fallback conversion.Convertible, err error) {
+	switch hub.(type) {
+	case *clusterAPIv1beta1.Cluster:
+		return &clusterAPIv1alpha3.Cluster{}, nil
+	case *clusterAPIv1beta1.Machine:
+		return &clusterAPIv1alpha3.Machine{}, nil
+	case *clusterAPIv1beta1.MachineDeployment:
+		return &clusterAPIv1alpha3.MachineDeployment{}, nil
+	case *clusterAPIControlPlaneKubeadmv1beta1.KubeadmControlPlane:
+		return &clusterAPIControlPlaneKubeadmv1alpha3.KubeadmControlPlane{}, nil
+	case *cabpkv1beta1.KubeadmConfig:
+		return &cabpkv1alpha3.KubeadmConfig{}, nil
+	case *cabpkv1beta1.KubeadmConfigTemplate:
+		return &cabpkv1alpha3.KubeadmConfigTemplate{}, nil
+	case *clusterAPIPacketv1beta1.PacketCluster:
+		return &clusterAPIPacketv1alpha3.PacketCluster{}, nil
+	case *clusterAPIPacketv1beta1.PacketMachine:
+		return &clusterAPIPacketv1alpha3.PacketMachine{}, nil
+	case *clusterAPIPacketv1beta1.PacketMachineTemplate:
+		return &clusterAPIPacketv1alpha3.PacketMachineTemplate{}, nil
+	}
+	return nil, fmt.Errorf("No %v version of %T", common.ClusterAPIVersionFallback, hub)
+}
+
+// servedAPIVersion ...
+// returns the apiVersion which the management cluster serves of a group, for references between objects
+func servedAPIVersion(groupVersion schema.GroupVersion) string {
+	return common.ClusterAPIServedResource(groupVersion.WithResource("")).GroupVersion().String()
+}
+
+// servedObject ...
+// returns an object converted to the version which the management cluster serves for it's group
+func servedObject(groupVersionResource schema.GroupVersionResource, object interface{}) (served interface{}, err error) {
+	hub, ok := object.(conversion.Hub)
+	if ok != true || common.ClusterAPIServedVersion(groupVersionResource.Group) == common.ClusterAPIVersion {
+		return object, nil
+	}
+	fallback, err := fallbackVersionOf(hub)
+	if err != nil {
+		return nil, err
+	}
+	err = fallback.ConvertFrom(hub)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to convert %T to %v, %v", hub, common.ClusterAPIVersionFallback, err)
+	}
+	return fallback, nil
+}
+
+// restructure ...
+// restructures a Cluster-API object of any served version into it's v1beta1 type
+func restructure(item *unstructured.Unstructured, into conversion.Hub) (err error) {
+	if item.GroupVersionKind().Version != common.ClusterAPIVersionFallback {
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, into)
+		if err != nil {
+			return fmt.Errorf("Failed to restructure %T", into)
+		}
+		return nil
+	}
+	fallback, err := fallbackVersionOf(into)
+	if err != nil {
+		return err
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, fallback)
+	if err != nil {
+		return fmt.Errorf("Failed to restructure %T", fallback)
+	}
+	err = fallback.ConvertTo(into)
+	if err != nil {
+		return fmt.Errorf("Failed to convert %T to %v, %v", fallback, common.ClusterAPIVersion, err)
+	}
+	return nil
+}
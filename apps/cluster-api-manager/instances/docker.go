@@ -0,0 +1,142 @@
+package instances
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// misc Docker provider vars
+var (
+	// dockerGroupVersion is the API of cluster-api-provider-docker
+	dockerGroupVersion = schema.GroupVersion{Group: "infrastructure.cluster.x-k8s.io", Version: common.ClusterAPIVersion}
+)
+
+// DockerProvider ...
+// provisions machines as containers next to the management cluster, with cluster-api-provider-docker (CAPD).
+// Useful for running Pair on a laptop or in CI, without an Equinix Metal account
+type DockerProvider struct{}
+
+// Name ...
+// returns the name which the provider is selected by
+func (p DockerProvider) Name() string {
+	return "docker"
+}
+
+// dockerObject ...
+// returns a CAPD object of a kind, which belongs to an instance
+func dockerObject(instance InstanceSpec, namespace string, kind string, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	item := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	item.SetGroupVersionKind(dockerGroupVersion.WithKind(kind))
+	item.SetName(name)
+	item.SetNamespace(namespace)
+	item.SetLabels(map[string]string{"io.sharing.pair": "instance"})
+	item.SetAnnotations(map[string]string{
+		"io.sharing.pair-spec-name":       instance.Name,
+		"io.sharing.pair-spec-setup-user": instance.Setup.User,
+	})
+	return item
+}
+
+// KubernetesInfrastructure ...
+// returns the DockerCluster and DockerMachineTemplates of a Kubernetes instance
+func (p DockerProvider) KubernetesInfrastructure(instance InstanceSpec, namespace string) (infrastructure KubernetesInfrastructure, err error) {
+	machineTemplateSpec := func() map[string]interface{} {
+		return map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{},
+			},
+		}
+	}
+	infrastructure.Cluster = instanceResource{
+		"DockerCluster", dockerGroupVersion.WithResource("dockerclusters"), "DockerCluster",
+		dockerObject(instance, namespace, "DockerCluster", instance.Name, map[string]interface{}{}),
+	}
+	infrastructure.MachineTemplate = instanceResource{
+		"DockerMachineTemplate", dockerGroupVersion.WithResource("dockermachinetemplates"), "DockerMachineTemplate",
+		dockerObject(instance, namespace, "DockerMachineTemplate", instance.Name+"-control-plane", machineTemplateSpec()),
+	}
+	// NOTE node sizes and OSes don't apply to containers, so pools only differ by their labels and taints
+	for _, pool := range InstanceWorkerPools(instance) {
+		infrastructure.MachineTemplateWorkers = append(infrastructure.MachineTemplateWorkers, instanceResource{
+			"DockerMachineTemplate worker-" + pool.Name, dockerGroupVersion.WithResource("dockermachinetemplates"), "DockerMachineTemplate",
+			dockerObject(instance, namespace, "DockerMachineTemplate", workerPoolResourceName(instance.Name, pool.Name), machineTemplateSpec()),
+		})
+	}
+	return infrastructure, nil
+}
+
+// KubernetesResourceQueries ...
+// returns how to find the DockerCluster, DockerMachineTemplates and DockerMachines of a Kubernetes instance
+func (p DockerProvider) KubernetesResourceQueries(instance InstanceSpec) (queries InfrastructureResourceQueries) {
+	return InfrastructureResourceQueries{
+		Cluster:          instanceResourceQuery{GroupVersionResource: dockerGroupVersion.WithResource("dockerclusters"), Name: instance.Name, Owned: true},
+		MachineTemplates: machineTemplateQueries(instance, dockerGroupVersion.WithResource("dockermachinetemplates")),
+		Machines:         instanceResourceQuery{GroupVersionResource: dockerGroupVersion.WithResource("dockermachines"), LabelSelector: "cluster.x-k8s.io/cluster-name=" + instance.Name},
+	}
+}
+
+// KubeletExtraArgs ...
+// returns the args for the kubelet, which runs inside of a container without eviction
+func (p DockerProvider) KubeletExtraArgs() map[string]string {
+	return map[string]string{
+		"cloud-provider": "external",
+		"eviction-hard":  "nodefs.available<0%,nodefs.inodesFree<0%,imagefs.available<0%",
+		"fail-swap-on":   "false",
+	}
+}
+
+// PreKubeadmCommands ...
+// returns the commands to run on a node before kubeadm
+func (p DockerProvider) PreKubeadmCommands(nodeType string) (commands []string, err error) {
+	return []string{}, nil
+}
+
+// PostKubeadmCommands ...
+// returns the commands to run on a node after kubeadm
+func (p DockerProvider) PostKubeadmCommands(nodeType string) (commands []string, err error) {
+	return []string{}, nil
+}
+
+// ListMachines ...
+// returns the DockerMachines matching a label selector
+func (p DockerProvider) ListMachines(dynamicClient dynamic.Interface, labelSelector string) (machines []InfrastructureMachine, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := dockerGroupVersion.WithResource("dockermachines")
+	items, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return machines, fmt.Errorf("Failed to list DockerMachines, %#v", err)
+	}
+	for _, item := range items.Items {
+		machine := InfrastructureMachine{
+			Name:        item.GetName(),
+			ClusterName: item.GetLabels()["cluster.x-k8s.io/cluster-name"],
+		}
+		machine.ProviderID, _, _ = unstructured.NestedString(item.Object, "spec", "providerID")
+		// provider IDs are formatted as 'docker:////NAME'
+		machine.UID = strings.TrimPrefix(machine.ProviderID, "docker:////")
+		machines = append(machines, machine)
+	}
+	return machines, nil
+}
+
+// MachineAddress ...
+// returns the first internal address of a machine, which is reachable from the Docker network
+func (p DockerProvider) MachineAddress(addresses clusterAPIv1beta1.MachineAddresses) (address string, err error) {
+	for _, machineAddress := range addresses {
+		if machineAddress.Type == clusterAPIv1beta1.MachineInternalIP && machineAddress.Address != "" {
+			return machineAddress.Address, nil
+		}
+	}
+	return "", fmt.Errorf("machine has no IP addresses")
+}
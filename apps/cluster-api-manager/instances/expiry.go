@@ -0,0 +1,65 @@
+package instances
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+// InstanceExpiry ...
+// returns when an instance should expire, given a lifetime from a time.
+// The lifetime is the default when not given, and no longer than the max for admins or non-admins
+func InstanceExpiry(from time.Time, lifetime time.Duration, admin bool) time.Time {
+	if lifetime <= 0 {
+		lifetime = GetInstanceDefaultLifetime()
+	}
+	if maxLifetime := GetInstanceMaxLifetime(admin); lifetime > maxLifetime {
+		lifetime = maxLifetime
+	}
+	return from.Add(lifetime).UTC().Truncate(time.Second)
+}
+
+// InstanceRemainingLifetime ...
+// returns how long an instance has until it expires, or an empty string if it doesn't expire
+func InstanceRemainingLifetime(instance InstanceSpec) string {
+	if instance.ExpiresAt == nil {
+		return ""
+	}
+	remaining := time.Until(instance.ExpiresAt.Time).Round(time.Minute)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining.String()
+}
+
+// Extend ...
+// extend the lifetime of an instance by a duration, up to the max lifetime from now
+func Extend(name string, lifetime time.Duration, admin bool, dynamicClient dynamic.Interface) (instanceUpdated InstanceSpec, err error) {
+	current, err := GetSpec(name, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	if current.Name == "" {
+		return InstanceSpec{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+
+	// extend from the current expiry, unless the instance never expired or already has
+	from := time.Now()
+	if current.ExpiresAt != nil && current.ExpiresAt.Time.After(from) {
+		from = current.ExpiresAt.Time
+	}
+	if lifetime <= 0 {
+		lifetime = GetInstanceDefaultLifetime()
+	}
+	expiresAt := from.Add(lifetime)
+	if maxExpiresAt := InstanceExpiry(time.Now(), GetInstanceMaxLifetime(admin), admin); expiresAt.After(maxExpiresAt) {
+		expiresAt = maxExpiresAt
+	}
+
+	instanceUpdated = current
+	instanceUpdated.ExpiresAt = &metav1.Time{Time: expiresAt.UTC().Truncate(time.Second)}
+	err = UpdatePairInstanceSpec(instanceUpdated, dynamicClient)
+	return instanceUpdated, err
+}
@@ -0,0 +1,515 @@
+package instances
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterAPIControlPlaneKubeadmv1beta1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
+)
+
+// annotations for hibernating and resuming instances
+const (
+	// instanceHibernatedAtAnnotation is when an instance was hibernated, on it's Cluster
+	instanceHibernatedAtAnnotation = "io.sharing.pair-hibernatedAt"
+	// instanceResumeAnnotation is when an instance was asked to resume, on it's PairInstance while it's Cluster is replaced
+	instanceResumeAnnotation = "io.sharing.pair-resume"
+	// instanceHomeRestoreAnnotation is on the Cluster of a resumed instance, until it's home directory is restored
+	instanceHomeRestoreAnnotation = "io.sharing.pair-homeRestore"
+)
+
+// misc hibernation vars
+var (
+	// homeSnapshotDirectory is the home directory of the Environment, which is kept while an instance is hibernated
+	homeSnapshotDirectory = "/home/ii"
+	// homeSnapshotKeyPrefix is where home directory snapshots are stored in object storage.
+	// GitHub usernames can't contain underscores, so snapshots are never listed as the backups of a user
+	homeSnapshotKeyPrefix = "_snapshots/"
+)
+
+// homeSnapshotKey ...
+// returns the key of the home directory snapshot of an instance in object storage
+func homeSnapshotKey(name string) string {
+	return homeSnapshotKeyPrefix + name + ".tar.gz"
+}
+
+// homeSnapshotLabelSelector ...
+// returns the labels of the Secrets which stored the home directory snapshot of an instance, before snapshots were stored in object storage
+func homeSnapshotLabelSelector(name string) string {
+	return "io.sharing.pair=home-snapshot,io.sharing.pair-spec-name=" + name
+}
+
+// kubernetesInstanceClients ...
+// returns a clientset and rest config for the cluster of a Kubernetes instance
+func kubernetesInstanceClients(clientset *kubernetes.Clientset, name string) (instanceClientset *kubernetes.Clientset, restConfig *rest.Config, err error) {
+	instanceKubeconfig, err := KubernetesGetKubeconfigBytes(name, clientset)
+	if err != nil {
+		return nil, nil, err
+	}
+	restConfig, err = clientcmd.RESTConfigFromKubeConfig(instanceKubeconfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	instanceClientset, err = KubernetesClientsetFromKubeconfigBytes(instanceKubeconfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return instanceClientset, restConfig, nil
+}
+
+// setResourceAnnotation ...
+// sets an annotation on a resource of an instance, removing it when the value is empty.
+// Returns a not found error as is, for the caller to decide if the resource is required
+func setResourceAnnotation(dynamicClient dynamic.Interface, groupVersionResource schema.GroupVersionResource, name string, key string, value string) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+	item, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return err
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to get %v '%v', %#v", groupVersionResource.Resource, name, err)
+	}
+	annotations := item.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if value == "" {
+		delete(annotations, key)
+	} else {
+		annotations[key] = value
+	}
+	item.SetAnnotations(annotations)
+	_, err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Update(context.TODO(), item, metav1.UpdateOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to update %v '%v', %#v", groupVersionResource.Resource, name, err)
+	}
+	return nil
+}
+
+// KubernetesIsHibernated ...
+// returns if a Kubernetes instance is hibernated
+func KubernetesIsHibernated(name string, dynamicClient dynamic.Interface) (hibernated bool, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	item, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return false, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+	return item.GetAnnotations()[instanceHibernatedAtAnnotation] != "", nil
+}
+
+// kubernetesArchiveHome ...
+// returns a gzipped tar of the home directory of an instance's Environment
+func kubernetesArchiveHome(clientset *kubernetes.Clientset, instance InstanceSpec) (archive []byte, err error) {
+	instanceClientset, restConfig, err := kubernetesInstanceClients(clientset, instance.Name)
+	if err != nil {
+		return nil, err
+	}
+	execOptions := ExecOptions{
+		// NOTE tar exits with 1 when files change while being read, which is expected of a running Environment
+		Command: []string{
+			"sh",
+			"-c",
+			fmt.Sprintf("tar -C %v --exclude=./.cache -czf - . ; [ $? -le 1 ]", homeSnapshotDirectory),
+		},
+		Namespace:          instance.Setup.UserLowercase,
+		PodName:            "environment-0",
+		ContainerName:      "environment",
+		CaptureStderr:      true,
+		CaptureStdout:      true,
+		PreserveWhitespace: true,
+		TTY:                false,
+	}
+	stdout, stderr, err := KubernetesExec(instanceClientset, restConfig, execOptions)
+	if err != nil {
+		log.Printf("%#v\n", stderr)
+		return nil, fmt.Errorf("Failed to archive home directory, %v", err)
+	}
+	return []byte(stdout), nil
+}
+
+// kubernetesSnapshotHome ...
+// store the home directory of an instance's Environment in object storage, replacing any previous snapshot
+func kubernetesSnapshotHome(clientset *kubernetes.Clientset, instance InstanceSpec) (err error) {
+	snapshot, err := kubernetesArchiveHome(clientset, instance)
+	if err != nil {
+		return err
+	}
+	if len(snapshot) > GetHomeSnapshotMaxBytes() {
+		return fmt.Errorf("Home directory snapshot is %vMB, larger than the max of %vMB", len(snapshot)/1024/1024, GetHomeSnapshotMaxBytes()/1024/1024)
+	}
+	err = common.ObjectStoragePut(homeSnapshotKey(instance.Name), snapshot)
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to store home directory snapshot, %v", err)
+	}
+	log.Printf("Stored %v byte home directory snapshot of instance '%v'\n", len(snapshot), instance.Name)
+	return nil
+}
+
+// kubernetesGetLegacyHomeSnapshot ...
+// returns the home directory snapshot of an instance which was hibernated when snapshots were stored in Secrets, or nil if it has none
+func kubernetesGetLegacyHomeSnapshot(clientset *kubernetes.Clientset, name string) (snapshot []byte, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	secrets, err := clientset.CoreV1().Secrets(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: homeSnapshotLabelSelector(name)})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return nil, fmt.Errorf("Failed to list home directory snapshot, %#v", err)
+	}
+	if len(secrets.Items) == 0 {
+		return nil, nil
+	}
+	part := func(secret corev1.Secret) int {
+		index, _ := strconv.Atoi(secret.ObjectMeta.Annotations["io.sharing.pair-home-snapshot-part"])
+		return index
+	}
+	sort.Slice(secrets.Items, func(i, j int) bool {
+		return part(secrets.Items[i]) < part(secrets.Items[j])
+	})
+	if parts, _ := strconv.Atoi(secrets.Items[0].ObjectMeta.Annotations["io.sharing.pair-home-snapshot-parts"]); parts != len(secrets.Items) {
+		return nil, fmt.Errorf("Home directory snapshot has %v of %v parts", len(secrets.Items), parts)
+	}
+	for _, secret := range secrets.Items {
+		snapshot = append(snapshot, secret.Data["home.tar.gz"]...)
+	}
+	return snapshot, nil
+}
+
+// kubernetesGetHomeSnapshot ...
+// returns the stored home directory snapshot of an instance, or nil if it has none
+func kubernetesGetHomeSnapshot(clientset *kubernetes.Clientset, name string) (snapshot []byte, err error) {
+	snapshot, err = kubernetesGetLegacyHomeSnapshot(clientset, name)
+	if err != nil || snapshot != nil {
+		return snapshot, err
+	}
+	// NOTE without object storage a snapshot can't be found, which mustn't be mistaken for not having one
+	if common.ObjectStorageEnabled() != true {
+		return nil, fmt.Errorf("Unable to get home directory snapshot of instance '%v', object storage is not configured", name)
+	}
+	snapshot, err = common.ObjectStorageGet(homeSnapshotKey(name))
+	if _, notFound := err.(common.ObjectStorageNotFoundError); notFound == true {
+		return nil, nil
+	}
+	return snapshot, err
+}
+
+// deleteHomeSnapshot ...
+// delete the home directory snapshot of an instance, wherever it's stored
+func deleteHomeSnapshot(dynamicClient dynamic.Interface, name string) (err error) {
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("secrets")
+	err = dynamicClient.Resource(groupVersionResource).Namespace(common.GetTargetNamespace()).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: homeSnapshotLabelSelector(name)})
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to delete home directory snapshot, %#v", err)
+	}
+	if common.ObjectStorageEnabled() != true {
+		return nil
+	}
+	err = common.ObjectStorageDelete(homeSnapshotKey(name))
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to delete home directory snapshot, %v", err)
+	}
+	return nil
+}
+
+// KubernetesHibernate ...
+// snapshot the home directory of a Kubernetes instance and release it's machines,
+// keeping it's spec, DNS names and cached TLS cert to resume with
+func KubernetesHibernate(name string, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) (instance InstanceSpec, err error) {
+	if common.ObjectStorageEnabled() != true {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: "Unable to hibernate, object storage for home directory snapshots is not configured"}
+	}
+	targetNamespace := common.GetTargetNamespace()
+	instance, err = GetSpec(name, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	if instance.Name == "" {
+		return InstanceSpec{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+	hibernated, err := KubernetesIsHibernated(name, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	if hibernated == true {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: "Instance is already hibernated"}
+	}
+	err = KubernetesGetInstanceEnvironmentPodReadiness(clientset, name, instance.Setup.UserLowercase)
+	if err != nil {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: fmt.Sprintf("Unable to hibernate, %v", err.Error())}
+	}
+
+	err = kubernetesSnapshotHome(clientset, instance)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+
+	//   - newInstance.WorkerPools MachineDeployments
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("machinedeployments")
+	for _, pool := range InstanceWorkerPools(instance) {
+		item, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), workerPoolResourceName(name, pool.Name), metav1.GetOptions{})
+		if err != nil {
+			log.Printf("%#v\n", err)
+			return InstanceSpec{}, fmt.Errorf("Failed to get MachineDeployment of worker pool '%v', %#v", pool.Name, err)
+		}
+		err = unstructured.SetNestedField(item.Object, int64(0), "spec", "replicas")
+		if err != nil {
+			return InstanceSpec{}, fmt.Errorf("Failed to set MachineDeployment replicas, %#v", err)
+		}
+		_, err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Update(context.TODO(), item, metav1.UpdateOptions{})
+		if err != nil {
+			log.Printf("%#v\n", err)
+			return InstanceSpec{}, fmt.Errorf("Failed to update MachineDeployment of worker pool '%v', %#v", pool.Name, err)
+		}
+	}
+
+	//   - newInstance.KubeadmControlPlane
+	// NOTE the control plane can't be scaled to zero, so it's paused to not replace it's machines once they're deleted
+	err = setResourceAnnotation(dynamicClient, clusterAPIControlPlaneKubeadmv1beta1.GroupVersion.WithResource("kubeadmcontrolplanes"), name+"-control-plane", clusterAPIv1beta1.PausedAnnotation, "true")
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+
+	//   - newInstance.Machine
+	groupVersionResource = clusterAPIv1beta1.GroupVersion.WithResource("machines")
+	err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/control-plane,cluster.x-k8s.io/cluster-name=" + name})
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+		return InstanceSpec{}, fmt.Errorf("Failed to delete control plane Machines, %#v", err)
+	}
+
+	err = RecordInstanceUsage(name, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+
+	//   - newInstance.Cluster
+	err = setResourceAnnotation(dynamicClient, clusterAPIv1beta1.GroupVersion.WithResource("clusters"), name, instanceHibernatedAtAnnotation, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	err = UpdatePairInstanceStatus(name, InstanceStatus{Phase: InstanceStatusPhaseHibernated}, dynamicClient)
+	if err != nil {
+		log.Printf("%#v\n", err)
+	}
+	log.Printf("Hibernated instance '%v'\n", name)
+	return instance, nil
+}
+
+// kubernetesRetainedResourceQueries ...
+// returns how to find the resources of a hibernated Kubernetes instance which are kept while it's Cluster is replaced
+func kubernetesRetainedResourceQueries(name string) []instanceResourceQuery {
+	return []instanceResourceQuery{
+		{GroupVersionResource: PairInstanceGroupVersionResource, Name: name},
+		{GroupVersionResource: corev1.SchemeGroupVersion.WithResource("secrets"), Name: name + "-tls"},
+		{GroupVersionResource: corev1.SchemeGroupVersion.WithResource("secrets"), Name: setupSecretName(name)},
+		{GroupVersionResource: schema.GroupVersionResource{Version: "v1alpha1", Group: "externaldns.k8s.io", Resource: "dnsendpoints"}, LabelSelector: "io.sharing.pair-spec-name=" + name},
+	}
+}
+
+// KubernetesResume ...
+// reprovision a hibernated Kubernetes instance from it's stored spec.
+// The Cluster of the hibernated instance is deleted first, then the instance is recreated
+// when resume is called again once the Cluster is gone. The home directory is restored by KubernetesRestoreHome
+func KubernetesResume(name string, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) (instance InstanceSpec, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	cluster, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+		return InstanceSpec{}, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+
+	if err == nil {
+		if cluster.GetAnnotations()[instanceHibernatedAtAnnotation] == "" {
+			return InstanceSpec{}, InstanceUpdateInvalidError{Reason: "Instance is not hibernated"}
+		}
+		if cluster.GetDeletionTimestamp() != nil {
+			return GetInstanceSpecOfCluster(cluster, dynamicClient)
+		}
+		instance, err = GetInstanceSpecOfCluster(cluster, dynamicClient)
+		if err != nil {
+			return InstanceSpec{}, err
+		}
+		ownerReference := common.ClusterOwnerReference(cluster)
+		for _, query := range kubernetesRetainedResourceQueries(name) {
+			items, err := getInstanceResources(dynamicClient, query)
+			if err != nil {
+				return InstanceSpec{}, err
+			}
+			for i := range items {
+				item := &items[i]
+				if common.RemoveOwnerReference(item, ownerReference) != true {
+					continue
+				}
+				_, err = dynamicClient.Resource(common.ClusterAPIServedResource(query.GroupVersionResource)).Namespace(targetNamespace).Update(context.TODO(), item, metav1.UpdateOptions{})
+				if err != nil {
+					log.Printf("%#v\n", err)
+					return InstanceSpec{}, fmt.Errorf("Failed to keep %v '%v', %#v", item.GetKind(), item.GetName(), err)
+				}
+			}
+		}
+		err = setResourceAnnotation(dynamicClient, PairInstanceGroupVersionResource, name, instanceResumeAnnotation, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return InstanceSpec{}, err
+		}
+		err = UpdatePairInstanceStatus(name, InstanceStatus{Phase: InstanceStatusPhasePending}, dynamicClient)
+		if err != nil {
+			log.Printf("%#v\n", err)
+		}
+		// the paused control plane must be unpaused to be deleted with it's Cluster
+		err = setResourceAnnotation(dynamicClient, clusterAPIControlPlaneKubeadmv1beta1.GroupVersion.WithResource("kubeadmcontrolplanes"), name+"-control-plane", clusterAPIv1beta1.PausedAnnotation, "")
+		if err != nil && apierrors.IsNotFound(err) != true {
+			return InstanceSpec{}, err
+		}
+		err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		if err != nil && apierrors.IsNotFound(err) != true {
+			log.Printf("%#v\n", err)
+			return InstanceSpec{}, fmt.Errorf("Failed to delete Cluster, %#v", err)
+		}
+		log.Printf("Replacing the Cluster of hibernated instance '%v'\n", name)
+		return instance, nil
+	}
+
+	pairInstance, err := GetPairInstance(name, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	if pairInstance == nil || pairInstance.ObjectMeta.Annotations[instanceResumeAnnotation] == "" {
+		return InstanceSpec{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+	instance = pairInstance.Spec
+	newInstance, err := KubernetesTemplateResources(instance, targetNamespace)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	snapshot, err := kubernetesGetHomeSnapshot(clientset, name)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	if snapshot != nil {
+		newInstance.Cluster.ObjectMeta.Annotations[instanceHomeRestoreAnnotation] = pairInstance.ObjectMeta.Annotations[instanceResumeAnnotation]
+	}
+	// NOTE the setup Secret is kept while hibernated, so the replaced Cluster is delivered the same GitHub OAuth token
+	err = upsertSetupSecret(dynamicClient, instance)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	err = createInstanceResources(dynamicClient, targetNamespace, KubernetesInstanceResources(newInstance))
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	cluster, err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return InstanceSpec{}, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+	err = adoptInstanceResources(dynamicClient, cluster, instance)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	err = setResourceAnnotation(dynamicClient, PairInstanceGroupVersionResource, name, instanceResumeAnnotation, "")
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	log.Printf("Resumed instance '%v'\n", name)
+	return instance, nil
+}
+
+// KubernetesRestoreHome ...
+// restore the home directory snapshot of a resumed Kubernetes instance, or the backup of a new one, once it's Environment is ready.
+// Returns false when the instance has nothing to restore
+func KubernetesRestoreHome(name string, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) (restored bool, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	cluster, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return false, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+	if cluster.GetAnnotations()[instanceHomeRestoreAnnotation] == "" {
+		return false, nil
+	}
+	instance, err := GetInstanceSpecOfCluster(cluster, dynamicClient)
+	if err != nil {
+		return false, err
+	}
+	err = KubernetesGetInstanceEnvironmentPodReadiness(clientset, name, instance.Setup.UserLowercase)
+	if err != nil {
+		return false, err
+	}
+	snapshot, err := kubernetesGetHomeSnapshot(clientset, name)
+	if err != nil {
+		return false, err
+	}
+	// NOTE a new instance restores from the backup it was created with, where a resumed one has a snapshot
+	fromBackup := false
+	if snapshot == nil && instance.Setup.RestoreBackup != "" {
+		snapshot, err = GetHomeBackup(instance.Setup.User, instance.Setup.RestoreBackup)
+		if err != nil {
+			return false, err
+		}
+		fromBackup = true
+	}
+
+	if snapshot != nil {
+		instanceClientset, restConfig, err := kubernetesInstanceClients(clientset, name)
+		if err != nil {
+			return false, err
+		}
+		execOptions := ExecOptions{
+			Command: []string{
+				"tar",
+				"-C",
+				homeSnapshotDirectory,
+				"-xzf",
+				"-",
+			},
+			Namespace:     instance.Setup.UserLowercase,
+			PodName:       "environment-0",
+			ContainerName: "environment",
+			Stdin:         bytes.NewReader(snapshot),
+			CaptureStderr: true,
+			CaptureStdout: true,
+			TTY:           false,
+		}
+		_, stderr, err := KubernetesExec(instanceClientset, restConfig, execOptions)
+		if err != nil {
+			log.Printf("%#v\n", stderr)
+			return false, fmt.Errorf("Failed to restore home directory, %v", err)
+		}
+		if fromBackup != true {
+			err = deleteHomeSnapshot(dynamicClient, name)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	err = setResourceAnnotation(dynamicClient, groupVersionResource, name, instanceHomeRestoreAnnotation, "")
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Restored home directory of instance '%v'\n", name)
+	return snapshot != nil, nil
+}
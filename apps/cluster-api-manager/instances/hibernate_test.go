@@ -0,0 +1,100 @@
+package instances
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// newObjectStorageServer ...
+// returns a fake S3 compatible API for the bucket 'pair', storing objects in objects by key
+func newObjectStorageServer(t *testing.T, objects map[string][]byte) *httptest.Server {
+	lock := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		key := strings.TrimPrefix(r.URL.Path, "/pair/")
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[key] = body
+		case http.MethodGet:
+			object, ok := objects[key]
+			if ok != true {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(object)
+		case http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("APP_BACKUP_S3_ENDPOINT", server.URL)
+	t.Setenv("APP_BACKUP_S3_BUCKET", "pair")
+	return server
+}
+
+func TestKubernetesHibernateWithoutObjectStorage(t *testing.T) {
+	t.Setenv("APP_BACKUP_S3_ENDPOINT", "")
+	t.Setenv("APP_BACKUP_S3_BUCKET", "")
+
+	_, err := KubernetesHibernate("bobymcbobs-exjk", nil, nil)
+	var invalidErr InstanceUpdateInvalidError
+	if errors.As(err, &invalidErr) != true {
+		t.Errorf("expected hibernating to be refused without object storage, got %v", err)
+	}
+}
+
+func TestHomeSnapshotKey(t *testing.T) {
+	key := homeSnapshotKey("bobymcbobs-exjk")
+	if key != "_snapshots/bobymcbobs-exjk.tar.gz" {
+		t.Errorf("expected key '_snapshots/bobymcbobs-exjk.tar.gz', got '%v'", key)
+	}
+	if _, ok := homeBackupFromObject(common.ObjectStorageObject{Key: key}); ok == true {
+		t.Errorf("expected the snapshot '%v' not to be a backup", key)
+	}
+}
+
+func TestDeleteHomeSnapshot(t *testing.T) {
+	objects := map[string][]byte{
+		homeSnapshotKey("bobymcbobs-exjk"): []byte("home"),
+		homeSnapshotKey("bobymcbobs-abcd"): []byte("home"),
+	}
+	newObjectStorageServer(t, objects)
+	legacySnapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":      "bobymcbobs-exjk-home-snapshot-0",
+			"namespace": common.GetTargetNamespace(),
+			"labels": map[string]interface{}{
+				"io.sharing.pair":           "home-snapshot",
+				"io.sharing.pair-spec-name": "bobymcbobs-exjk",
+			},
+		},
+	}}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), legacySnapshot)
+
+	err := deleteHomeSnapshot(dynamicClient, "bobymcbobs-exjk")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := objects[homeSnapshotKey("bobymcbobs-exjk")]; ok == true {
+		t.Errorf("expected the snapshot to be deleted from object storage")
+	}
+	if _, ok := objects[homeSnapshotKey("bobymcbobs-abcd")]; ok != true {
+		t.Errorf("expected the snapshot of another instance to be kept")
+	}
+}
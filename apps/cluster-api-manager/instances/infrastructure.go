@@ -0,0 +1,107 @@
+package instances
+
+import (
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// InfrastructureProvider ...
+// a Cluster-API infrastructure provider, which provisions the machines of Kubernetes instances
+type InfrastructureProvider interface {
+	// Name returns the name which the provider is selected by
+	Name() string
+	// KubernetesInfrastructure returns the provider resources of a Kubernetes instance
+	KubernetesInfrastructure(instance InstanceSpec, namespace string) (infrastructure KubernetesInfrastructure, err error)
+	// KubernetesResourceQueries returns how to find the provider resources of a Kubernetes instance
+	KubernetesResourceQueries(instance InstanceSpec) (queries InfrastructureResourceQueries)
+	// KubeletExtraArgs returns the args for the kubelet on every node
+	KubeletExtraArgs() map[string]string
+	// PreKubeadmCommands returns the commands to run on a node of a type before kubeadm
+	PreKubeadmCommands(nodeType string) (commands []string, err error)
+	// PostKubeadmCommands returns the commands to run on a node of a type after kubeadm
+	PostKubeadmCommands(nodeType string) (commands []string, err error)
+	// ListMachines returns the provider machines matching a label selector
+	ListMachines(dynamicClient dynamic.Interface, labelSelector string) (machines []InfrastructureMachine, err error)
+	// MachineAddress returns the address of a machine to point the DNS of an instance to
+	MachineAddress(addresses clusterAPIv1beta1.MachineAddresses) (address string, err error)
+}
+
+// KubernetesInfrastructure ...
+// the provider resources which a Kubernetes instance's Cluster and machines refer to
+type KubernetesInfrastructure struct {
+	Cluster         instanceResource
+	MachineTemplate instanceResource
+	// MachineTemplateWorkers are the machine templates of each worker pool, in the order of the pools
+	MachineTemplateWorkers []instanceResource
+}
+
+// InfrastructureResourceQueries ...
+// how to find the provider resources of a Kubernetes instance
+type InfrastructureResourceQueries struct {
+	Cluster          instanceResourceQuery
+	MachineTemplates []instanceResourceQuery
+	Machines         instanceResourceQuery
+}
+
+// machineTemplateQueries ...
+// returns how to find the machine templates of the control plane and each worker pool of an instance
+func machineTemplateQueries(instance InstanceSpec, groupVersionResource schema.GroupVersionResource) (queries []instanceResourceQuery) {
+	queries = []instanceResourceQuery{{GroupVersionResource: groupVersionResource, Name: instance.Name + "-control-plane", Owned: true}}
+	for _, pool := range InstanceWorkerPools(instance) {
+		queries = append(queries, instanceResourceQuery{GroupVersionResource: groupVersionResource, Name: workerPoolResourceName(instance.Name, pool.Name), Owned: true})
+	}
+	return queries
+}
+
+// InfrastructureMachine ...
+// a machine provisioned by a provider
+type InfrastructureMachine struct {
+	Name        string
+	ClusterName string
+	ProviderID  string
+	// UID is the identifier of the machine with the provider
+	UID string
+}
+
+// node types which bootstrap commands are for
+const (
+	nodeTypeControlPlane = "control-plane"
+	nodeTypeWorker       = "worker"
+)
+
+// infrastructureProviders ...
+// the providers which can be selected
+var infrastructureProviders = map[string]InfrastructureProvider{
+	PacketProvider{}.Name(): PacketProvider{},
+	DockerProvider{}.Name(): DockerProvider{},
+}
+
+// GetInfrastructureProvider ...
+// returns the provider which Kubernetes instances are created with
+func GetInfrastructureProvider() InfrastructureProvider {
+	name := GetInfrastructureProviderName()
+	provider, ok := infrastructureProviders[name]
+	if ok != true {
+		log.Printf("Unknown infrastructure provider '%v', using '%v'\n", name, PacketProvider{}.Name())
+		return PacketProvider{}
+	}
+	return provider
+}
+
+// objectReference ...
+// returns a reference to the object of a resource, for other resources to refer to it by
+func (r instanceResource) objectReference() corev1.ObjectReference {
+	reference := corev1.ObjectReference{
+		APIVersion: servedAPIVersion(r.GroupVersionResource.GroupVersion()),
+		Kind:       r.Kind,
+	}
+	if obj, ok := r.Object.(metav1.Object); ok {
+		reference.Name = obj.GetName()
+	}
+	return reference
+}
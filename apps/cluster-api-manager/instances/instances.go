@@ -1,20 +1,46 @@
 package instances
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/asaskevich/govalidator"
+	jsonpatch "github.com/evanphx/json-patch"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	clusterAPIPacketv1beta1 "sigs.k8s.io/cluster-api-provider-packet/api/v1beta1"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	cabpkv1beta1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1"
+	clusterAPIControlPlaneKubeadmv1beta1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
 
 	"github.com/sharingio/pair/apps/cluster-api-manager/common"
 )
 
 // ValidateInstance ...
-// ensure an Instance is valid
+// ensure an Instance is valid, with the fields chosen from the catalog in it
 func ValidateInstance(instance InstanceSpec) (err error) {
+	err = validateInstanceFields(instance)
+	if err != nil {
+		return err
+	}
+	return ValidateInstanceCatalog(instance)
+}
+
+// validateInstanceFields ...
+// ensure the fields of an Instance are valid
+func validateInstanceFields(instance InstanceSpec) (err error) {
 	if common.ValidateName(instance.Name) == false && instance.Name != "" {
 		return fmt.Errorf("Invalid instance name '%v'", instance.Name)
 	}
@@ -26,6 +52,9 @@ func ValidateInstance(instance InstanceSpec) (err error) {
 		return fmt.Errorf("No user declared")
 	}
 	if instance.Type == InstanceTypePlain {
+		if GetInfrastructureProvider().Name() != (PacketProvider{}).Name() {
+			return fmt.Errorf("Plain instances are only available with the '%v' infrastructure provider", PacketProvider{}.Name())
+		}
 		if len(instance.Setup.Guests) < 1 {
 			return fmt.Errorf("No guests declared")
 		}
@@ -54,13 +83,92 @@ func ValidateInstance(instance InstanceSpec) (err error) {
 	if govalidator.IsEmail(instance.Setup.Email) != true || instance.Setup.Email == "" {
 		return fmt.Errorf("Invalid user email")
 	}
+	err = validateWorkerPools(instance)
+	if err != nil {
+		return err
+	}
+	if max := GetInstanceMaxKubernetesNodeCount(); len(instance.WorkerPools) > 0 && workerPoolNodeCount(instance.WorkerPools) > max {
+		return fmt.Errorf("Too many worker nodes, the worker pools may have up to %v", max)
+	}
 	return nil
 }
 
+// InstanceSpecFromAnnotations ...
+// returns the spec of an instance, from the annotations of it's Cluster which instances were created with before PairInstances
+func InstanceSpecFromAnnotations(annotations map[string]string) (spec InstanceSpec) {
+	spec.Type = InstanceType(annotations["io.sharing.pair-spec-type"])
+	if spec.Type == "" {
+		// instances created before the type annotation are all Kubernetes
+		spec.Type = InstanceTypeKubernetes
+	}
+	spec.Name = annotations["io.sharing.pair-spec-name"]
+	spec.NameScheme = InstanceNameScheme(annotations["io.sharing.pair-spec-nameScheme"])
+	spec.Setup.User = annotations["io.sharing.pair-spec-setup-user"]
+	spec.Setup.UserLowercase = strings.ToLower(spec.Setup.User)
+	spec.NodeSize = annotations["io.sharing.pair-spec-nodeSize"]
+	spec.Facility = annotations["io.sharing.pair-spec-facility"]
+	kubernetesNodeCount, _ := strconv.Atoi(annotations["io.sharing.pair-spec-kubernetesNodeCount"])
+	spec.KubernetesNodeCount = kubernetesNodeCount
+	spec.Setup.Guests = strings.Fields(annotations["io.sharing.pair-spec-setup-guests"])
+	spec.Setup.Repos = strings.Fields(annotations["io.sharing.pair-spec-setup-repos"])
+	spec.Setup.Timezone = annotations["io.sharing.pair-spec-setup-timezone"]
+	spec.Setup.Fullname = annotations["io.sharing.pair-spec-setup-fullname"]
+	spec.Setup.Email = annotations["io.sharing.pair-spec-setup-email"]
+	var env []map[string]string
+	json.Unmarshal([]byte(annotations["io.sharing.pair-spec-setup-env"]), &env)
+	spec.Setup.Env = MaskSecretEnv(env)
+	spec.Setup.BaseDNSName = annotations["io.sharing.pair-spec-setup-baseDNSName"]
+	if expiresAt, err := time.Parse(time.RFC3339, annotations["io.sharing.pair-spec-expiresAt"]); err == nil {
+		spec.ExpiresAt = &metav1.Time{Time: expiresAt}
+	}
+	return spec
+}
+
+// GetSpec ...
+// get the spec of an instance of any type, without it's status
+func GetSpec(name string, dynamicClient dynamic.Interface) (spec InstanceSpec, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersion := clusterAPIv1beta1.GroupVersion
+	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "clusters"}
+	item, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		// instances being resumed only have their PairInstance, until their Cluster is replaced
+		pairInstance, err := GetPairInstance(name, dynamicClient)
+		if err != nil || pairInstance == nil || pairInstance.ObjectMeta.Annotations[instanceResumeAnnotation] == "" {
+			return InstanceSpec{}, err
+		}
+		return pairInstance.Spec, nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return InstanceSpec{}, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+	if item.GetLabels()["io.sharing.pair"] != "instance" {
+		log.Printf("Not using object %s/Cluster/%s - not an instance managed by sharingio/pair\n", targetNamespace, name)
+		return InstanceSpec{}, nil
+	}
+	return GetInstanceSpecOfCluster(item, dynamicClient)
+}
+
 // Get ...
 // get an instance
-func Get(name string) (instance Instance, err error) {
-	return instance, nil
+func Get(name string, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) (instance Instance, err error) {
+	spec, err := GetSpec(name, dynamicClient)
+	if err != nil || spec.Name == "" {
+		return instance, err
+	}
+	switch spec.Type {
+	case InstanceTypeKubernetes:
+		instance, err = KubernetesGet(name, dynamicClient, clientset)
+		break
+
+	case InstanceTypePlain:
+		instance, err = PlainGet(name, dynamicClient, clientset)
+		break
+
+	default:
+		return Instance{}, fmt.Errorf("Invalid instance type")
+	}
+	return instance, err
 }
 
 // List ...
@@ -72,21 +180,162 @@ func List(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, opti
 		break
 
 	case InstanceTypePlain:
+		instances, err = PlainList(dynamicClient, clientset, options)
 		break
 
 	default:
 		instances, err = KubernetesList(dynamicClient, clientset, options)
-		// append plain type
+		if err != nil {
+			return instances, err
+		}
+		plainInstances, err := PlainList(dynamicClient, clientset, options)
+		if err != nil {
+			return instances, err
+		}
+		instances = append(instances, plainInstances...)
 	}
-	return instances, nil
+	return instances, err
+}
+
+// instanceResourceQueries ...
+// returns how to find each management cluster resource of an instance, starting with it's Cluster
+func instanceResourceQueries(instance InstanceSpec) (queries []instanceResourceQuery) {
+	name := instance.Name
+	clusterLabelSelector := "cluster.x-k8s.io/cluster-name=" + name
+	queries = []instanceResourceQuery{
+		{GroupVersionResource: clusterAPIv1beta1.GroupVersion.WithResource("clusters"), Name: name},
+		{GroupVersionResource: PairInstanceGroupVersionResource, Name: name, Owned: true},
+	}
+	switch instance.Type {
+	case InstanceTypeKubernetes:
+		infrastructureQueries := GetInfrastructureProvider().KubernetesResourceQueries(instance)
+		queries = append(queries, []instanceResourceQuery{
+			infrastructureQueries.Cluster,
+			{GroupVersionResource: clusterAPIControlPlaneKubeadmv1beta1.GroupVersion.WithResource("kubeadmcontrolplanes"), Name: name + "-control-plane", Owned: true},
+		}...)
+		for _, pool := range InstanceWorkerPools(instance) {
+			queries = append(queries, []instanceResourceQuery{
+				{GroupVersionResource: clusterAPIv1beta1.GroupVersion.WithResource("machinedeployments"), Name: workerPoolResourceName(name, pool.Name), Owned: true},
+				{GroupVersionResource: cabpkv1beta1.GroupVersion.WithResource("kubeadmconfigtemplates"), Name: workerPoolResourceName(name, pool.Name), Owned: true},
+			}...)
+		}
+		queries = append(queries, infrastructureQueries.MachineTemplates...)
+		queries = append(queries, []instanceResourceQuery{
+			{GroupVersionResource: clusterAPIv1beta1.GroupVersion.WithResource("machines"), LabelSelector: clusterLabelSelector},
+			infrastructureQueries.Machines,
+			{GroupVersionResource: corev1.SchemeGroupVersion.WithResource("secrets"), Name: name + "-kubeconfig"},
+			{GroupVersionResource: corev1.SchemeGroupVersion.WithResource("secrets"), Name: name + "-tls", Owned: true},
+		}...)
+
+	case InstanceTypePlain:
+		queries = append(queries, []instanceResourceQuery{
+			{GroupVersionResource: clusterAPIPacketv1beta1.GroupVersion.WithResource("packetclusters"), Name: name, Owned: true},
+			{GroupVersionResource: clusterAPIPacketv1beta1.GroupVersion.WithResource("packetmachines"), Name: name, Owned: true},
+			{GroupVersionResource: clusterAPIv1beta1.GroupVersion.WithResource("machines"), Name: name, Owned: true},
+			{GroupVersionResource: corev1.SchemeGroupVersion.WithResource("secrets"), Name: plainBootstrapSecretName(name), Owned: true},
+		}...)
+	}
+	queries = append(queries, instanceResourceQuery{
+		GroupVersionResource: corev1.SchemeGroupVersion.WithResource("secrets"),
+		Name:                 setupSecretName(name),
+		Owned:                true,
+	})
+	queries = append(queries, instanceResourceQuery{
+		GroupVersionResource: schema.GroupVersionResource{Version: "v1alpha1", Group: "externaldns.k8s.io", Resource: "dnsendpoints"},
+		LabelSelector:        "io.sharing.pair-spec-name=" + name,
+		Owned:                true,
+	})
+	return queries
+}
+
+// getInstanceResources ...
+// returns the resources found by a query, ignoring those not found
+func getInstanceResources(dynamicClient dynamic.Interface, query instanceResourceQuery) (items []unstructured.Unstructured, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	if query.Name != "" {
+		item, err := dynamicClient.Resource(common.ClusterAPIServedResource(query.GroupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), query.Name, metav1.GetOptions{})
+		if err != nil && apierrors.IsNotFound(err) {
+			return items, nil
+		} else if err != nil {
+			log.Printf("%#v\n", err)
+			return items, fmt.Errorf("Failed to get %v '%v', %#v", query.GroupVersionResource.Resource, query.Name, err)
+		}
+		return append(items, *item), nil
+	}
+	list, err := dynamicClient.Resource(common.ClusterAPIServedResource(query.GroupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: query.LabelSelector})
+	if err != nil && apierrors.IsNotFound(err) {
+		return items, nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return items, fmt.Errorf("Failed to list %v, %#v", query.GroupVersionResource.Resource, err)
+	}
+	return list.Items, nil
+}
+
+// BackfillOwnerReferences ...
+// set the Cluster of each existing instance as the owner of the resources created for it
+func BackfillOwnerReferences(dynamicClient dynamic.Interface) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	clusters, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "io.sharing.pair=instance"})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to list Clusters, %#v", err)
+	}
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		instance, err := GetInstanceSpecOfCluster(cluster, dynamicClient)
+		if err != nil {
+			return err
+		}
+		// NOTE instances which haven't been converted to a PairInstance yet only have their annotations
+		if instance.Name == "" {
+			instance = InstanceSpecFromAnnotations(cluster.GetAnnotations())
+			instance.Name = cluster.GetName()
+		}
+		err = adoptInstanceResources(dynamicClient, cluster, instance)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adoptInstanceResources ...
+// set the Cluster of an instance as the owner of each of it's resources which it doesn't own yet
+func adoptInstanceResources(dynamicClient dynamic.Interface, cluster *unstructured.Unstructured, instance InstanceSpec) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+	ownerReference := common.ClusterOwnerReference(cluster)
+	for _, query := range instanceResourceQueries(instance) {
+		if query.Owned != true {
+			continue
+		}
+		items, err := getInstanceResources(dynamicClient, query)
+		if err != nil {
+			return err
+		}
+		for j := range items {
+			item := &items[j]
+			if common.AddOwnerReference(item, ownerReference) != true {
+				continue
+			}
+			_, err = dynamicClient.Resource(common.ClusterAPIServedResource(query.GroupVersionResource)).Namespace(targetNamespace).Update(context.TODO(), item, metav1.UpdateOptions{})
+			if err != nil {
+				log.Printf("%#v\n", err)
+				return fmt.Errorf("Failed to set owner of %v '%v', %#v", item.GetKind(), item.GetName(), err)
+			}
+			log.Printf("Set Cluster '%v' as owner of %v '%v'\n", cluster.GetName(), item.GetKind(), item.GetName())
+		}
+	}
+	return nil
 }
 
 // Create ...
 // create an instance
-func Create(instance InstanceSpec, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, options InstanceCreateOptions) (instanceCreated InstanceSpec, err error) {
+func Create(instance InstanceSpec, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, options InstanceCreateOptions) (instanceCreated InstanceSpec, manifests InstanceManifests, err error) {
 	err = ValidateInstance(instance)
 	if err != nil {
-		return instanceCreated, err
+		return instanceCreated, manifests, err
 	}
 	instancesOfUser, err := List(dynamicClient, clientset, InstanceListOptions{
 		Filter: InstanceFilter{
@@ -94,23 +343,40 @@ func Create(instance InstanceSpec, dynamicClient dynamic.Interface, clientset *k
 		},
 	})
 	if err != nil {
-		return instanceCreated, err
+		return instanceCreated, manifests, err
 	}
 
-	if common.AccountIsAdmin(instance.Setup.ExtraEmails) != true {
-		switch len(instancesOfUser) {
-		case common.GetNonAdminInstanceMaxAmount():
-			return instanceCreated, fmt.Errorf("Max number of instances reached")
-		}
+	err = CheckCatalogAvailability(instance, options.Admin, options.Groups)
+	if err != nil {
+		return instanceCreated, manifests, err
+	}
+	err = validateRestoreBackup(instance)
+	if err != nil {
+		return instanceCreated, manifests, err
+	}
+	instance = NormalizeWorkerPools(ApplyCatalogDefaults(instance))
+	unlockQuota, err := lockQuota(instance.Setup.User, dynamicClient)
+	if err != nil {
+		return instanceCreated, manifests, err
+	}
+	defer unlockQuota()
+	err = CheckQuota(QuotaSubject{
+		Username: instance.Setup.User,
+		Groups:   options.Groups,
+		Admin:    options.Admin,
+	}, instance, nil, dynamicClient)
+	if err != nil {
+		return instanceCreated, manifests, err
 	}
 
 	instance.Setup.UserLowercase = strings.ToLower(instance.Setup.User)
 	// uses instance.Name if specified
 	// if no other instances exist
-	if len(instancesOfUser) == 0 && instance.Name == "" {
+	// a name generated from the username may also be asked for, such as for clones
+	if len(instancesOfUser) == 0 && instance.Name == "" && options.NameScheme != InstanceNameSchemeGenerateFromUsername {
 		instance.Name = instance.Setup.UserLowercase
 		options.NameScheme = InstanceNameSchemeSpecified
-	} else if len(instancesOfUser) > 0 && instance.Name == "" {
+	} else if instance.Name == "" {
 		// if other instances exist
 		instance.Name = GenerateName(instance)
 		options.NameScheme = InstanceNameSchemeGenerateFromUsername
@@ -121,7 +387,7 @@ func Create(instance InstanceSpec, dynamicClient dynamic.Interface, clientset *k
 	if options.NameScheme == InstanceNameSchemeSpecified {
 		for _, existingInstance := range instancesOfUser {
 			if instance.Name == existingInstance.Spec.Name {
-				return instanceCreated, fmt.Errorf("An instance with the provided name already exists")
+				return instanceCreated, manifests, fmt.Errorf("An instance with the provided name already exists")
 			}
 		}
 	}
@@ -135,35 +401,279 @@ func Create(instance InstanceSpec, dynamicClient dynamic.Interface, clientset *k
 	if instance.Setup.Fullname == "" {
 		instance.Setup.Fullname = instance.Setup.User
 	}
+	instance.ExpiresAt = &metav1.Time{Time: InstanceExpiry(time.Now(), options.Lifetime, options.Admin)}
 	switch instance.Type {
 	case InstanceTypeKubernetes:
-		instanceCreated, err = KubernetesCreate(instance, dynamicClient, clientset, options)
+		instanceCreated, manifests, err = KubernetesCreate(instance, dynamicClient, clientset, options)
 		break
 
 	case InstanceTypePlain:
+		instanceCreated, manifests, err = PlainCreate(instance, dynamicClient, clientset, options)
 		break
 
 	default:
-		return InstanceSpec{}, fmt.Errorf("Invalid instance type")
+		return InstanceSpec{}, manifests, fmt.Errorf("Invalid instance type")
 	}
-	return instanceCreated, nil
+	instanceCreated.Setup.Env = MaskSecretEnv(instanceCreated.Setup.Env)
+	return instanceCreated, manifests, err
+}
+
+// createInstanceResources ...
+// create the resources of an instance in order, deleting the ones created if any fail.
+// The Cluster must be first, as every resource after it is owned by it
+func createInstanceResources(dynamicClient dynamic.Interface, namespace string, resources []instanceResource) (err error) {
+	created := []*unstructured.Unstructured{}
+	createdResources := []instanceResource{}
+	var clusterOwnerReference *metav1.OwnerReference
+	for _, resource := range resources {
+		servedGroupVersionResource := common.ClusterAPIServedResource(resource.GroupVersionResource)
+		log.Printf("%#v\n", servedGroupVersionResource)
+		object, err := servedObject(resource.GroupVersionResource, resource.Object)
+		if err != nil {
+			log.Printf("%#v\n", err)
+			return rollbackInstanceResources(dynamicClient, namespace, createdResources, created, resource.Step, fmt.Sprintf("unable to convert, %#v", err))
+		}
+		asUnstructured, err := common.ObjectToUnstructured(object)
+		if err != nil {
+			log.Printf("%#v\n", err)
+			return rollbackInstanceResources(dynamicClient, namespace, createdResources, created, resource.Step, fmt.Sprintf("unable to unstructure, %#v", err))
+		}
+		asUnstructured.SetGroupVersionKind(servedGroupVersionResource.GroupVersion().WithKind(resource.Kind))
+		if clusterOwnerReference != nil {
+			common.AddOwnerReference(asUnstructured, *clusterOwnerReference)
+		}
+		item, err := dynamicClient.Resource(servedGroupVersionResource).Namespace(namespace).Create(context.TODO(), asUnstructured, metav1.CreateOptions{})
+		if err != nil && apierrors.IsAlreadyExists(err) != true {
+			log.Printf("%#v\n", err)
+			return rollbackInstanceResources(dynamicClient, namespace, createdResources, created, resource.Step, fmt.Sprintf("%#v", err))
+		}
+		if apierrors.IsAlreadyExists(err) {
+			// not created here, so not removed on rollback
+			log.Println("Already exists")
+			item, err = dynamicClient.Resource(servedGroupVersionResource).Namespace(namespace).Get(context.TODO(), asUnstructured.GetName(), metav1.GetOptions{})
+			if err != nil {
+				log.Printf("%#v\n", err)
+				return rollbackInstanceResources(dynamicClient, namespace, createdResources, created, resource.Step, fmt.Sprintf("%#v", err))
+			}
+		} else {
+			created = append(created, asUnstructured)
+			createdResources = append(createdResources, resource)
+		}
+		if resource.Kind == "Cluster" {
+			ownerReference := common.ClusterOwnerReference(item)
+			clusterOwnerReference = &ownerReference
+		}
+	}
+	return nil
+}
+
+// rollbackInstanceResources ...
+// delete the resources created for an instance in reverse order, returning an error for the step that failed
+func rollbackInstanceResources(dynamicClient dynamic.Interface, namespace string, resources []instanceResource, created []*unstructured.Unstructured, step string, reason string) (err error) {
+	createErr := InstanceCreateError{
+		Step:       step,
+		Reason:     reason,
+		RolledBack: []string{},
+	}
+	for i := len(created) - 1; i >= 0; i-- {
+		resourceName := fmt.Sprintf("%v/%v", resources[i].Kind, created[i].GetName())
+		log.Printf("Rolling back %v after failing to create %v\n", resourceName, step)
+		propagationPolicy := metav1.DeletePropagationBackground
+		err = dynamicClient.Resource(common.ClusterAPIServedResource(resources[i].GroupVersionResource)).Namespace(namespace).Delete(context.TODO(), created[i].GetName(), metav1.DeleteOptions{PropagationPolicy: &propagationPolicy})
+		if err != nil && apierrors.IsNotFound(err) != true {
+			log.Printf("%#v\n", err)
+			createErr.RollbackFailed = append(createErr.RollbackFailed, resourceName)
+			continue
+		}
+		createErr.RolledBack = append(createErr.RolledBack, resourceName)
+	}
+	return createErr
+}
+
+// GetInstanceImmutableFieldChanges ...
+// returns the fields which would be changed by an update, that can't change after an instance is created
+// NOTE empty fields are treated as unchanged
+func GetInstanceImmutableFieldChanges(current InstanceSpec, desired InstanceSpec) (fields []string) {
+	changed := func(field string, currentValue string, desiredValue string) {
+		if desiredValue != "" && desiredValue != currentValue {
+			fields = append(fields, field)
+		}
+	}
+	changed("name", current.Name, desired.Name)
+	changed("type", string(current.Type), string(desired.Type))
+	changed("nameScheme", string(current.NameScheme), string(desired.NameScheme))
+	changed("nodeSize", current.NodeSize, desired.NodeSize)
+	changed("nodeOS", current.NodeOS, desired.NodeOS)
+	changed("facility", current.Facility, desired.Facility)
+	changed("registryMirrors", strings.Join(current.RegistryMirrors, " "), strings.Join(desired.RegistryMirrors, " "))
+	changed("setup.user", strings.ToLower(current.Setup.User), strings.ToLower(desired.Setup.User))
+	changed("setup.fullname", current.Setup.Fullname, desired.Setup.Fullname)
+	changed("setup.email", current.Setup.Email, desired.Setup.Email)
+	changed("setup.githubOAuthToken", current.Setup.GitHubOAuthToken, desired.Setup.GitHubOAuthToken)
+	changed("setup.baseDNSName", current.Setup.BaseDNSName, desired.Setup.BaseDNSName)
+	changed("setup.kubernetesVersion", current.Setup.KubernetesVersion, desired.Setup.KubernetesVersion)
+	changed("setup.environmentRepository", current.Setup.EnvironmentRepository, desired.Setup.EnvironmentRepository)
+	changed("setup.environmentVersion", current.Setup.EnvironmentVersion, desired.Setup.EnvironmentVersion)
+	if len(desired.Setup.ExtraEmails) > 0 {
+		fields = append(fields, "setup.extraEmails")
+	}
+	fields = append(fields, GetWorkerPoolChanges(current.WorkerPools, desired.WorkerPools)...)
+	return fields
+}
+
+// PatchInstanceSpec ...
+// returns the spec of an instance with a JSON merge patch applied, where lists in the patch replace those of the instance
+func PatchInstanceSpec(current InstanceSpec, patch []byte) (instance InstanceSpec, err error) {
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return InstanceSpec{}, fmt.Errorf("Failed to marshal instance, %v", err)
+	}
+	patchedJSON, err := jsonpatch.MergePatch(currentJSON, patch)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	err = json.Unmarshal(patchedJSON, &instance)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	instance.Setup.UserLowercase = current.Setup.UserLowercase
+	return instance, nil
+}
+
+// InstanceSetupChanged ...
+// returns if the guests, repos, env or timezone of an instance differ, which are read by it's Environment
+func InstanceSetupChanged(current InstanceSpec, desired InstanceSpec) bool {
+	return strings.Join(current.Setup.Guests, " ") != strings.Join(desired.Setup.Guests, " ") ||
+		strings.Join(current.Setup.Repos, " ") != strings.Join(desired.Setup.Repos, " ") ||
+		current.Setup.Timezone != desired.Setup.Timezone ||
+		reflect.DeepEqual(current.Setup.Env, desired.Setup.Env) != true
 }
 
 // Update ...
-// update an instance
-func Update(instance InstanceSpec) (instanceUpdated InstanceSpec, err error) {
-	return instanceUpdated, nil
+// update the mutable fields of an instance
+func Update(name string, instance InstanceSpec, dynamicClient dynamic.Interface, options InstanceUpdateOptions) (instanceUpdated InstanceSpec, err error) {
+	current, err := GetSpec(name, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	if current.Name == "" {
+		return InstanceSpec{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+	if fields := GetInstanceImmutableFieldChanges(current, instance); len(fields) > 0 {
+		return InstanceSpec{}, InstanceUpdateInvalidError{
+			Reason: fmt.Sprintf("Unable to change immutable fields: %v", strings.Join(fields, ", ")),
+		}
+	}
+	// NOTE the node count of an instance with worker pools is their total, so they're scaled instead
+	if len(current.WorkerPools) > 0 && len(instance.WorkerPools) == 0 && instance.KubernetesNodeCount != current.KubernetesNodeCount {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: "Unable to change the node count of an instance with worker pools, scale it's pools instead"}
+	}
+	if len(instance.WorkerPools) > 0 {
+		instance.KubernetesNodeCount = workerPoolNodeCount(instance.WorkerPools)
+	}
+	if instance.KubernetesNodeCount < 0 || instance.KubernetesNodeCount > GetInstanceMaxKubernetesNodeCount() {
+		return InstanceSpec{}, InstanceUpdateInvalidError{
+			Reason: fmt.Sprintf("Invalid Kubernetes node count, must be between 0 and %v", GetInstanceMaxKubernetesNodeCount()),
+		}
+	}
+
+	instanceUpdated = current
+	instanceUpdated.Setup.Guests = []string{}
+	for _, guest := range instance.Setup.Guests {
+		if guest != "" {
+			instanceUpdated.Setup.Guests = append(instanceUpdated.Setup.Guests, guest)
+		}
+	}
+	instanceUpdated.Setup.Repos = []string{}
+	for _, repo := range instance.Setup.Repos {
+		if repo != "" {
+			instanceUpdated.Setup.Repos = append(instanceUpdated.Setup.Repos, repo)
+		}
+	}
+	instanceUpdated.Setup.Env = instance.Setup.Env
+	instanceUpdated.Setup.Timezone = instance.Setup.Timezone
+	instanceUpdated.KubernetesNodeCount = instance.KubernetesNodeCount
+	if len(instance.WorkerPools) > 0 {
+		instanceUpdated.WorkerPools = []InstanceWorkerPool{}
+		for i, pool := range current.WorkerPools {
+			pool.Count = instance.WorkerPools[i].Count
+			instanceUpdated.WorkerPools = append(instanceUpdated.WorkerPools, pool)
+		}
+	}
+	// NOTE the fields chosen from the catalog are immutable, so they're not validated against it again
+	err = validateInstanceFields(instanceUpdated)
+	if err != nil {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: err.Error()}
+	}
+	subject, err := ownerQuotaSubject(current, options, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	unlockQuota, err := lockQuota(current.Setup.User, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	defer unlockQuota()
+	err = CheckQuota(subject, instanceUpdated, &current, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+
+	switch current.Type {
+	case InstanceTypeKubernetes:
+		var hibernated bool
+		hibernated, err = KubernetesIsHibernated(name, dynamicClient)
+		if err != nil {
+			return InstanceSpec{}, err
+		}
+		if hibernated == true {
+			return InstanceSpec{}, InstanceUpdateInvalidError{Reason: "Unable to update a hibernated instance, resume it first"}
+		}
+		// usage so far is recorded with the current node count, before it changes
+		if instanceUpdated.KubernetesNodeCount != current.KubernetesNodeCount {
+			err = RecordInstanceUsage(name, dynamicClient)
+			if err != nil {
+				return InstanceSpec{}, err
+			}
+		}
+		instanceUpdated, err = KubernetesUpdate(instanceUpdated, dynamicClient)
+		break
+
+	default:
+		return InstanceSpec{}, InstanceUpdateInvalidError{
+			Reason: fmt.Sprintf("Updating %v instances is not supported", current.Type),
+		}
+	}
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	// NOTE masked secret env values keep their stored values
+	err = upsertSetupSecret(dynamicClient, instanceUpdated)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	// the reconciler pushes the changed setup to the running Environment
+	if InstanceSetupChanged(current, instanceUpdated) == true {
+		err = setResourceAnnotation(dynamicClient, clusterAPIv1beta1.GroupVersion.WithResource("clusters"), name, instanceSetupUpdatedAtAnnotation, time.Now().UTC().Format(time.RFC3339Nano))
+		if err != nil {
+			return InstanceSpec{}, err
+		}
+	}
+	err = UpdatePairInstanceSpec(instanceUpdated, dynamicClient)
+	instanceUpdated.Setup.Env = MaskSecretEnv(instanceUpdated.Setup.Env)
+	return instanceUpdated, err
 }
 
 // Delete ...
 // delete an instance
-func Delete(instance InstanceSpec, kubernetesClientset dynamic.Interface) (err error) {
+func Delete(instance InstanceSpec, kubernetesClientset dynamic.Interface, clientset *kubernetes.Clientset) (err error) {
 	switch instance.Type {
 	case InstanceTypeKubernetes:
-		err = KubernetesDelete(instance.Name, kubernetesClientset)
+		err = KubernetesDelete(instance.Name, kubernetesClientset, clientset)
 		break
 
 	case InstanceTypePlain:
+		err = PlainDelete(instance.Name, kubernetesClientset)
 		break
 
 	default:
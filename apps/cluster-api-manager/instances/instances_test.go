@@ -0,0 +1,178 @@
+package instances
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+)
+
+func TestPatchInstanceSpec(t *testing.T) {
+	current := InstanceSpec{
+		Name:                "bobymcbobs-exjk",
+		Type:                InstanceTypeKubernetes,
+		NodeSize:            "c3.small.x86",
+		KubernetesNodeCount: 1,
+		Setup: types.SetupSpec{
+			User:          "BobyMCbobs",
+			UserLowercase: "bobymcbobs",
+			Guests:        []string{"calebwoodbine", "hh"},
+			Repos:         []string{"https://github.com/sharingio/pair"},
+			Timezone:      "Pacific/Auckland",
+			Env: []map[string]string{
+				{"EDITOR": "emacs"},
+				{"GITHUB_TOKEN": "***"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		patch    string
+		expected func(instance InstanceSpec) InstanceSpec
+		wantErr  bool
+	}{
+		{
+			name:     "empty patch keeps the instance",
+			patch:    `{}`,
+			expected: func(instance InstanceSpec) InstanceSpec { return instance },
+		},
+		{
+			name:  "scalar fields are replaced",
+			patch: `{"kubernetesNodeCount":3,"setup":{"timezone":"Australia/Perth"}}`,
+			expected: func(instance InstanceSpec) InstanceSpec {
+				instance.KubernetesNodeCount = 3
+				instance.Setup.Timezone = "Australia/Perth"
+				return instance
+			},
+		},
+		{
+			name:  "lists are replaced rather than merged",
+			patch: `{"setup":{"guests":["zachmandeville"]}}`,
+			expected: func(instance InstanceSpec) InstanceSpec {
+				instance.Setup.Guests = []string{"zachmandeville"}
+				return instance
+			},
+		},
+		{
+			name:  "env is replaced, removing keys which aren't in the patch",
+			patch: `{"setup":{"env":[{"PAGER":"less"}]}}`,
+			expected: func(instance InstanceSpec) InstanceSpec {
+				instance.Setup.Env = []map[string]string{{"PAGER": "less"}}
+				return instance
+			},
+		},
+		{
+			name:  "null clears a field",
+			patch: `{"setup":{"repos":null}}`,
+			expected: func(instance InstanceSpec) InstanceSpec {
+				instance.Setup.Repos = nil
+				return instance
+			},
+		},
+		{
+			name:    "invalid JSON is rejected",
+			patch:   `{"setup":`,
+			wantErr: true,
+		},
+		{
+			name:    "mistyped fields are rejected",
+			patch:   `{"kubernetesNodeCount":"three"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := PatchInstanceSpec(current, []byte(tt.patch))
+			if tt.wantErr == true {
+				if err == nil {
+					t.Fatalf("expected an error, got %#v", patched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expected := tt.expected(current)
+			if reflect.DeepEqual(patched, expected) != true {
+				t.Errorf("expected %#v, got %#v", expected, patched)
+			}
+		})
+	}
+
+	if current.Setup.Guests[0] != "calebwoodbine" || len(current.Setup.Env[0]) != 1 {
+		t.Errorf("patching modified the current instance, %#v", current.Setup)
+	}
+}
+
+func TestGetInstanceImmutableFieldChanges(t *testing.T) {
+	current := InstanceSpec{
+		Name:     "bobymcbobs-exjk",
+		Type:     InstanceTypeKubernetes,
+		NodeSize: "c3.small.x86",
+		Facility: "sjc1",
+		Setup: types.SetupSpec{
+			User:  "BobyMCbobs",
+			Email: "bobymcbobs@ii.coop",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		desired  func(instance InstanceSpec) InstanceSpec
+		expected []string
+	}{
+		{
+			name:    "unchanged",
+			desired: func(instance InstanceSpec) InstanceSpec { return instance },
+		},
+		{
+			name: "mutable fields",
+			desired: func(instance InstanceSpec) InstanceSpec {
+				instance.KubernetesNodeCount = 2
+				instance.Setup.Guests = []string{"calebwoodbine"}
+				instance.Setup.Timezone = "Australia/Perth"
+				return instance
+			},
+		},
+		{
+			name: "omitted fields",
+			desired: func(instance InstanceSpec) InstanceSpec {
+				return InstanceSpec{}
+			},
+		},
+		{
+			name: "user differs only in case",
+			desired: func(instance InstanceSpec) InstanceSpec {
+				instance.Setup.User = "bobymcbobs"
+				return instance
+			},
+		},
+		{
+			name: "node size and facility",
+			desired: func(instance InstanceSpec) InstanceSpec {
+				instance.NodeSize = "m3.large.x86"
+				instance.Facility = "ams1"
+				return instance
+			},
+			expected: []string{"nodeSize", "facility"},
+		},
+		{
+			name: "owner and email",
+			desired: func(instance InstanceSpec) InstanceSpec {
+				instance.Setup.User = "calebwoodbine"
+				instance.Setup.Email = "caleb@ii.coop"
+				return instance
+			},
+			expected: []string{"setup.user", "setup.email"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := GetInstanceImmutableFieldChanges(current, tt.desired(current))
+			if len(fields) != len(tt.expected) || (len(fields) > 0 && reflect.DeepEqual(fields, tt.expected) != true) {
+				t.Errorf("expected %v, got %v", tt.expected, fields)
+			}
+		})
+	}
+}
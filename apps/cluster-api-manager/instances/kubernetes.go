@@ -3,13 +3,11 @@ package instances
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/url"
 	"sort"
-	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -17,11 +15,11 @@ import (
 	"github.com/sharingio/pair/apps/cluster-api-manager/common"
 	"github.com/sharingio/pair/apps/cluster-api-manager/dns"
 
-	"github.com/asaskevich/govalidator"
 	corev1 "k8s.io/api/core/v1"
 	// networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
@@ -34,24 +32,30 @@ import (
 
 	knetv1alpha1 "knative.dev/networking/pkg/apis/networking/v1alpha1"
 	knnetclientset "knative.dev/networking/pkg/client/clientset/versioned"
-	clusterAPIPacketv1alpha3 "sigs.k8s.io/cluster-api-provider-packet/api/v1alpha3"
-	clusterAPIv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
-	cabpkv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1alpha3"
-	upstreamv1beta1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/types/upstreamv1beta1"
-	clusterAPIControlPlaneKubeadmv1alpha3 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	cabpkv1beta1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1"
+	clusterAPIControlPlaneKubeadmv1beta1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
 	"sigs.k8s.io/yaml"
 )
 
 // KubernetesCluster ...
-// resources required for Cluster-API to provision a Kubernetes cluster on Packet
+// resources required for Cluster-API to provision a Kubernetes cluster with an infrastructure provider
 type KubernetesCluster struct {
-	KubeadmControlPlane         clusterAPIControlPlaneKubeadmv1alpha3.KubeadmControlPlane
-	Cluster                     clusterAPIv1alpha3.Cluster
-	MachineDeploymentWorker     clusterAPIv1alpha3.MachineDeployment
-	KubeadmConfigTemplateWorker cabpkv1.KubeadmConfigTemplate
-	PacketMachineTemplate       clusterAPIPacketv1alpha3.PacketMachineTemplate
-	PacketCluster               clusterAPIPacketv1alpha3.PacketCluster
-	PacketMachineTemplateWorker clusterAPIPacketv1alpha3.PacketMachineTemplate
+	KubeadmControlPlane clusterAPIControlPlaneKubeadmv1beta1.KubeadmControlPlane
+	Cluster             clusterAPIv1beta1.Cluster
+	WorkerPools         []KubernetesWorkerPool
+	Infrastructure      KubernetesInfrastructure
+	PairInstance        PairInstance
+	// SetupSecret is only templated when creating the instance, as it holds it's GitHub OAuth token
+	SetupSecret corev1.Secret
+}
+
+// KubernetesWorkerPool ...
+// resources required for Cluster-API to provision a pool of worker nodes
+type KubernetesWorkerPool struct {
+	MachineDeployment     clusterAPIv1beta1.MachineDeployment
+	KubeadmConfigTemplate cabpkv1beta1.KubeadmConfigTemplate
+	MachineTemplate       instanceResource
 }
 
 // ExecOptions ...
@@ -84,71 +88,66 @@ func KubernetesGet(name string, kubernetesClientset dynamic.Interface, clientset
 	instance.Spec.Type = InstanceTypeKubernetes
 
 	//   - newInstance.KubeadmControlPlane
-	groupVersionResource := schema.GroupVersionResource{Version: "v1alpha3", Group: "controlplane.cluster.x-k8s.io", Resource: "kubeadmcontrolplanes"}
-	item, err := kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).Get(context.TODO(), fmt.Sprintf("%s-control-plane", name), metav1.GetOptions{})
+	var itemRestructuredKCP clusterAPIControlPlaneKubeadmv1beta1.KubeadmControlPlane
+	groupVersionResource := clusterAPIControlPlaneKubeadmv1beta1.GroupVersion.WithResource("kubeadmcontrolplanes")
+	item, err := kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), fmt.Sprintf("%s-control-plane", name), metav1.GetOptions{})
 	if err != nil {
 		log.Printf("%#v\n", err)
-	}
-	var itemRestructuredKCP clusterAPIControlPlaneKubeadmv1alpha3.KubeadmControlPlane
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &itemRestructuredKCP)
-	if err != nil {
-		return Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructuredKCP)
-	}
-	if itemRestructuredKCP.ObjectMeta.Labels["io.sharing.pair"] != "instance" {
-		log.Printf("Not using object %s/%T/%s - not an instance managed by sharingio/pair\n", targetNamespace, itemRestructuredKCP, itemRestructuredKCP.ObjectMeta.Name)
 	} else {
-		instance.Status.Resources.KubeadmControlPlane = itemRestructuredKCP.Status
+		err = restructure(item, &itemRestructuredKCP)
+		if err != nil {
+			return Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructuredKCP)
+		}
+		if itemRestructuredKCP.ObjectMeta.Labels["io.sharing.pair"] != "instance" {
+			log.Printf("Not using object %s/%T/%s - not an instance managed by sharingio/pair\n", targetNamespace, itemRestructuredKCP, itemRestructuredKCP.ObjectMeta.Name)
+		} else {
+			instance.Status.Resources.KubeadmControlPlane = itemRestructuredKCP.Status
+		}
 	}
 
 	//   - newInstance.Machine
-	groupVersion := clusterAPIv1alpha3.GroupVersion
+	groupVersion := clusterAPIv1beta1.GroupVersion
 	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "machines"}
-	items, err := kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/cluster-name=" + name})
+	items, err := kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/cluster-name=" + name})
 	if err != nil {
 		log.Printf("%#v\n", err)
 	} else if len(items.Items) > 0 {
 		item = &items.Items[0]
-		var itemRestructuredM clusterAPIv1alpha3.Machine
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &itemRestructuredM)
+		var itemRestructuredM clusterAPIv1beta1.Machine
+		err = restructure(item, &itemRestructuredM)
 		if err != nil {
 			return Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructuredM)
 		}
 		instance.Status.Resources.MachineStatus = itemRestructuredM.Status
 	}
 
-	//   - newInstance.PacketMachine
-	groupVersion = clusterAPIv1alpha3.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetmachines"}
-	items, err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/cluster-name=" + name})
+	//   - newInstance.Infrastructure machines
+	infrastructureMachines, err := GetInfrastructureProvider().ListMachines(kubernetesClientset, "cluster.x-k8s.io/cluster-name="+name)
 	if err != nil {
 		log.Printf("%#v\n", err)
-	} else if len(items.Items) > 0 {
-		item = &items.Items[0]
-		var itemRestructuredPM clusterAPIPacketv1alpha3.PacketMachine
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &itemRestructuredPM)
-		if err != nil {
-			return Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructuredPM)
-		}
-		var providerID string
-		if itemRestructuredPM.Spec.ProviderID != nil {
-			providerID = *itemRestructuredPM.Spec.ProviderID
-		}
-		providerIDSplit := strings.Split(providerID, "/")
-		if len(providerIDSplit) == 3 {
-			instance.Status.Resources.PacketMachineUID = &providerIDSplit[2]
+	}
+	for i := range infrastructureMachines {
+		if infrastructureMachines[i].UID != "" {
+			instance.Status.Resources.PacketMachineUID = &infrastructureMachines[i].UID
+			break
 		}
 	}
 
 	//   - newInstance.Cluster
-	var itemRestructuredC clusterAPIv1alpha3.Cluster
-	groupVersion = clusterAPIv1alpha3.GroupVersion
+	var itemRestructuredC clusterAPIv1beta1.Cluster
+	groupVersion = clusterAPIv1beta1.GroupVersion
 	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "clusters"}
-	item, err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
-	if err != nil {
+	item, err = kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		// instances being resumed only have their PairInstance, until their Cluster is replaced
+		instance.Spec, err = GetSpec(name, kubernetesClientset)
+		instance.Status.Phase = InstanceStatusPhasePending
+		return instance, err
+	} else if err != nil {
 		log.Printf("%#v\n", err)
 		return instance, fmt.Errorf("Failed to get Cluster, %#v", err)
 	}
-	err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &itemRestructuredC)
+	err = restructure(item, &itemRestructuredC)
 	if err != nil {
 		return Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructuredC)
 	}
@@ -158,37 +157,35 @@ func KubernetesGet(name string, kubernetesClientset dynamic.Interface, clientset
 		instance.Status.Resources.Cluster = itemRestructuredC.Status
 	}
 
-	instance.Spec.Name = itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-name"]
-	instance.Spec.NameScheme = InstanceNameScheme(itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-nameScheme"])
-	instance.Spec.Setup.User = itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"]
-	instance.Spec.Setup.UserLowercase = strings.ToLower(instance.Spec.Setup.User)
-	instance.Spec.NodeSize = itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-nodeSize"]
-	instance.Spec.Facility = itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-facility"]
-	kubernetesNodeCount, _ := strconv.Atoi(itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-kubernetesNodeCount"])
-	instance.Spec.KubernetesNodeCount = kubernetesNodeCount
-	instance.Spec.Setup.Guests = strings.Split(itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-setup-guests"], " ")
-	instance.Spec.Setup.Repos = strings.Split(itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-setup-repos"], " ")
-	instance.Spec.Setup.Timezone = itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-setup-timezone"]
-	instance.Spec.Setup.Fullname = itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-setup-fullname"]
-	instance.Spec.Setup.Email = itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-setup-email"]
-	var env []map[string]string
-	json.Unmarshal([]byte(itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-setup-env"]), &env)
-	instance.Spec.Setup.Env = env
-	instance.Spec.Setup.BaseDNSName = itemRestructuredC.ObjectMeta.Annotations["io.sharing.pair-spec-setup-baseDNSName"]
-
-	var tmateSSH string
-	tmateSSH, err = KubernetesGetTmateSSHSession(clientset, instance.Spec.Name, instance.Spec.Setup.UserLowercase)
-	if err != nil {
-		log.Printf("err: %#v\n", err.Error())
-	}
-	log.Printf("Instance '%v' tmate session: '%v'", instance.Spec.Name, tmateSSH)
+	instance.Spec, err = GetInstanceSpecOfCluster(&itemRestructuredC, kubernetesClientset)
+	if err != nil {
+		return Instance{}, err
+	}
+
 	instance.Status.Phase = InstanceStatusPhaseProvisioning
 	if instance.Status.Resources.Cluster.Phase == string(InstanceStatusPhaseDeleting) {
 		instance.Status.Phase = InstanceStatusPhaseDeleting
-	} else if firstSnippit := strings.Split(tmateSSH, " "); firstSnippit[0] == "ssh" {
-		instance.Status.Phase = InstanceStatusPhaseProvisioned
+	} else if itemRestructuredC.ObjectMeta.Annotations[instanceHibernatedAtAnnotation] != "" {
+		instance.Status.Phase = InstanceStatusPhaseHibernated
+	} else if instance.Status.Upgrade, err = kubernetesUpgradeStatus(&itemRestructuredC, itemRestructuredKCP, kubernetesClientset); instance.Status.Upgrade != nil &&
+		(instance.Status.Upgrade.ControlPlaneUpdated != true || instance.Status.Upgrade.WorkersUpdated != true) {
+		if err != nil {
+			log.Printf("%#v\n", err)
+		}
+		instance.Status.Phase = InstanceStatusPhaseUpgrading
+	} else {
+		var tmateSSH string
+		tmateSSH, err = KubernetesGetTmateSSHSession(clientset, instance.Spec.Name, instance.Spec.Setup.UserLowercase)
+		if err != nil {
+			log.Printf("err: %#v\n", err.Error())
+		}
+		log.Printf("Instance '%v' tmate session: '%v'", instance.Spec.Name, tmateSSH)
+		if firstSnippit := strings.Split(tmateSSH, " "); firstSnippit[0] == "ssh" {
+			instance.Status.Phase = InstanceStatusPhaseProvisioned
+		}
 	}
 	log.Printf("Instance '%v' is at phase '%v'", instance.Spec.Name, instance.Status.Phase)
+	instance.Status.ExpiresIn = InstanceRemainingLifetime(instance.Spec)
 
 	return instance, nil
 }
@@ -198,8 +195,8 @@ func KubernetesGet(name string, kubernetesClientset dynamic.Interface, clientset
 func KubernetesList(kubernetesClientset dynamic.Interface, clientset *kubernetes.Clientset, options InstanceListOptions) (instances []Instance, err error) {
 	targetNamespace := common.GetTargetNamespace()
 
-	groupVersionResource := schema.GroupVersionResource{Version: "v1alpha3", Group: "controlplane.cluster.x-k8s.io", Resource: "kubeadmcontrolplanes"}
-	items, err := kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{})
+	groupVersionResource := clusterAPIControlPlaneKubeadmv1beta1.GroupVersion.WithResource("kubeadmcontrolplanes")
+	items, err := kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{})
 	if err != nil && apierrors.IsNotFound(err) != true {
 		log.Printf("%#v\n", err)
 		return instances, fmt.Errorf("Failed to list KubeadmControlPlanes, %#v", err)
@@ -209,8 +206,8 @@ func KubernetesList(kubernetesClientset dynamic.Interface, clientset *kubernetes
 	}
 
 	for _, item := range items.Items {
-		var itemRestructured clusterAPIControlPlaneKubeadmv1alpha3.KubeadmControlPlane
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &itemRestructured)
+		var itemRestructured clusterAPIControlPlaneKubeadmv1beta1.KubeadmControlPlane
+		err = restructure(&item, &itemRestructured)
 		if err != nil {
 			return []Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructured)
 		}
@@ -236,9 +233,9 @@ func KubernetesList(kubernetesClientset dynamic.Interface, clientset *kubernetes
 	}
 
 	//   - newInstance.Machine
-	groupVersion := clusterAPIv1alpha3.GroupVersion
+	groupVersion := clusterAPIv1beta1.GroupVersion
 	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "machines"}
-	items, err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{})
+	items, err = kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{})
 	if err != nil && apierrors.IsNotFound(err) != true {
 		log.Printf("%#v\n", err)
 		return instances, fmt.Errorf("Failed to list Machine, %#v", err)
@@ -248,8 +245,8 @@ func KubernetesList(kubernetesClientset dynamic.Interface, clientset *kubernetes
 	}
 
 	for _, item := range items.Items {
-		var itemRestructured clusterAPIv1alpha3.Machine
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &itemRestructured)
+		var itemRestructured clusterAPIv1beta1.Machine
+		err = restructure(&item, &itemRestructured)
 		if err != nil {
 			return []Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructured)
 		}
@@ -262,47 +259,28 @@ func KubernetesList(kubernetesClientset dynamic.Interface, clientset *kubernetes
 		}
 	}
 
-	//   - newInstance.PacketMachine
-	groupVersion = clusterAPIv1alpha3.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetmachines"}
-	items, err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{})
-	if err != nil && apierrors.IsNotFound(err) != true {
-		log.Printf("%#v\n", err)
-		return instances, fmt.Errorf("Failed to list PacketMachine, %#v", err)
-	}
-	if items == nil {
-		return []Instance{}, fmt.Errorf("Failed to list PacketMachines")
+	//   - newInstance.Infrastructure machines
+	infrastructureMachines, err := GetInfrastructureProvider().ListMachines(kubernetesClientset, "")
+	if err != nil {
+		return instances, err
 	}
-
-	for _, item := range items.Items {
-		var itemRestructured clusterAPIPacketv1alpha3.PacketMachine
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &itemRestructured)
-		if err != nil {
-			return []Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructured)
+	for j := range infrastructureMachines {
+		if infrastructureMachines[j].UID == "" {
+			continue
 		}
 	instances2:
 		for i := range instances {
-			if instances[i].Spec.Name == itemRestructured.ObjectMeta.Labels["cluster.x-k8s.io/cluster-name"] {
-				if itemRestructured.Spec.ProviderID == nil {
-					continue instances2
-				}
-				var providerID string
-				if itemRestructured.Spec.ProviderID != nil {
-					providerID = *itemRestructured.Spec.ProviderID
-				}
-				providerIDSplit := strings.Split(providerID, "/")
-				if len(providerIDSplit) == 3 {
-					instances[i].Status.Resources.PacketMachineUID = &providerIDSplit[2]
-				}
+			if instances[i].Spec.Name == infrastructureMachines[j].ClusterName {
+				instances[i].Status.Resources.PacketMachineUID = &infrastructureMachines[j].UID
 				break instances2
 			}
 		}
 	}
 
 	//   - newInstance.Cluster
-	groupVersion = clusterAPIv1alpha3.GroupVersion
+	groupVersion = clusterAPIv1beta1.GroupVersion
 	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "clusters"}
-	items, err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{})
+	items, err = kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{})
 	if err != nil && apierrors.IsNotFound(err) != true {
 		log.Printf("%#v\n", err)
 		return instances, fmt.Errorf("Failed to list Cluster, %#v", err)
@@ -310,10 +288,14 @@ func KubernetesList(kubernetesClientset dynamic.Interface, clientset *kubernetes
 	if items == nil {
 		return []Instance{}, fmt.Errorf("Failed to list Clusters")
 	}
+	specs, err := listPairInstanceSpecs(kubernetesClientset)
+	if err != nil {
+		return instances, err
+	}
 
 	for _, item := range items.Items {
-		var itemRestructured clusterAPIv1alpha3.Cluster
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &itemRestructured)
+		var itemRestructured clusterAPIv1beta1.Cluster
+		err = restructure(&item, &itemRestructured)
 		if err != nil {
 			return []Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructured)
 		}
@@ -321,41 +303,38 @@ func KubernetesList(kubernetesClientset dynamic.Interface, clientset *kubernetes
 			log.Printf("Not using object %s/%T/%s - not an instance managed by sharingio/pair\n", targetNamespace, itemRestructured, itemRestructured.ObjectMeta.Name)
 			continue
 		}
-		if options.Filter.Username != "" && itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"] != options.Filter.Username {
+		spec, ok := specs[itemRestructured.ObjectMeta.Name]
+		if ok != true {
+			log.Printf("Not using object %s/%T/%s - no PairInstance\n", targetNamespace, itemRestructured, itemRestructured.ObjectMeta.Name)
+			continue
+		}
+		if options.Filter.Username != "" && spec.Setup.User != options.Filter.Username {
 			log.Printf("Not using object %s/%T/%s - not related to username\n", targetNamespace, itemRestructured, itemRestructured.ObjectMeta.Name)
 			continue
 		}
 	instances3:
 		for i := range instances {
-			if instances[i].Spec.Name == itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-name"] {
+			if instances[i].Spec.Name == spec.Name {
+				instances[i].Spec = spec
 				instances[i].Spec.Type = InstanceTypeKubernetes
 				instances[i].Status.Resources.Cluster = itemRestructured.Status
-				instances[i].Spec.Name = itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-name"]
-				instances[i].Spec.NodeSize = itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-nodeSize"]
-				instances[i].Spec.Facility = itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-facility"]
-				instances[i].Spec.Setup.User = itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"]
-				instances[i].Spec.Setup.UserLowercase = strings.ToLower(instances[i].Spec.Setup.User)
-				instances[i].Spec.Setup.Guests = strings.Split(itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-setup-guests"], " ")
-				instances[i].Spec.Setup.Repos = strings.Split(itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-setup-repos"], " ")
-				instances[i].Spec.Setup.Timezone = itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-setup-timezone"]
-				instances[i].Spec.Setup.Fullname = itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-setup-fullname"]
-				instances[i].Spec.Setup.Email = itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-setup-email"]
-				var env []map[string]string
-				json.Unmarshal([]byte(itemRestructured.ObjectMeta.Annotations["io.sharing.pair-spec-setup-env"]), &env)
-				instances[i].Spec.Setup.Env = env
-				instances[i].Status.Resources.Cluster = itemRestructured.Status
 
-				tmateSSH, err := KubernetesGetTmateSSHSession(clientset, instances[i].Spec.Name, instances[i].Spec.Setup.UserLowercase)
-				if err != nil {
-					log.Printf("err: %#v\n", err.Error())
-				}
 				instances[i].Status.Phase = InstanceStatusPhaseProvisioning
 				if instances[i].Status.Resources.Cluster.Phase == string(InstanceStatusPhaseDeleting) {
 					instances[i].Status.Phase = InstanceStatusPhaseDeleting
-				} else if firstSnippit := strings.Split(tmateSSH, " "); firstSnippit[0] == "ssh" {
-					instances[i].Status.Phase = InstanceStatusPhaseProvisioned
+				} else if itemRestructured.ObjectMeta.Annotations[instanceHibernatedAtAnnotation] != "" {
+					instances[i].Status.Phase = InstanceStatusPhaseHibernated
+				} else {
+					tmateSSH, err := KubernetesGetTmateSSHSession(clientset, instances[i].Spec.Name, instances[i].Spec.Setup.UserLowercase)
+					if err != nil {
+						log.Printf("err: %#v\n", err.Error())
+					}
+					if firstSnippit := strings.Split(tmateSSH, " "); firstSnippit[0] == "ssh" {
+						instances[i].Status.Phase = InstanceStatusPhaseProvisioned
+					}
 				}
 				log.Printf("Instance '%v' is at phase '%v'", instances[i].Spec.Name, instances[i].Status.Phase)
+				instances[i].Status.ExpiresIn = InstanceRemainingLifetime(instances[i].Spec)
 				break instances3
 			}
 		}
@@ -365,231 +344,171 @@ func KubernetesList(kubernetesClientset dynamic.Interface, clientset *kubernetes
 
 // KubernetesCreate ...
 // create a Kubernetes Instance
-func KubernetesCreate(instance InstanceSpec, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, options InstanceCreateOptions) (instanceCreated InstanceSpec, err error) {
+func KubernetesCreate(instance InstanceSpec, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, options InstanceCreateOptions) (instanceCreated InstanceSpec, manifests InstanceManifests, err error) {
 	// generate name
 	targetNamespace := common.GetTargetNamespace()
-	if instance.KubernetesNodeCount > 3 {
-		instance.KubernetesNodeCount = 3
+	if max := GetInstanceMaxKubernetesNodeCount(); instance.KubernetesNodeCount > max {
+		instance.KubernetesNodeCount = max
 	} else if instance.KubernetesNodeCount < 0 {
 		instance.KubernetesNodeCount = 0
 	}
 	newInstance, err := KubernetesTemplateResources(instance, targetNamespace)
 	if err != nil {
-		return instanceCreated, err
+		return instanceCreated, manifests, err
 	}
 	instanceCreated = instance
 
-	log.Printf("%#v\n", newInstance)
+	log.Printf("%v\n", RedactSetupValues(fmt.Sprintf("%#v", newInstance), instance))
 
 	if options.DryRun == true {
 		log.Println("Exiting before create due to dry run")
 		postKubeadmCommandYAML, _ := yaml.Marshal(newInstance.KubeadmControlPlane.Spec.KubeadmConfigSpec.PostKubeadmCommands)
-		log.Printf("%v\n\n%#v", string(postKubeadmCommandYAML), instance)
-		return instanceCreated, err
-	}
-
-	// manifests
-	//   - newInstance.KubeadmControlPlane
-	groupVersionResource := schema.GroupVersionResource{Version: "v1alpha3", Group: "controlplane.cluster.x-k8s.io", Resource: "kubeadmcontrolplanes"}
-	log.Printf("%#v\n", groupVersionResource)
-	asUnstructured, err := common.ObjectToUnstructured(newInstance.KubeadmControlPlane)
-	asUnstructured.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1alpha3", Group: "controlplane.cluster.x-k8s.io", Kind: "KubeadmControlPlane"})
-	_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Create(context.TODO(), asUnstructured, metav1.CreateOptions{})
-	if err != nil && apierrors.IsAlreadyExists(err) != true {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to create KubeadmControlPlane, %#v", err)
-	}
-	if apierrors.IsAlreadyExists(err) {
-		log.Println("Already exists")
+		log.Printf("%v\n\n%#v", RedactSetupValues(string(postKubeadmCommandYAML), instance), RedactSetupSpec(instance))
+		manifests, err = KubernetesRenderManifests(instance, newInstance)
+		return instanceCreated, manifests, err
 	}
 
-	//   - newInstance.PacketMachineTemplate
-	groupVersion := clusterAPIv1alpha3.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetmachinetemplates"}
-	log.Printf("%#v\n", groupVersionResource)
-	asUnstructured, err = common.ObjectToUnstructured(newInstance.PacketMachineTemplate)
-	asUnstructured.SetGroupVersionKind(schema.GroupVersionKind{Version: groupVersionResource.Version, Group: "infrastructure.cluster.x-k8s.io", Kind: "PacketMachineTemplate"})
-	if err != nil {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to unstructure PacketMachineTemplate, %#v", err)
-	}
-	_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Create(context.TODO(), asUnstructured, metav1.CreateOptions{})
-	if err != nil && apierrors.IsAlreadyExists(err) != true {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to create PacketMachineTemplate, %#v", err)
-	}
-	if apierrors.IsAlreadyExists(err) {
-		log.Println("Already exists")
+	if instance.Setup.RestoreBackup != "" {
+		newInstance.Cluster.ObjectMeta.Annotations[instanceHomeRestoreAnnotation] = time.Now().UTC().Format(time.RFC3339)
 	}
-
-	//   - newInstance.PacketCluster
-	groupVersion = clusterAPIPacketv1alpha3.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetclusters"}
-	log.Printf("%#v\n", groupVersionResource)
-	asUnstructured, err = common.ObjectToUnstructured(newInstance.PacketCluster)
-	asUnstructured.SetGroupVersionKind(schema.GroupVersionKind{Version: groupVersionResource.Version, Group: "infrastructure.cluster.x-k8s.io", Kind: "PacketCluster"})
+	// NOTE the GitHub OAuth token and env are kept out of the bootstrap commands, which are readable in the KubeadmControlPlane
+	newInstance.SetupSecret, err = templateSetupSecret(instance, nil)
 	if err != nil {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to unstructure PacketCluster, %#v", err)
-	}
-	_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Create(context.TODO(), asUnstructured, metav1.CreateOptions{})
-	if err != nil && apierrors.IsAlreadyExists(err) != true {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to create PacketCluster, %#v", err)
-	}
-	if apierrors.IsAlreadyExists(err) {
-		log.Println("Already exists")
+		return instanceCreated, manifests, err
 	}
-
-	//   - newInstance.Cluster
-	groupVersion = clusterAPIv1alpha3.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "clusters"}
-	log.Printf("%#v\n", groupVersionResource)
-	asUnstructured, err = common.ObjectToUnstructured(newInstance.Cluster)
-	asUnstructured.SetGroupVersionKind(schema.GroupVersionKind{Version: groupVersionResource.Version, Group: "cluster.x-k8s.io", Kind: "Cluster"})
+	newInstance.PairInstance = pairInstanceWithOwner(newInstance.PairInstance, options.Groups, options.Admin)
+	err = createInstanceResources(dynamicClient, targetNamespace, KubernetesInstanceResources(newInstance))
 	if err != nil {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to unstructure Cluster, %#v", err)
-	}
-	_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Create(context.TODO(), asUnstructured, metav1.CreateOptions{})
-	if err != nil && apierrors.IsAlreadyExists(err) != true {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to create Cluster, %#v", err)
-	}
-	if apierrors.IsAlreadyExists(err) {
-		log.Println("Already exists")
+		return instanceCreated, manifests, err
 	}
 
-	//   - newInstance.MachineDeploymentWorker
-	groupVersion = clusterAPIv1alpha3.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "machinedeployments"}
-	log.Printf("%#v\n", groupVersionResource)
-	asUnstructured, err = common.ObjectToUnstructured(newInstance.MachineDeploymentWorker)
-	asUnstructured.SetGroupVersionKind(schema.GroupVersionKind{Version: groupVersionResource.Version, Group: "cluster.x-k8s.io", Kind: "MachineDeployment"})
-	if err != nil {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to unstructure MachineDeployment, %#v", err)
-	}
-	_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Create(context.TODO(), asUnstructured, metav1.CreateOptions{})
-	if err != nil && apierrors.IsAlreadyExists(err) != true {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to create MachineDeployment, %#v", err)
-	}
-	if apierrors.IsAlreadyExists(err) {
-		log.Println("Already exists")
-	}
+	// TODO return the same creation fields (repos, guests, etc...)
+	return instanceCreated, manifests, nil
+}
 
-	//   - newInstance.KubeadmConfigTemplateWorker
-	groupVersion = cabpkv1.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "bootstrap.cluster.x-k8s.io", Resource: "kubeadmconfigtemplates"}
-	log.Printf("%#v\n", groupVersionResource)
-	asUnstructured, err = common.ObjectToUnstructured(newInstance.KubeadmConfigTemplateWorker)
-	asUnstructured.SetGroupVersionKind(schema.GroupVersionKind{Version: groupVersionResource.Version, Group: groupVersionResource.Group, Kind: "KubeadmConfigTemplate"})
-	if err != nil {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to unstructure KubeadmConfigTemplate, %#v", err)
-	}
-	_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Create(context.TODO(), asUnstructured, metav1.CreateOptions{})
-	if err != nil && apierrors.IsAlreadyExists(err) != true {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to create KubeadmConfigTemplate, %#v", err)
-	}
-	if apierrors.IsAlreadyExists(err) {
-		log.Println("Already exists")
-	}
+// KubernetesUpdate ...
+// update the mutable fields of a Kubernetes instance, and the resources which they're used in
+func KubernetesUpdate(instance InstanceSpec, dynamicClient dynamic.Interface) (instanceUpdated InstanceSpec, err error) {
+	targetNamespace := common.GetTargetNamespace()
 
-	//   - newInstance.PacketMachineTemplateWorker
-	groupVersion = clusterAPIv1alpha3.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetmachinetemplates"}
+	//   - newInstance.WorkerPools MachineDeployments
+	groupVersion := clusterAPIv1beta1.GroupVersion
+	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "machinedeployments"}
 	log.Printf("%#v\n", groupVersionResource)
-	asUnstructured, err = common.ObjectToUnstructured(newInstance.PacketMachineTemplateWorker)
-	asUnstructured.SetGroupVersionKind(schema.GroupVersionKind{Version: groupVersionResource.Version, Group: "infrastructure.cluster.x-k8s.io", Kind: "PacketMachineTemplate"})
-	if err != nil {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to unstructure PacketMachineTemplateWorker, %#v", err)
-	}
-	_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Create(context.TODO(), asUnstructured, metav1.CreateOptions{})
-	if err != nil && apierrors.IsAlreadyExists(err) != true {
-		log.Printf("%#v\n", err)
-		return instanceCreated, fmt.Errorf("Failed to create PacketMachineTemplateWorker, %#v", err)
-	}
-	if apierrors.IsAlreadyExists(err) {
-		log.Println("Already exists")
+	for _, pool := range InstanceWorkerPools(instance) {
+		item, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), workerPoolResourceName(instance.Name, pool.Name), metav1.GetOptions{})
+		if err != nil {
+			log.Printf("%#v\n", err)
+			return InstanceSpec{}, fmt.Errorf("Failed to get MachineDeployment of worker pool '%v', %#v", pool.Name, err)
+		}
+		err = unstructured.SetNestedField(item.Object, int64(pool.Count), "spec", "replicas")
+		if err != nil {
+			return InstanceSpec{}, fmt.Errorf("Failed to set MachineDeployment replicas, %#v", err)
+		}
+		_, err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Update(context.TODO(), item, metav1.UpdateOptions{})
+		if err != nil {
+			log.Printf("%#v\n", err)
+			return InstanceSpec{}, fmt.Errorf("Failed to update MachineDeployment of worker pool '%v', %#v", pool.Name, err)
+		}
 	}
 
-	// TODO return the same creation fields (repos, guests, etc...)
-	return instanceCreated, nil
-}
-
-// KubernetesUpdate ...
-// update a Kubernetes instance
-func KubernetesUpdate(instance InstanceSpec) (instanceUpdated InstanceSpec, err error) {
-	return instanceUpdated, nil
+	return instance, nil
 }
 
 // KubernetesDelete ...
 // delete a Kubernetes instance
-func KubernetesDelete(name string, kubernetesClientset dynamic.Interface) (err error) {
+func KubernetesDelete(name string, kubernetesClientset dynamic.Interface, clientset *kubernetes.Clientset) (err error) {
 	// generate name
 	targetNamespace := common.GetTargetNamespace()
 
 	// manifests
 
-	//   - newInstance.PacketMachineTemplate
-	groupVersion := clusterAPIv1alpha3.GroupVersion
-	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetmachinetemplates"}
-	log.Printf("%#v\n", groupVersionResource)
-	err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
-	if err != nil && apierrors.IsNotFound(err) != true {
-		log.Printf("%#v\n", err)
-		return fmt.Errorf("Failed to delete PacketMachineTemplate, %#v", err)
+	//   - home directory backup
+	// NOTE an instance is deleted even if it's home directory can't be backed up, such as when it's Environment is broken
+	if common.ObjectStorageEnabled() == true {
+		_, err = KubernetesBackupHome(name, clientset, kubernetesClientset)
+		if err != nil {
+			log.Printf("Failed to back up home directory of instance '%v' before deleting it, %v\n", name, err)
+		}
 	}
 
-	//   - newInstance.KubeadmConfigTemplateWorker
-	groupVersion = cabpkv1.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "bootstrap.cluster.x-k8s.io", Resource: "kubeadmconfigtemplates"}
-	log.Printf("%#v\n", groupVersionResource)
-	err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).Delete(context.TODO(), fmt.Sprintf("%s-worker-a", name), metav1.DeleteOptions{})
-	if err != nil && apierrors.IsNotFound(err) != true {
-		log.Printf("%#v\n", err)
-		return fmt.Errorf("Failed to delete KubeadmConfigTemplate, %#v", err)
+	// NOTE usage isn't recorded again once the Cluster is deleting
+	err = RecordInstanceUsage(name, kubernetesClientset)
+	if err != nil {
+		return err
 	}
 
-	//   - newInstance.PacketMachineTemplateWorker
-	groupVersion = clusterAPIv1alpha3.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetmachinetemplates"}
-	log.Printf("%#v\n", groupVersionResource)
-	err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).Delete(context.TODO(), fmt.Sprintf("%s-worker-a", name), metav1.DeleteOptions{})
+	instance, err := GetSpec(name, kubernetesClientset)
+	if err != nil {
+		return err
+	}
+	instance.Name = name
+	infrastructureQueries := GetInfrastructureProvider().KubernetesResourceQueries(instance)
+
+	//   - newInstance.KubeadmControlPlane
+	// NOTE a hibernated instance's control plane is paused, which must be unpaused to be deleted with it's Cluster
+	err = setResourceAnnotation(kubernetesClientset, clusterAPIControlPlaneKubeadmv1beta1.GroupVersion.WithResource("kubeadmcontrolplanes"), name+"-control-plane", clusterAPIv1beta1.PausedAnnotation, "")
 	if err != nil && apierrors.IsNotFound(err) != true {
-		log.Printf("%#v\n", err)
-		return fmt.Errorf("Failed to delete PacketMachineTemplateWorker, %#v", err)
+		return err
+	}
+
+	//   - home directory snapshot
+	err = deleteHomeSnapshot(kubernetesClientset, name)
+	if err != nil {
+		return err
 	}
 
-	//   - newInstance.PacketMachine
-	groupVersion = clusterAPIv1alpha3.GroupVersion
-	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetmachines"}
+	//   - setup Secret
+	err = deleteSetupSecret(kubernetesClientset, name)
+	if err != nil {
+		return err
+	}
+
+	//   - newInstance.Infrastructure machine templates
+	for _, query := range infrastructureQueries.MachineTemplates {
+		log.Printf("%#v\n", query.GroupVersionResource)
+		err = kubernetesClientset.Resource(common.ClusterAPIServedResource(query.GroupVersionResource)).Namespace(targetNamespace).Delete(context.TODO(), query.Name, metav1.DeleteOptions{})
+		if err != nil && apierrors.IsNotFound(err) != true {
+			log.Printf("%#v\n", err)
+			return fmt.Errorf("Failed to delete %v '%v', %#v", query.GroupVersionResource.Resource, query.Name, err)
+		}
+	}
+
+	//   - newInstance.WorkerPools KubeadmConfigTemplates
+	groupVersion := cabpkv1beta1.GroupVersion
+	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "bootstrap.cluster.x-k8s.io", Resource: "kubeadmconfigtemplates"}
 	log.Printf("%#v\n", groupVersionResource)
-	err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/cluster-name=" + name})
+	for _, pool := range InstanceWorkerPools(instance) {
+		err = kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Delete(context.TODO(), workerPoolResourceName(name, pool.Name), metav1.DeleteOptions{})
+		if err != nil && apierrors.IsNotFound(err) != true {
+			log.Printf("%#v\n", err)
+			return fmt.Errorf("Failed to delete KubeadmConfigTemplate, %#v", err)
+		}
+	}
+
+	//   - newInstance.Infrastructure machines
+	log.Printf("%#v\n", infrastructureQueries.Machines.GroupVersionResource)
+	err = kubernetesClientset.Resource(common.ClusterAPIServedResource(infrastructureQueries.Machines.GroupVersionResource)).Namespace(targetNamespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: infrastructureQueries.Machines.LabelSelector})
 	if err != nil && apierrors.IsNotFound(err) != true {
 		log.Printf("%#v\n", err)
-		return fmt.Errorf("Failed to delete PacketMachine, %#v", err)
+		return fmt.Errorf("Failed to delete %v, %#v", infrastructureQueries.Machines.GroupVersionResource.Resource, err)
 	}
 
 	//   - newInstance.Machine
-	groupVersion = clusterAPIv1alpha3.GroupVersion
+	groupVersion = clusterAPIv1beta1.GroupVersion
 	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "machines"}
 	log.Printf("%#v\n", groupVersionResource)
-	err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/cluster-name=" + name})
+	err = kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/cluster-name=" + name})
 	if err != nil && apierrors.IsNotFound(err) != true {
 		log.Printf("%#v\n", err)
-		return fmt.Errorf("Failed to delete PacketMachine, %#v", err)
+		return fmt.Errorf("Failed to delete Machine, %#v", err)
 	}
 
 	//   - newInstance.Cluster
-	groupVersion = clusterAPIv1alpha3.GroupVersion
+	groupVersion = clusterAPIv1beta1.GroupVersion
 	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "clusters"}
 	log.Printf("%#v\n", groupVersionResource)
-	err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	err = kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
 	if err != nil && apierrors.IsNotFound(err) != true {
 		log.Printf("%#v\n", err)
 		return fmt.Errorf("Failed to delete Cluster, %#v", err)
@@ -597,7 +516,7 @@ func KubernetesDelete(name string, kubernetesClientset dynamic.Interface) (err e
 	//   - newInstance.DNSEndpoint
 	groupVersionResource = schema.GroupVersionResource{Version: "v1alpha1", Group: "externaldns.k8s.io", Resource: "dnsendpoints"}
 	log.Printf("%#v\n", groupVersionResource)
-	err = kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: "io.sharing.pair-spec-name=" + name})
+	err = kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: "io.sharing.pair-spec-name=" + name})
 	if err != nil && apierrors.IsNotFound(err) != true {
 		log.Printf("%#v\n", err)
 		return fmt.Errorf("Failed to delete DNSEndpoint, %#v", err)
@@ -618,19 +537,6 @@ func KubernetesTemplateResources(instance InstanceSpec, namespace string) (newIn
 	instance.Setup.KubernetesVersion = common.ReturnValueOrDefault(instance.Setup.KubernetesVersion, GetKubernetesVersion())
 	instance = UpdateInstanceSpecIfEnvOverrides(instance)
 
-	var sshKeys []string
-	for _, account := range append(instance.Setup.Guests, instance.Setup.User) {
-		log.Printf("Fetching SSH key for '%v'\n", account)
-		if account == "" {
-			continue
-		}
-		githubSSHKeys, err := GetGitHubUserSSHKeys(account)
-		if err != nil {
-			log.Printf("Error getting SSH keys: %v\n", err.Error())
-			sshKeys = []string{}
-		}
-		sshKeys = append(sshKeys, githubSSHKeys...)
-	}
 	instance.Setup.BaseDNSName = instance.Name + "." + common.GetBaseHost()
 	instance.Setup.GuestsNamesFlat = strings.Join(instance.Setup.Guests, " ")
 	tmpl, err := template.New(fmt.Sprintf("pair-instance-template-pre-%s-%v", instance.Name, time.Now().Unix())).Parse(`
@@ -685,24 +591,29 @@ cd /root/.sharing.io/cluster-api
 bash -x ./preKubeadmCommands.sh
 `
 
-	tmpl, err = template.New(fmt.Sprintf("packetcloudconfigsecret%s%v", instance.Name, time.Now().Unix())).Parse(`
-cat << EOF >> /root/.sharing-io-pair-init.env
-export EQUINIX_METAL_PROJECT={{ .PacketProjectID }}
-EOF`)
+	provider := GetInfrastructureProvider()
+	infrastructure, err := provider.KubernetesInfrastructure(instance, namespace)
 	if err != nil {
-		log.Printf("%#v\n", err)
-		return newInstance, fmt.Errorf("Error templating packetcloudconfigsecret command: %#v", err)
+		return newInstance, err
 	}
-	templatedBuffer = new(bytes.Buffer)
-	err = tmpl.Execute(templatedBuffer, map[string]interface{}{
-		"PacketProjectID":      common.GetPacketProjectID(),
-		"controlPlaneEndpoint": "{{ .controlPlaneEndpoint }}",
-	})
+	infrastructureClusterRef := infrastructure.Cluster.objectReference()
+	kubeletExtraArgs := provider.KubeletExtraArgs()
+	controlPlanePre, err := provider.PreKubeadmCommands(nodeTypeControlPlane)
+	if err != nil {
+		return newInstance, err
+	}
+	controlPlanePost, err := provider.PostKubeadmCommands(nodeTypeControlPlane)
+	if err != nil {
+		return newInstance, err
+	}
+	workerPre, err := provider.PreKubeadmCommands(nodeTypeWorker)
+	if err != nil {
+		return newInstance, err
+	}
+	workerPost, err := provider.PostKubeadmCommands(nodeTypeWorker)
 	if err != nil {
-		log.Printf("%#v\n", err.Error())
-		return newInstance, fmt.Errorf("Error templating packetcloudconfigsecret command: %#v", err)
+		return newInstance, err
 	}
-	kubeadmPost1 := templatedBuffer.String()
 
 	tmpl, err = template.New(fmt.Sprintf("pair-instance-template-post-%s-%v", instance.Name, time.Now().Unix())).Parse(`
 cat << EOF >> /root/.sharing-io-pair-init.env
@@ -717,19 +628,26 @@ export SHARINGIO_PAIR_INSTANCE_ENVIRONMENT_VERSION="{{ $.Setup.EnvironmentVersio
 export SHARINGIO_PAIR_INSTANCE_SETUP_TIMEZONE="{{ $.Setup.Timezone }}"
 export SHARINGIO_PAIR_INSTANCE_SETUP_FULLNAME="{{ $.Setup.Fullname }}"
 export SHARINGIO_PAIR_INSTANCE_SETUP_EMAIL="{{ $.Setup.Email }}"
-export SHARINGIO_PAIR_INSTANCE_SETUP_GITHUBOAUTHTOKEN="{{ $.Setup.GitHubOAuthToken }}"
 export SHARINGIO_PAIR_INSTANCE_SETUP_REPOS="{{ range $.Setup.Repos }}{{ . }} {{ end }}"
 export SHARINGIO_PAIR_INSTANCE_SETUP_REPOS_EXPANDED="
         {{ range $.Setup.Repos }}- {{ . }}
         {{ end }}
 "
-export SHARINGIO_PAIR_INSTANCE_SETUP_ENV_EXPANDED="
-      {{- if $.Setup.Env }}{{ range $index, $map := $.Setup.Env }}{{ range $key, $value := $map }}
-            - name: \"{{ $key }}\"
-              value: \"{{ $value }}\"       {{ end }}{{ end }}{{- end }}
-"
 EOF
 
+# the GitHub OAuth token and env are delivered in a Secret by cluster-api-manager, which is read once
+for i in $(seq 120); do
+  kubectl --kubeconfig /etc/kubernetes/admin.conf -n kube-system get secret sharingio-pair-setup >/dev/null 2>&1 && break
+  sleep 5
+done
+if ! kubectl --kubeconfig /etc/kubernetes/admin.conf -n kube-system get secret sharingio-pair-setup >/dev/null 2>&1; then
+  echo "error: the sharingio-pair-setup Secret wasn't delivered within 10 minutes, unable to set up the instance without it's GitHub OAuth token and env" >&2
+  exit 1
+fi
+kubectl --kubeconfig /etc/kubernetes/admin.conf -n kube-system get secret sharingio-pair-setup -o jsonpath='{.data.setup\.env}' \
+  | base64 -d >> /root/.sharing-io-pair-init.env
+kubectl --kubeconfig /etc/kubernetes/admin.conf -n kube-system delete secret sharingio-pair-setup
+
 . /root/.sharing-io-pair-init.env
 
 cd /root/.sharing.io/cluster-api
@@ -751,30 +669,119 @@ bash -x ./postKubeadmCommands.sh
 	templatedBuffer = nil
 	tmpl = nil
 
+	// each pool of worker nodes has it's own MachineDeployment and templates
+	workerPool := func(pool InstanceWorkerPool, machineTemplate instanceResource) KubernetesWorkerPool {
+		resourceName := workerPoolResourceName(instance.Name, pool.Name)
+		annotations := func() map[string]string {
+			return map[string]string{
+				"cluster.x-k8s.io/cluster-name":   instance.Name,
+				"io.sharing.pair-spec-name":       instance.Name,
+				"io.sharing.pair-spec-setup-user": instance.Setup.User,
+			}
+		}
+		return KubernetesWorkerPool{
+			MachineDeployment: clusterAPIv1beta1.MachineDeployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: namespace,
+					Labels: map[string]string{
+						"pool":            "worker-" + pool.Name,
+						"io.sharing.pair": "instance",
+					},
+					Annotations: annotations(),
+				},
+				Spec: clusterAPIv1beta1.MachineDeploymentSpec{
+					Replicas:    Int32ToInt32Pointer(int32(pool.Count)),
+					ClusterName: instance.Name,
+					Selector: metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"pool":                          "worker-" + pool.Name,
+							"cluster.x-k8s.io/cluster-name": instance.Name,
+						},
+					},
+					Template: clusterAPIv1beta1.MachineTemplateSpec{
+						ObjectMeta: clusterAPIv1beta1.ObjectMeta{
+							Labels: map[string]string{
+								"io.sharing.pair": "instance",
+								"pool":            "worker-" + pool.Name,
+							},
+							Annotations: annotations(),
+						},
+						Spec: clusterAPIv1beta1.MachineSpec{
+							Version:     &instance.Setup.KubernetesVersion,
+							ClusterName: instance.Name,
+							Bootstrap: clusterAPIv1beta1.Bootstrap{
+								ConfigRef: &corev1.ObjectReference{
+									APIVersion: servedAPIVersion(cabpkv1beta1.GroupVersion),
+									Kind:       "KubeadmConfigTemplate",
+									Name:       resourceName,
+								},
+							},
+							InfrastructureRef: machineTemplate.objectReference(),
+						},
+					},
+				},
+			},
+			KubeadmConfigTemplate: cabpkv1beta1.KubeadmConfigTemplate{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: namespace,
+					Labels:    map[string]string{"io.sharing.pair": "instance"},
+					Annotations: map[string]string{
+						"io.sharing.pair-spec-name":       instance.Name,
+						"io.sharing.pair-spec-setup-user": instance.Setup.User,
+					},
+				},
+				Spec: cabpkv1beta1.KubeadmConfigTemplateSpec{
+					Template: cabpkv1beta1.KubeadmConfigTemplateResource{
+						Spec: cabpkv1beta1.KubeadmConfigSpec{
+							PreKubeadmCommands: append(append([]string{
+								`set -x`,
+								`
+export SHARINGIO_PAIR_INSTANCE_NODE_TYPE=worker
+`,
+							}, workerPre...),
+								kubeadmPre2,
+								"apt-get -y update",
+								"DEBIAN_FRONTEND=noninteractive apt-get install -y git",
+								kubeadmPre5,
+							),
+							PostKubeadmCommands: workerPost,
+							JoinConfiguration: &cabpkv1beta1.JoinConfiguration{
+								NodeRegistration: cabpkv1beta1.NodeRegistrationOptions{
+									KubeletExtraArgs: workerPoolKubeletExtraArgs(kubeletExtraArgs, pool),
+									Taints:           pool.Taints,
+								},
+							},
+						},
+					},
+				},
+			},
+			MachineTemplate: machineTemplate,
+		}
+	}
+
 	defaultKubernetesClusterConfig := KubernetesCluster{
-		KubeadmControlPlane: clusterAPIControlPlaneKubeadmv1alpha3.KubeadmControlPlane{
+		KubeadmControlPlane: clusterAPIControlPlaneKubeadmv1beta1.KubeadmControlPlane{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:   "",
 				Labels: map[string]string{"io.sharing.pair": "instance"},
 			},
-			Spec: clusterAPIControlPlaneKubeadmv1alpha3.KubeadmControlPlaneSpec{
+			Spec: clusterAPIControlPlaneKubeadmv1beta1.KubeadmControlPlaneSpec{
 				Version:  instance.Setup.KubernetesVersion,
 				Replicas: Int32ToInt32Pointer(1),
-				InfrastructureTemplate: corev1.ObjectReference{
-					APIVersion: "infrastructure.cluster.x-k8s.io/v1alpha3",
-					Kind:       "PacketMachineTemplate",
+				MachineTemplate: clusterAPIControlPlaneKubeadmv1beta1.KubeadmControlPlaneMachineTemplate{
+					InfrastructureRef: infrastructure.MachineTemplate.objectReference(),
 				},
-				KubeadmConfigSpec: cabpkv1.KubeadmConfigSpec{
-					InitConfiguration: &upstreamv1beta1.InitConfiguration{
-						NodeRegistration: upstreamv1beta1.NodeRegistrationOptions{
-							KubeletExtraArgs: map[string]string{
-								"cloud-provider": "external",
-							},
+				KubeadmConfigSpec: cabpkv1beta1.KubeadmConfigSpec{
+					InitConfiguration: &cabpkv1beta1.InitConfiguration{
+						NodeRegistration: cabpkv1beta1.NodeRegistrationOptions{
+							KubeletExtraArgs: kubeletExtraArgs,
 						},
 					},
-					ClusterConfiguration: &upstreamv1beta1.ClusterConfiguration{
-						APIServer: upstreamv1beta1.APIServer{
-							ControlPlaneComponent: upstreamv1beta1.ControlPlaneComponent{
+					ClusterConfiguration: &cabpkv1beta1.ClusterConfiguration{
+						APIServer: cabpkv1beta1.APIServer{
+							ControlPlaneComponent: cabpkv1beta1.ControlPlaneComponent{
 								ExtraArgs: map[string]string{
 									"cloud-provider":            "external",
 									"audit-policy-file":         "/etc/kubernetes/pki/audit-policy.yaml",
@@ -784,183 +791,63 @@ bash -x ./postKubeadmCommands.sh
 								},
 							},
 						},
-						ControllerManager: upstreamv1beta1.ControlPlaneComponent{
+						ControllerManager: cabpkv1beta1.ControlPlaneComponent{
 							ExtraArgs: map[string]string{
 								"cloud-provider": "external",
 							},
 						},
 					},
-					JoinConfiguration: &upstreamv1beta1.JoinConfiguration{
-						NodeRegistration: upstreamv1beta1.NodeRegistrationOptions{
-							KubeletExtraArgs: map[string]string{
-								"cloud-provider": "external",
-							},
+					JoinConfiguration: &cabpkv1beta1.JoinConfiguration{
+						NodeRegistration: cabpkv1beta1.NodeRegistrationOptions{
+							KubeletExtraArgs: kubeletExtraArgs,
 						},
 					},
-					PreKubeadmCommands: []string{
+					PreKubeadmCommands: append(append([]string{
 						`set -x`,
 						`
 cat << EOF >> /root/.sharing-io-pair-init.env
-export KUBERNETES_CONTROLPLANE_ENDPOINT={{ .controlPlaneEndpoint }}
 export SHARINGIO_PAIR_INSTANCE_NODE_TYPE=control-plane
 EOF`,
+					}, controlPlanePre...),
 						kubeadmPre2,
 						"apt-get -y update",
 						"DEBIAN_FRONTEND=noninteractive apt-get install -y git",
 						kubeadmPre5,
-					},
-					PostKubeadmCommands: []string{
+					),
+					PostKubeadmCommands: append(append([]string{
 						`set -x`,
-						kubeadmPost1,
+					}, controlPlanePost...),
 						kubeadmPost2,
-					},
+					),
 				},
 			},
 		},
-		Cluster: clusterAPIv1alpha3.Cluster{
+		Cluster: clusterAPIv1beta1.Cluster{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:   "",
 				Labels: map[string]string{"io.sharing.pair": "instance"},
 			},
-			Spec: clusterAPIv1alpha3.ClusterSpec{
-				ClusterNetwork: &clusterAPIv1alpha3.ClusterNetwork{
-					Pods: &clusterAPIv1alpha3.NetworkRanges{
+			Spec: clusterAPIv1beta1.ClusterSpec{
+				ClusterNetwork: &clusterAPIv1beta1.ClusterNetwork{
+					Pods: &clusterAPIv1beta1.NetworkRanges{
 						CIDRBlocks: []string{
 							"10.244.0.0/16",
 						},
 					},
-					Services: &clusterAPIv1alpha3.NetworkRanges{
+					Services: &clusterAPIv1beta1.NetworkRanges{
 						CIDRBlocks: []string{
 							"10.96.0.0/12",
 						},
 					},
 				},
-				InfrastructureRef: &corev1.ObjectReference{
-					APIVersion: "infrastructure.cluster.x-k8s.io/v1alpha3",
-					Kind:       "PacketCluster",
-				},
+				InfrastructureRef: &infrastructureClusterRef,
 				ControlPlaneRef: &corev1.ObjectReference{
-					APIVersion: "controlplane.cluster.x-k8s.io/v1alpha3",
+					APIVersion: servedAPIVersion(clusterAPIControlPlaneKubeadmv1beta1.GroupVersion),
 					Kind:       "KubeadmControlPlane",
 				},
 			},
 		},
-		MachineDeploymentWorker: clusterAPIv1alpha3.MachineDeployment{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "",
-				Labels: map[string]string{
-					"pool":            "worker-a",
-					"io.sharing.pair": "instance",
-				},
-			},
-			Spec: clusterAPIv1alpha3.MachineDeploymentSpec{
-				Replicas:    Int32ToInt32Pointer(int32(instance.KubernetesNodeCount)),
-				ClusterName: "",
-				Selector: metav1.LabelSelector{
-					MatchLabels: map[string]string{
-						"pool": "worker-a",
-					},
-				},
-				Template: clusterAPIv1alpha3.MachineTemplateSpec{
-					ObjectMeta: clusterAPIv1alpha3.ObjectMeta{
-						Name: "",
-						Labels: map[string]string{
-							"io.sharing.pair": "instance",
-							"pool":            "worker-a",
-						},
-					},
-					Spec: clusterAPIv1alpha3.MachineSpec{
-						Version:     &instance.Setup.KubernetesVersion,
-						ClusterName: "",
-						Bootstrap: clusterAPIv1alpha3.Bootstrap{
-							ConfigRef: &corev1.ObjectReference{
-								APIVersion: "bootstrap.cluster.x-k8s.io/v1alpha3",
-								Kind:       "KubeadmConfigTemplate",
-							},
-						},
-						InfrastructureRef: corev1.ObjectReference{
-							APIVersion: "infrastructure.cluster.x-k8s.io/v1alpha3",
-							Kind:       "PacketMachineTemplate",
-						},
-					},
-				},
-			},
-		},
-		KubeadmConfigTemplateWorker: cabpkv1.KubeadmConfigTemplate{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:   "",
-				Labels: map[string]string{"io.sharing.pair": "instance"},
-			},
-			Spec: cabpkv1.KubeadmConfigTemplateSpec{
-				Template: cabpkv1.KubeadmConfigTemplateResource{
-					Spec: cabpkv1.KubeadmConfigSpec{
-						PreKubeadmCommands: []string{
-							`set -x`,
-							`
-cat << EOF >> /root/.sharing-io-pair-init.env
-export SHARINGIO_PAIR_INSTANCE_NODE_TYPE=worker
-EOF`,
-							kubeadmPre2,
-							"apt-get -y update",
-							"DEBIAN_FRONTEND=noninteractive apt-get install -y git",
-							kubeadmPre5,
-						},
-						JoinConfiguration: &upstreamv1beta1.JoinConfiguration{
-							NodeRegistration: upstreamv1beta1.NodeRegistrationOptions{
-								KubeletExtraArgs: map[string]string{
-									"cloud-provider": "external",
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-		PacketMachineTemplate: clusterAPIPacketv1alpha3.PacketMachineTemplate{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:   "",
-				Labels: map[string]string{"io.sharing.pair": "instance"},
-			},
-			Spec: clusterAPIPacketv1alpha3.PacketMachineTemplateSpec{
-				Template: clusterAPIPacketv1alpha3.PacketMachineTemplateResource{
-					Spec: clusterAPIPacketv1alpha3.PacketMachineSpec{
-						OS:           instance.NodeOS,
-						BillingCycle: "hourly",
-						// 1 = machine type
-						MachineType: "",
-						SshKeys:     sshKeys,
-					},
-				},
-			},
-		},
-		PacketCluster: clusterAPIPacketv1alpha3.PacketCluster{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:   "",
-				Labels: map[string]string{"io.sharing.pair": "instance"},
-			},
-			Spec: clusterAPIPacketv1alpha3.PacketClusterSpec{
-				ControlPlaneEndpoint: clusterAPIv1alpha3.APIEndpoint{
-					Host: "sharing.io",
-					Port: 6443,
-				},
-			},
-		},
-		PacketMachineTemplateWorker: clusterAPIPacketv1alpha3.PacketMachineTemplate{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:   "",
-				Labels: map[string]string{"io.sharing.pair": "instance"},
-			},
-			Spec: clusterAPIPacketv1alpha3.PacketMachineTemplateSpec{
-				Template: clusterAPIPacketv1alpha3.PacketMachineTemplateResource{
-					Spec: clusterAPIPacketv1alpha3.PacketMachineSpec{
-						OS:           instance.NodeOS,
-						BillingCycle: "hourly",
-						// 1 = machine type
-						MachineType: "",
-					},
-				},
-			},
-		},
+		Infrastructure: infrastructure,
 	}
 	newInstance = defaultKubernetesClusterConfig
 	newInstance.KubeadmControlPlane.ObjectMeta.Name = instance.Name + "-control-plane"
@@ -968,87 +855,113 @@ EOF`,
 	newInstance.KubeadmControlPlane.ObjectMeta.Annotations = map[string]string{}
 	newInstance.KubeadmControlPlane.ObjectMeta.Annotations["io.sharing.pair-spec-name"] = instance.Name
 	newInstance.KubeadmControlPlane.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"] = instance.Setup.User
-	newInstance.KubeadmControlPlane.Spec.InfrastructureTemplate.Name = instance.Name + "-control-plane"
 
-	newInstance.KubeadmConfigTemplateWorker.Spec.Template.Spec.PreKubeadmCommands[1] = `
-export SHARINGIO_PAIR_INSTANCE_NODE_TYPE=worker
-`
-
-	newInstance.PacketMachineTemplate.ObjectMeta.Name = instance.Name + "-control-plane"
-	newInstance.PacketMachineTemplate.ObjectMeta.Namespace = namespace
-	newInstance.PacketMachineTemplate.ObjectMeta.Annotations = map[string]string{}
-	newInstance.PacketMachineTemplate.ObjectMeta.Annotations["io.sharing.pair-spec-name"] = instance.Name
-	newInstance.PacketMachineTemplate.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"] = instance.Setup.User
-	// TODO default value configuration scope - deployment based configuration
-	newInstance.PacketMachineTemplate.Spec.Template.Spec.MachineType = instance.NodeSize
-
-	newInstance.MachineDeploymentWorker.ObjectMeta.Name = instance.Name + "-worker-a"
-	newInstance.MachineDeploymentWorker.ObjectMeta.Namespace = namespace
-	newInstance.MachineDeploymentWorker.ObjectMeta.Annotations = map[string]string{}
-	newInstance.MachineDeploymentWorker.ObjectMeta.Annotations["cluster.x-k8s.io/cluster-name"] = instance.Name
-	newInstance.MachineDeploymentWorker.ObjectMeta.Annotations["io.sharing.pair-spec-name"] = instance.Name
-	newInstance.MachineDeploymentWorker.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"] = instance.Setup.User
-	newInstance.MachineDeploymentWorker.Spec.ClusterName = instance.Name
-	newInstance.MachineDeploymentWorker.Spec.Template.Spec.Bootstrap.ConfigRef.Name = instance.Name + "-worker-a"
-	newInstance.MachineDeploymentWorker.Spec.Selector.MatchLabels["cluster.x-k8s.io/cluster-name"] = instance.Name
-	newInstance.MachineDeploymentWorker.Spec.Template.ObjectMeta.Annotations = map[string]string{}
-	newInstance.MachineDeploymentWorker.Spec.Template.ObjectMeta.Annotations["cluster.x-k8s.io/cluster-name"] = instance.Name
-	newInstance.MachineDeploymentWorker.Spec.Template.ObjectMeta.Annotations["io.sharing.pair-spec-name"] = instance.Name
-	newInstance.MachineDeploymentWorker.Spec.Template.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"] = instance.Setup.User
-	newInstance.MachineDeploymentWorker.Spec.Template.Spec.InfrastructureRef.Name = instance.Name + "-worker-a"
-	newInstance.MachineDeploymentWorker.Spec.Template.Spec.ClusterName = instance.Name
-
-	newInstance.PacketCluster.ObjectMeta.Name = instance.Name
-	newInstance.PacketCluster.ObjectMeta.Namespace = namespace
-	newInstance.PacketCluster.ObjectMeta.Annotations = map[string]string{}
-	newInstance.PacketCluster.ObjectMeta.Annotations["io.sharing.pair-spec-name"] = instance.Name
-	newInstance.PacketCluster.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"] = instance.Setup.User
-	// TODO default value configuration scope - deployment based configuration
-	newInstance.PacketCluster.Spec.ProjectID = common.GetPacketProjectID()
-	newInstance.PacketCluster.Spec.Facility = instance.Facility
+	for i, pool := range InstanceWorkerPools(instance) {
+		newInstance.WorkerPools = append(newInstance.WorkerPools, workerPool(pool, infrastructure.MachineTemplateWorkers[i]))
+	}
 
 	newInstance.Cluster.ObjectMeta.Name = instance.Name
 	newInstance.Cluster.ObjectMeta.Namespace = namespace
+	// NOTE the spec of the instance is stored in it's PairInstance
 	newInstance.Cluster.ObjectMeta.Annotations = map[string]string{}
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-name"] = instance.Name
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-nameScheme"] = string(instance.NameScheme)
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-nodeSize"] = instance.NodeSize
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-facility"] = instance.Facility
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-kubernetesNodeCount"] = fmt.Sprintf("%v", instance.KubernetesNodeCount)
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-setup-noGitHubToken"] = fmt.Sprintf("%v", instance.Setup.GitHubOAuthToken == "")
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"] = instance.Setup.User
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-setup-guests"] = strings.Join(instance.Setup.Guests, " ")
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-setup-repos"] = strings.Join(instance.Setup.Repos, " ")
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-setup-timezone"] = instance.Setup.Timezone
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-setup-fullname"] = instance.Setup.Fullname
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-setup-email"] = instance.Setup.Email
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-setup-baseDNSName"] = instance.Setup.BaseDNSName
-	envJSON, err := json.Marshal(instance.Setup.Env)
-	if err != nil {
-		log.Printf("%#v\n", err)
-		return newInstance, err
-	}
-	newInstance.Cluster.ObjectMeta.Annotations["io.sharing.pair-spec-setup-env"] = string(envJSON)
-	newInstance.Cluster.Spec.InfrastructureRef.Name = instance.Name
 	newInstance.Cluster.Spec.ControlPlaneRef.Name = instance.Name + "-control-plane"
 
-	newInstance.KubeadmConfigTemplateWorker.ObjectMeta.Name = instance.Name + "-worker-a"
-	newInstance.KubeadmConfigTemplateWorker.ObjectMeta.Namespace = namespace
-	newInstance.KubeadmConfigTemplateWorker.ObjectMeta.Annotations = map[string]string{}
-	newInstance.KubeadmConfigTemplateWorker.ObjectMeta.Annotations["io.sharing.pair-spec-name"] = instance.Name
-	newInstance.KubeadmConfigTemplateWorker.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"] = instance.Setup.User
-
-	newInstance.PacketMachineTemplateWorker.ObjectMeta.Name = instance.Name + "-worker-a"
-	newInstance.PacketMachineTemplateWorker.ObjectMeta.Namespace = namespace
-	newInstance.PacketMachineTemplateWorker.ObjectMeta.Annotations = map[string]string{}
-	newInstance.PacketMachineTemplateWorker.ObjectMeta.Annotations["io.sharing.pair-spec-name"] = instance.Name
-	newInstance.PacketMachineTemplateWorker.ObjectMeta.Annotations["io.sharing.pair-spec-setup-user"] = instance.Setup.User
-	// TODO default value configuration scope - deployment based configuration
-	newInstance.PacketMachineTemplateWorker.Spec.Template.Spec.MachineType = instance.NodeSize
+	newInstance.PairInstance = NewPairInstance(instance, namespace)
 
 	return newInstance, nil
 }
 
+// KubernetesInstanceResources ...
+// returns the resources of a Kubernetes instance, in the order to create them, starting with their owning Cluster
+func KubernetesInstanceResources(newInstance KubernetesCluster) []instanceResource {
+	resources := []instanceResource{
+		{"Cluster", clusterAPIv1beta1.GroupVersion.WithResource("clusters"), "Cluster", &newInstance.Cluster},
+		{"PairInstance", PairInstanceGroupVersionResource, "PairInstance", newInstance.PairInstance},
+		{"KubeadmControlPlane", clusterAPIControlPlaneKubeadmv1beta1.GroupVersion.WithResource("kubeadmcontrolplanes"), "KubeadmControlPlane", &newInstance.KubeadmControlPlane},
+		newInstance.Infrastructure.MachineTemplate,
+		newInstance.Infrastructure.Cluster,
+	}
+	if newInstance.SetupSecret.ObjectMeta.Name != "" {
+		resources = append(resources, instanceResource{"SetupSecret", corev1.SchemeGroupVersion.WithResource("secrets"), "Secret", newInstance.SetupSecret})
+	}
+	for i := range newInstance.WorkerPools {
+		pool := &newInstance.WorkerPools[i]
+		resources = append(resources, []instanceResource{
+			{"MachineDeployment " + pool.MachineDeployment.ObjectMeta.Labels["pool"], clusterAPIv1beta1.GroupVersion.WithResource("machinedeployments"), "MachineDeployment", &pool.MachineDeployment},
+			{"KubeadmConfigTemplate " + pool.MachineDeployment.ObjectMeta.Labels["pool"], cabpkv1beta1.GroupVersion.WithResource("kubeadmconfigtemplates"), "KubeadmConfigTemplate", &pool.KubeadmConfigTemplate},
+			pool.MachineTemplate,
+		}...)
+	}
+	return resources
+}
+
+// KubernetesRenderManifests ...
+// returns the resources and bootstrap scripts templated for a Kubernetes instance
+func KubernetesRenderManifests(instance InstanceSpec, newInstance KubernetesCluster) (manifests InstanceManifests, err error) {
+	manifests.Instance = instance
+	for _, resource := range KubernetesInstanceResources(newInstance) {
+		err = manifests.AddResource(resource.Object, resource.GroupVersionResource.GroupVersion().WithKind(resource.Kind))
+		if err != nil {
+			return InstanceManifests{}, err
+		}
+	}
+	manifests.Scripts = map[string]string{
+		"control-plane/preKubeadmCommands":  strings.Join(newInstance.KubeadmControlPlane.Spec.KubeadmConfigSpec.PreKubeadmCommands, "\n"),
+		"control-plane/postKubeadmCommands": strings.Join(newInstance.KubeadmControlPlane.Spec.KubeadmConfigSpec.PostKubeadmCommands, "\n"),
+	}
+	// NOTE the pools of an instance share their bootstrap commands
+	if len(newInstance.WorkerPools) > 0 {
+		workerSpec := newInstance.WorkerPools[0].KubeadmConfigTemplate.Spec.Template.Spec
+		manifests.Scripts["worker/preKubeadmCommands"] = strings.Join(workerSpec.PreKubeadmCommands, "\n")
+		manifests.Scripts["worker/postKubeadmCommands"] = strings.Join(workerSpec.PostKubeadmCommands, "\n")
+	}
+	return manifests, nil
+}
+
+// KubernetesGetManifests ...
+// returns the management cluster resources of a Kubernetes instance, with Secret data redacted
+func KubernetesGetManifests(name string, dynamicClient dynamic.Interface) (manifests InstanceManifests, err error) {
+	manifests.Instance, err = GetSpec(name, dynamicClient)
+	if err != nil {
+		return InstanceManifests{}, err
+	}
+	manifests.Resources = []map[string]interface{}{}
+	for _, query := range instanceResourceQueries(manifests.Instance) {
+		items, err := getInstanceResources(dynamicClient, query)
+		if err != nil {
+			return InstanceManifests{}, err
+		}
+		for _, item := range items {
+			unstructured.RemoveNestedField(item.Object, "metadata", "managedFields")
+			if item.GetKind() == "Secret" {
+				RedactUnstructuredSecret(&item)
+			}
+			manifests.Resources = append(manifests.Resources, item.Object)
+		}
+	}
+	return manifests, nil
+}
+
+// RedactUnstructuredSecret ...
+// replaces the values of a Secret, so that it can be shown
+func RedactUnstructuredSecret(secret *unstructured.Unstructured) {
+	for _, field := range []string{"data", "stringData"} {
+		values, found, _ := unstructured.NestedMap(secret.Object, field)
+		if found != true {
+			continue
+		}
+		for key := range values {
+			values[key] = "REDACTED"
+		}
+		unstructured.SetNestedMap(secret.Object, values, field)
+	}
+	annotations := secret.GetAnnotations()
+	if _, found := annotations[corev1.LastAppliedConfigAnnotation]; found == true {
+		delete(annotations, corev1.LastAppliedConfigAnnotation)
+		secret.SetAnnotations(annotations)
+	}
+}
+
 // KubernetesGetKubeconfigBytes ...
 // given an instance name and clientset, return the instance's kubeconfig as bytes
 func KubernetesGetKubeconfigBytes(name string, clientset *kubernetes.Clientset) (kubeconfigBytes []byte, err error) {
@@ -1077,7 +990,7 @@ func KubernetesGetKubeconfigYAML(name string, clientset *kubernetes.Clientset) (
 func KubernetesDynamicGetKubeconfigBytes(name string, kubernetesClientset dynamic.Interface) (kubeconfig []byte, err error) {
 	targetNamespace := common.GetTargetNamespace()
 	groupVersionResource := schema.GroupVersionResource{Version: "v1", Group: "", Resource: "secrets"}
-	secret, err := kubernetesClientset.Resource(groupVersionResource).Namespace(targetNamespace).Get(context.TODO(), fmt.Sprintf("%s-kubeconfig", name), metav1.GetOptions{})
+	secret, err := kubernetesClientset.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), fmt.Sprintf("%s-kubeconfig", name), metav1.GetOptions{})
 	if err != nil {
 		log.Printf("%#v\n", err)
 		return []byte{}, fmt.Errorf("Failed to get Kubernetes cluster Kubeconfig; err: %#v", err)
@@ -1363,36 +1276,26 @@ pollInstanceNamespace:
 func KubernetesAddMachineIPToDNS(dynamicClient dynamic.Interface, name string, subdomain string) (err error) {
 	targetNamespace := common.GetTargetNamespace()
 	var ipAddress string
-	groupVersion := clusterAPIv1alpha3.GroupVersion
+	groupVersion := clusterAPIv1beta1.GroupVersion
 	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "machines"}
-	machinesDynamic, err := dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/cluster-name=" + name})
+	machinesDynamic, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/cluster-name=" + name})
 	if err != nil {
 		log.Printf("%#v\n", err)
 		return err
 	}
-	eventObjectBytes, _ := json.Marshal(machinesDynamic)
-	var machines clusterAPIv1alpha3.MachineList
-	json.Unmarshal(eventObjectBytes, &machines)
-	if len(machines.Items) == 0 {
+	if len(machinesDynamic.Items) == 0 {
 		log.Printf("no machines available yet with label selector 'cluster.x-k8s.io/cluster-name=%v'", name)
 		return fmt.Errorf("no machines available yet with label selector 'cluster.x-k8s.io/cluster-name=%v'", name)
 	}
-	machine := machines.Items[0]
-	if len(machine.Status.Addresses) < 1 {
-		log.Println("error: machine has no IP addresses")
-		return fmt.Errorf("machine has no IP addresses")
-	}
-	if machine.Status.Addresses[1].Address == "" {
-		log.Println("error: machine address is empty")
-		return fmt.Errorf("machine address is empty")
+	var machine clusterAPIv1beta1.Machine
+	err = restructure(&machinesDynamic.Items[0], &machine)
+	if err != nil {
+		return err
 	}
-	if govalidator.IsIPv4(machine.Status.Addresses[1].Address) == false {
-		log.Printf("error '%v' is not a valid IPv4 address", machine.Status.Addresses[1].Address)
-		return fmt.Errorf("error '%v' is not a valid IPv4 address", machine.Status.Addresses[1].Address)
+	ipAddress, err = GetInfrastructureProvider().MachineAddress(machine.Status.Addresses)
+	if err != nil {
+		return err
 	}
-
-	// NOTE first IP doesn't work, as it's used for the cluster's API; instead we will use the second, which works
-	ipAddress = machine.Status.Addresses[1].Address
 	log.Println("machine IP available:", ipAddress)
 	entry := dns.Entry{
 		Subdomain: subdomain,
@@ -1443,9 +1346,9 @@ func KubernetesGetLocalInstanceWildcardTLSCert(clientset *kubernetes.Clientset,
 }
 
 // KubernetesUpsertLocalInstanceWildcardTLSCert ...
-// given a local clientset, username, and secret,
-// locally upsert the secret
-func KubernetesUpsertLocalInstanceWildcardTLSCert(clientset *kubernetes.Clientset, username string, secret *corev1.Secret) (err error) {
+// given a local clientset, dynamic client, username, and secret,
+// locally upsert the secret, owned by the instance's Cluster
+func KubernetesUpsertLocalInstanceWildcardTLSCert(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, username string, secret *corev1.Secret) (err error) {
 	targetNamespace := common.GetTargetNamespace()
 	templatedSecretName := fmt.Sprintf("%v-tls", username)
 	templatedSecret := corev1.Secret{
@@ -1459,6 +1362,12 @@ func KubernetesUpsertLocalInstanceWildcardTLSCert(clientset *kubernetes.Clientse
 		Type: corev1.SecretTypeTLS,
 		Data: secret.Data,
 	}
+	ownerReference, err := common.GetInstanceClusterOwnerReference(dynamicClient, username)
+	if err != nil {
+		log.Printf("Not setting owner of Secret '%v', %v\n", templatedSecretName, err)
+	} else {
+		common.AddOwnerReference(&templatedSecret, ownerReference)
+	}
 	log.Printf("Attempting to create a secret locally for '%v' in namespace '%v'\n", templatedSecretName, targetNamespace)
 	_, err = clientset.CoreV1().Secrets(targetNamespace).Create(context.TODO(), &templatedSecret, metav1.CreateOptions{})
 	if apierrors.IsAlreadyExists(err) {
@@ -1469,6 +1378,9 @@ func KubernetesUpsertLocalInstanceWildcardTLSCert(clientset *kubernetes.Clientse
 			return fmt.Errorf("Failed to get Secret '%v' in namespace '%v', %#v", templatedSecretName, targetNamespace, err)
 		}
 		templatedSecret.SetResourceVersion(existingSecret.GetResourceVersion())
+		for _, existingOwnerReference := range existingSecret.GetOwnerReferences() {
+			common.AddOwnerReference(&templatedSecret, existingOwnerReference)
+		}
 		_, err = clientset.CoreV1().Secrets(targetNamespace).Update(context.TODO(), &templatedSecret, metav1.UpdateOptions{})
 		if err != nil {
 			log.Printf("%#v\n", err)
@@ -1570,7 +1482,7 @@ func KubernetesAddCertToMachine(clientset *kubernetes.Clientset, dynamicClient d
 			return fmt.Errorf("secret 'letsencrypt-prod' is not found in Namespace '%v' on Instance '%v' yet", namespace, instanceName)
 		}
 		//   upsert remote cert locally
-		err = KubernetesUpsertLocalInstanceWildcardTLSCert(clientset, instanceName, instanceSecret)
+		err = KubernetesUpsertLocalInstanceWildcardTLSCert(clientset, dynamicClient, instanceName, instanceSecret)
 		log.Printf("err: %v\n", err)
 	} else if err == nil {
 		log.Printf("Cert for Instance '%v' found locally. Creating it in the Instance\n", instanceName)
@@ -1639,11 +1551,11 @@ func UpdateInstanceSpecIfEnvOverrides(instance InstanceSpec) InstanceSpec {
 // UpdateInstanceNodeWithProviderID ...
 // sets the ProviderID field in the Node resources of the target cluster
 func UpdateInstanceNodeWithProviderID(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, instanceName string) error {
-	// get provider ID from PacketMachines
-	targetNamespace := common.GetTargetNamespace()
-	groupVersion := clusterAPIv1alpha3.GroupVersion
-	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetmachines"}
-	items, err := dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "cluster.x-k8s.io/cluster-name=" + instanceName})
+	// get provider ID from the provider's machines
+	machines, err := GetInfrastructureProvider().ListMachines(dynamicClient, "cluster.x-k8s.io/cluster-name="+instanceName)
+	if err != nil {
+		return err
+	}
 
 	instanceKubeconfig, err := KubernetesGetKubeconfigBytes(instanceName, clientset)
 	if err != nil {
@@ -1654,21 +1566,34 @@ func UpdateInstanceNodeWithProviderID(clientset *kubernetes.Clientset, dynamicCl
 		return err
 	}
 	// get all nodes in target cluster using it's kubeconfig, where they match on the name of the controlplane nodes
-	for _, item := range items.Items {
-		var itemRestructuredPM clusterAPIPacketv1alpha3.PacketMachine
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &itemRestructuredPM)
-		if err != nil {
-			return fmt.Errorf("failed to restructure %T", itemRestructuredPM)
+	for _, machine := range machines {
+		if machine.ProviderID == "" {
+			continue
 		}
-		node, err := instanceClientset.CoreV1().Nodes().Get(context.TODO(), itemRestructuredPM.ObjectMeta.Name, metav1.GetOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to get Node '%v': %v", itemRestructuredPM.ObjectMeta.Name, err)
+		node, err := instanceClientset.CoreV1().Nodes().Get(context.TODO(), machine.Name, metav1.GetOptions{})
+		if err != nil && apierrors.IsNotFound(err) {
+			// NOTE new nodes are synced once they've joined
+			log.Printf("Node '%v' of instance '%v' hasn't joined yet\n", machine.Name, instanceName)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to get Node '%v': %v", machine.Name, err)
+		}
+		if node.Spec.ProviderID == machine.ProviderID {
+			continue
+		}
+		node.Spec.ProviderID = machine.ProviderID
+		// NOTE only the taint of the cloud provider is removed, so that the taints of worker pools remain
+		taints := []corev1.Taint{}
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == "node.cloudprovider.kubernetes.io/uninitialized" {
+				continue
+			}
+			taints = append(taints, taint)
 		}
-		node.Spec.ProviderID = *itemRestructuredPM.Spec.ProviderID
-		node.Spec.Taints = []corev1.Taint{}
+		node.Spec.Taints = taints
 		_, err = instanceClientset.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
 		if err != nil {
-			return fmt.Errorf("failed to update Node %v: %v", itemRestructuredPM.ObjectMeta.Name, err)
+			return fmt.Errorf("failed to update Node %v: %v", machine.Name, err)
 		}
 	}
 
@@ -0,0 +1,157 @@
+package instances
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// newUnstructuredSecret ...
+// returns a Secret in the target namespace with data and stringData
+func newUnstructuredSecret(name string, data map[string]interface{}, stringData map[string]interface{}) *unstructured.Unstructured {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "sharingio-pair-instances",
+			"annotations": map[string]interface{}{
+				corev1.LastAppliedConfigAnnotation: `{"data":{"value":"a3ViZWNvbmZpZw=="}}`,
+				"io.sharing.pair-spec-name":        "bobymcbobs-exjk",
+			},
+			"managedFields": []interface{}{
+				map[string]interface{}{"manager": "cluster-api-manager"},
+			},
+		},
+	}}
+	if data != nil {
+		secret.Object["data"] = data
+	}
+	if stringData != nil {
+		secret.Object["stringData"] = stringData
+	}
+	return secret
+}
+
+func TestRedactUnstructuredSecret(t *testing.T) {
+	tests := []struct {
+		name               string
+		data               map[string]interface{}
+		stringData         map[string]interface{}
+		expectedData       map[string]interface{}
+		expectedStringData map[string]interface{}
+	}{
+		{
+			name:         "data",
+			data:         map[string]interface{}{"value": "a3ViZWNvbmZpZw==", "token": "Z2hvX2FiYw=="},
+			expectedData: map[string]interface{}{"value": "REDACTED", "token": "REDACTED"},
+		},
+		{
+			name:               "stringData",
+			stringData:         map[string]interface{}{"GITHUB_TOKEN": "ghp_abc"},
+			expectedStringData: map[string]interface{}{"GITHUB_TOKEN": "REDACTED"},
+		},
+		{
+			name: "no values",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := newUnstructuredSecret("bobymcbobs-exjk-kubeconfig", tt.data, tt.stringData)
+			RedactUnstructuredSecret(secret)
+			data, _, _ := unstructured.NestedMap(secret.Object, "data")
+			if reflect.DeepEqual(data, tt.expectedData) != true {
+				t.Errorf("expected data %v, got %v", tt.expectedData, data)
+			}
+			stringData, _, _ := unstructured.NestedMap(secret.Object, "stringData")
+			if reflect.DeepEqual(stringData, tt.expectedStringData) != true {
+				t.Errorf("expected stringData %v, got %v", tt.expectedStringData, stringData)
+			}
+			annotations := secret.GetAnnotations()
+			if _, found := annotations[corev1.LastAppliedConfigAnnotation]; found == true {
+				t.Errorf("expected the last applied configuration to be removed")
+			}
+			if annotations["io.sharing.pair-spec-name"] != "bobymcbobs-exjk" {
+				t.Errorf("expected other annotations to be kept, got %v", annotations)
+			}
+		})
+	}
+}
+
+func TestKubernetesGetManifests(t *testing.T) {
+	name := "bobymcbobs-exjk"
+	cluster := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cluster.x-k8s.io/v1beta1",
+		"kind":       "Cluster",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "sharingio-pair-instances",
+			"labels":    map[string]interface{}{"io.sharing.pair": "instance"},
+			"managedFields": []interface{}{
+				map[string]interface{}{"manager": "cluster-api-manager"},
+			},
+		},
+	}}
+	objects := []runtime.Object{
+		cluster,
+		newUnstructuredPairInstance(t, InstanceSpec{Name: name, Type: InstanceTypeKubernetes, Setup: types.SetupSpec{User: "BobyMCbobs"}}),
+		newUnstructuredSecret(name+"-kubeconfig", map[string]interface{}{"value": "a3ViZWNvbmZpZw=="}, nil),
+		newUnstructuredSecret(setupSecretName(name), nil, map[string]interface{}{"SHARINGIO_PAIR_INSTANCE_SETUP_GITHUBOAUTHTOKEN": "gho_abc"}),
+		newUnstructuredSecret("someone-elses-kubeconfig", map[string]interface{}{"value": "a3ViZWNvbmZpZw=="}, nil),
+	}
+	listKinds := map[schema.GroupVersionResource]string{
+		{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machines"}:                      "MachineList",
+		{Group: "infrastructure.cluster.x-k8s.io", Version: "v1beta1", Resource: "packetmachines"}: "PacketMachineList",
+		{Group: "externaldns.k8s.io", Version: "v1alpha1", Resource: "dnsendpoints"}:               "DNSEndpointList",
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+
+	manifests, err := KubernetesGetManifests(name, dynamicClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if manifests.Instance.Name != name || manifests.Instance.Setup.User != "BobyMCbobs" {
+		t.Errorf("expected the spec of the instance, got %#v", manifests.Instance)
+	}
+
+	expectedSecrets := map[string]map[string]interface{}{
+		name + "-kubeconfig":  {"value": "REDACTED"},
+		setupSecretName(name): {"SHARINGIO_PAIR_INSTANCE_SETUP_GITHUBOAUTHTOKEN": "REDACTED"},
+	}
+	kinds := map[string]int{}
+	for _, resource := range manifests.Resources {
+		item := unstructured.Unstructured{Object: resource}
+		kinds[item.GetKind()]++
+		if _, found, _ := unstructured.NestedFieldNoCopy(resource, "metadata", "managedFields"); found == true {
+			t.Errorf("expected the managedFields of %v '%v' to be removed", item.GetKind(), item.GetName())
+		}
+		if item.GetKind() != "Secret" {
+			continue
+		}
+		expected, ok := expectedSecrets[item.GetName()]
+		if ok != true {
+			t.Errorf("unexpected Secret '%v'", item.GetName())
+			continue
+		}
+		values, _, _ := unstructured.NestedMap(resource, "data")
+		if values == nil {
+			values, _, _ = unstructured.NestedMap(resource, "stringData")
+		}
+		if reflect.DeepEqual(values, expected) != true {
+			t.Errorf("expected Secret '%v' to be redacted to %v, got %v", item.GetName(), expected, values)
+		}
+		if _, found := item.GetAnnotations()[corev1.LastAppliedConfigAnnotation]; found == true {
+			t.Errorf("expected the last applied configuration of Secret '%v' to be removed", item.GetName())
+		}
+	}
+	if kinds["Cluster"] != 1 || kinds["PairInstance"] != 1 || kinds["Secret"] != len(expectedSecrets) || len(manifests.Resources) != 2+len(expectedSecrets) {
+		t.Errorf("expected a Cluster, a PairInstance and %v Secrets, got %v", len(expectedSecrets), kinds)
+	}
+}
@@ -0,0 +1,127 @@
+package instances
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// InstanceMachineStatus ...
+// the progress of a machine of an instance
+type InstanceMachineStatus struct {
+	Name         string `json:"name"`
+	ControlPlane bool   `json:"controlPlane"`
+	// Pool is the worker pool of the machine
+	Pool       string `json:"pool,omitempty"`
+	Phase      string `json:"phase"`
+	Version    string `json:"version,omitempty"`
+	ProviderID string `json:"providerID,omitempty"`
+	// NodeName is the Node of the machine, once it's joined and has it's ProviderID
+	NodeName string `json:"nodeName,omitempty"`
+}
+
+// InstanceNodesStatus ...
+// the worker nodes of an instance, and the progress of it's machines
+// swagger:response nodes
+type InstanceNodesStatus struct {
+	// Desired is the amount of worker nodes the instance is scaled to
+	Desired int `json:"desired"`
+	// Ready is the amount of worker nodes which are running
+	Ready    int                     `json:"ready"`
+	Machines []InstanceMachineStatus `json:"machines"`
+}
+
+// KubernetesNodesStatus ...
+// returns the worker nodes of a Kubernetes instance, and the progress of it's machines
+func KubernetesNodesStatus(name string, dynamicClient dynamic.Interface) (status InstanceNodesStatus, err error) {
+	instance, err := GetSpec(name, dynamicClient)
+	if err != nil {
+		return InstanceNodesStatus{}, err
+	}
+	if instance.Name == "" {
+		return InstanceNodesStatus{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+	status = InstanceNodesStatus{
+		Desired:  instance.KubernetesNodeCount,
+		Machines: []InstanceMachineStatus{},
+	}
+
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("machines")
+	items, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(common.GetTargetNamespace()).List(context.TODO(), metav1.ListOptions{LabelSelector: clusterAPIv1beta1.ClusterLabelName + "=" + name})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return InstanceNodesStatus{}, fmt.Errorf("Failed to list Machines, %#v", err)
+	}
+	for _, item := range items.Items {
+		var machine clusterAPIv1beta1.Machine
+		err = restructure(&item, &machine)
+		if err != nil {
+			return InstanceNodesStatus{}, fmt.Errorf("Failed to restructure %T", machine)
+		}
+		_, controlPlane := machine.ObjectMeta.Labels[clusterAPIv1beta1.MachineControlPlaneLabelName]
+		machineStatus := InstanceMachineStatus{
+			Name:         machine.ObjectMeta.Name,
+			ControlPlane: controlPlane,
+			Pool:         strings.TrimPrefix(machine.ObjectMeta.Labels["pool"], "worker-"),
+			Phase:        machine.Status.Phase,
+		}
+		if machine.Spec.Version != nil {
+			machineStatus.Version = *machine.Spec.Version
+		}
+		if machine.Spec.ProviderID != nil {
+			machineStatus.ProviderID = *machine.Spec.ProviderID
+		}
+		if machine.Status.NodeRef != nil {
+			machineStatus.NodeName = machine.Status.NodeRef.Name
+		}
+		if controlPlane != true && machineStatus.NodeName != "" && machine.Status.Phase == string(clusterAPIv1beta1.MachinePhaseRunning) {
+			status.Ready++
+		}
+		status.Machines = append(status.Machines, machineStatus)
+	}
+	return status, nil
+}
+
+// KubernetesScaleNodes ...
+// scale the worker nodes of a pool of a Kubernetes instance, within the quota of it's user.
+// Instances without worker pools are scaled without naming one
+func KubernetesScaleNodes(name string, pool string, count int, dynamicClient dynamic.Interface, options InstanceUpdateOptions) (instanceUpdated InstanceSpec, err error) {
+	instance, err := GetSpec(name, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	if instance.Name == "" {
+		return InstanceSpec{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+	if instance.Type != InstanceTypeKubernetes {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: "Only Kubernetes instances have worker nodes"}
+	}
+	if len(instance.WorkerPools) == 0 {
+		if pool != "" && pool != instanceDefaultWorkerPoolName {
+			return InstanceSpec{}, InstanceUpdateInvalidError{Reason: fmt.Sprintf("Instance has no worker pool '%v'", pool)}
+		}
+		instance.KubernetesNodeCount = count
+		return Update(name, instance, dynamicClient, options)
+	}
+	if pool == "" && len(instance.WorkerPools) == 1 {
+		pool = instance.WorkerPools[0].Name
+	}
+	found := false
+	for i := range instance.WorkerPools {
+		if instance.WorkerPools[i].Name == pool {
+			instance.WorkerPools[i].Count = count
+			found = true
+		}
+	}
+	if found != true {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: fmt.Sprintf("Instance has no worker pool '%v'", pool)}
+	}
+	return Update(name, instance, dynamicClient, options)
+}
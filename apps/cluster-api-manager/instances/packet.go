@@ -0,0 +1,203 @@
+package instances
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	"github.com/asaskevich/govalidator"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	clusterAPIPacketv1beta1 "sigs.k8s.io/cluster-api-provider-packet/api/v1beta1"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// PacketProvider ...
+// provisions machines on Equinix Metal, with cluster-api-provider-packet
+type PacketProvider struct{}
+
+// Name ...
+// returns the name which the provider is selected by
+func (p PacketProvider) Name() string {
+	return "packet"
+}
+
+// KubernetesInfrastructure ...
+// returns the PacketCluster and PacketMachineTemplates of a Kubernetes instance
+func (p PacketProvider) KubernetesInfrastructure(instance InstanceSpec, namespace string) (infrastructure KubernetesInfrastructure, err error) {
+	annotations := func() map[string]string {
+		return map[string]string{
+			"io.sharing.pair-spec-name":       instance.Name,
+			"io.sharing.pair-spec-setup-user": instance.Setup.User,
+		}
+	}
+	labels := func() map[string]string {
+		return map[string]string{"io.sharing.pair": "instance"}
+	}
+	packetMachineTemplate := func(name string, nodeSize string, nodeOS string, sshKeys []string) *clusterAPIPacketv1beta1.PacketMachineTemplate {
+		return &clusterAPIPacketv1beta1.PacketMachineTemplate{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Labels:      labels(),
+				Annotations: annotations(),
+			},
+			Spec: clusterAPIPacketv1beta1.PacketMachineTemplateSpec{
+				Template: clusterAPIPacketv1beta1.PacketMachineTemplateResource{
+					Spec: clusterAPIPacketv1beta1.PacketMachineSpec{
+						OS:           nodeOS,
+						BillingCycle: "hourly",
+						// TODO default value configuration scope - deployment based configuration
+						MachineType: nodeSize,
+						SSHKeys:     sshKeys,
+					},
+				},
+			},
+		}
+	}
+
+	infrastructure.Cluster = instanceResource{
+		"PacketCluster", clusterAPIPacketv1beta1.GroupVersion.WithResource("packetclusters"), "PacketCluster",
+		&clusterAPIPacketv1beta1.PacketCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        instance.Name,
+				Namespace:   namespace,
+				Labels:      labels(),
+				Annotations: annotations(),
+			},
+			Spec: clusterAPIPacketv1beta1.PacketClusterSpec{
+				// TODO default value configuration scope - deployment based configuration
+				ProjectID: common.GetPacketProjectID(),
+				Facility:  instance.Facility,
+				ControlPlaneEndpoint: clusterAPIv1beta1.APIEndpoint{
+					Host: "sharing.io",
+					Port: 6443,
+				},
+			},
+		},
+	}
+	infrastructure.MachineTemplate = instanceResource{
+		"PacketMachineTemplate", clusterAPIPacketv1beta1.GroupVersion.WithResource("packetmachinetemplates"), "PacketMachineTemplate",
+		packetMachineTemplate(instance.Name+"-control-plane", instance.NodeSize, instance.NodeOS, GetInstanceSSHKeys(instance)),
+	}
+	for _, pool := range InstanceWorkerPools(instance) {
+		infrastructure.MachineTemplateWorkers = append(infrastructure.MachineTemplateWorkers, instanceResource{
+			"PacketMachineTemplate worker-" + pool.Name, clusterAPIPacketv1beta1.GroupVersion.WithResource("packetmachinetemplates"), "PacketMachineTemplate",
+			packetMachineTemplate(workerPoolResourceName(instance.Name, pool.Name), pool.NodeSize, pool.NodeOS, nil),
+		})
+	}
+	return infrastructure, nil
+}
+
+// KubernetesResourceQueries ...
+// returns how to find the PacketCluster, PacketMachineTemplates and PacketMachines of a Kubernetes instance
+func (p PacketProvider) KubernetesResourceQueries(instance InstanceSpec) (queries InfrastructureResourceQueries) {
+	return InfrastructureResourceQueries{
+		Cluster:          instanceResourceQuery{GroupVersionResource: clusterAPIPacketv1beta1.GroupVersion.WithResource("packetclusters"), Name: instance.Name, Owned: true},
+		MachineTemplates: machineTemplateQueries(instance, clusterAPIPacketv1beta1.GroupVersion.WithResource("packetmachinetemplates")),
+		Machines:         instanceResourceQuery{GroupVersionResource: clusterAPIPacketv1beta1.GroupVersion.WithResource("packetmachines"), LabelSelector: "cluster.x-k8s.io/cluster-name=" + instance.Name},
+	}
+}
+
+// KubeletExtraArgs ...
+// returns the args for the kubelet, which is initialised by the Packet cloud controller manager
+func (p PacketProvider) KubeletExtraArgs() map[string]string {
+	return map[string]string{
+		"cloud-provider": "external",
+	}
+}
+
+// PreKubeadmCommands ...
+// returns the commands to run on a node before kubeadm
+func (p PacketProvider) PreKubeadmCommands(nodeType string) (commands []string, err error) {
+	if nodeType != nodeTypeControlPlane {
+		return []string{}, nil
+	}
+	// NOTE templated by cluster-api-provider-packet
+	return []string{`
+cat << EOF >> /root/.sharing-io-pair-init.env
+export KUBERNETES_CONTROLPLANE_ENDPOINT={{ .controlPlaneEndpoint }}
+EOF`}, nil
+}
+
+// PostKubeadmCommands ...
+// returns the commands to run on a node after kubeadm
+func (p PacketProvider) PostKubeadmCommands(nodeType string) (commands []string, err error) {
+	if nodeType != nodeTypeControlPlane {
+		return []string{}, nil
+	}
+	tmpl, err := template.New("packetcloudconfigsecret").Parse(`
+cat << EOF >> /root/.sharing-io-pair-init.env
+export EQUINIX_METAL_PROJECT={{ .PacketProjectID }}
+EOF`)
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return []string{}, fmt.Errorf("Error templating packetcloudconfigsecret command: %#v", err)
+	}
+	templatedBuffer := new(bytes.Buffer)
+	err = tmpl.Execute(templatedBuffer, map[string]interface{}{
+		"PacketProjectID": common.GetPacketProjectID(),
+	})
+	if err != nil {
+		log.Printf("%#v\n", err.Error())
+		return []string{}, fmt.Errorf("Error templating packetcloudconfigsecret command: %#v", err)
+	}
+	return []string{templatedBuffer.String()}, nil
+}
+
+// ListMachines ...
+// returns the PacketMachines matching a label selector
+func (p PacketProvider) ListMachines(dynamicClient dynamic.Interface, labelSelector string) (machines []InfrastructureMachine, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := clusterAPIPacketv1beta1.GroupVersion.WithResource("packetmachines")
+	items, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return machines, fmt.Errorf("Failed to list PacketMachines, %#v", err)
+	}
+	for _, item := range items.Items {
+		var itemRestructuredPM clusterAPIPacketv1beta1.PacketMachine
+		err = restructure(&item, &itemRestructuredPM)
+		if err != nil {
+			return []InfrastructureMachine{}, fmt.Errorf("Failed to restructure %T", itemRestructuredPM)
+		}
+		machine := InfrastructureMachine{
+			Name:        itemRestructuredPM.ObjectMeta.Name,
+			ClusterName: itemRestructuredPM.ObjectMeta.Labels["cluster.x-k8s.io/cluster-name"],
+		}
+		if itemRestructuredPM.Spec.ProviderID != nil {
+			machine.ProviderID = *itemRestructuredPM.Spec.ProviderID
+		}
+		// provider IDs are formatted as 'equinixmetal://UID'
+		providerIDSplit := strings.Split(machine.ProviderID, "/")
+		if len(providerIDSplit) == 3 {
+			machine.UID = providerIDSplit[2]
+		}
+		machines = append(machines, machine)
+	}
+	return machines, nil
+}
+
+// MachineAddress ...
+// returns the second address of a machine
+func (p PacketProvider) MachineAddress(addresses clusterAPIv1beta1.MachineAddresses) (address string, err error) {
+	if len(addresses) < 2 {
+		log.Println("error: machine has no IP addresses")
+		return "", fmt.Errorf("machine has no IP addresses")
+	}
+	if addresses[1].Address == "" {
+		log.Println("error: machine address is empty")
+		return "", fmt.Errorf("machine address is empty")
+	}
+	if govalidator.IsIPv4(addresses[1].Address) == false {
+		log.Printf("error '%v' is not a valid IPv4 address", addresses[1].Address)
+		return "", fmt.Errorf("error '%v' is not a valid IPv4 address", addresses[1].Address)
+	}
+	// NOTE first IP doesn't work, as it's used for the cluster's API; instead we will use the second, which works
+	return addresses[1].Address, nil
+}
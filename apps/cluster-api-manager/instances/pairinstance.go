@@ -0,0 +1,239 @@
+package instances
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// misc PairInstance vars
+var (
+	// PairInstanceGroupVersion is the API group and version of PairInstances
+	PairInstanceGroupVersion = schema.GroupVersion{Group: "pair.sharing.io", Version: "v1alpha1"}
+	// PairInstanceGroupVersionResource is the API which serves PairInstances
+	PairInstanceGroupVersionResource = PairInstanceGroupVersion.WithResource("pairinstances")
+)
+
+// PairInstance ...
+// the declared spec and last observed status of an instance, stored next to it's Cluster
+type PairInstance struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InstanceSpec   `json:"spec"`
+	Status InstanceStatus `json:"status,omitempty"`
+}
+
+// NewPairInstance ...
+// returns a PairInstance for an instance spec, without the fields which must not be stored
+func NewPairInstance(instance InstanceSpec, namespace string) PairInstance {
+	instance.Setup.GitHubOAuthToken = ""
+	instance.Setup.ExtraEmails = nil
+	instance.Setup.Env = MaskSecretEnv(instance.Setup.Env)
+	return PairInstance{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: PairInstanceGroupVersion.String(),
+			Kind:       "PairInstance",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance.Name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"io.sharing.pair":                 "instance",
+				"io.sharing.pair-spec-name":       instance.Name,
+				"io.sharing.pair-spec-setup-user": strings.ToLower(instance.Setup.User),
+			},
+		},
+		Spec: instance,
+	}
+}
+
+// pairInstanceFromUnstructured ...
+// restructures a PairInstance, filling in the fields which aren't stored
+func pairInstanceFromUnstructured(item *unstructured.Unstructured) (pairInstance PairInstance, err error) {
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &pairInstance)
+	if err != nil {
+		return PairInstance{}, fmt.Errorf("Failed to restructure %T", pairInstance)
+	}
+	pairInstance.Spec.Setup.UserLowercase = strings.ToLower(pairInstance.Spec.Setup.User)
+	pairInstance.Spec.Setup.Env = MaskSecretEnv(pairInstance.Spec.Setup.Env)
+	return pairInstance, nil
+}
+
+// GetPairInstance ...
+// returns the PairInstance of an instance, or nil if the instance doesn't have one
+func GetPairInstance(name string, dynamicClient dynamic.Interface) (pairInstance *PairInstance, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	item, err := dynamicClient.Resource(PairInstanceGroupVersionResource).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return nil, fmt.Errorf("Failed to get PairInstance, %#v", err)
+	}
+	restructured, err := pairInstanceFromUnstructured(item)
+	if err != nil {
+		return nil, err
+	}
+	return &restructured, nil
+}
+
+// GetInstanceSpecOfCluster ...
+// returns the spec of an instance from it's PairInstance, or an empty spec if it doesn't have one yet
+func GetInstanceSpecOfCluster(cluster metav1.Object, dynamicClient dynamic.Interface) (spec InstanceSpec, err error) {
+	pairInstance, err := GetPairInstance(cluster.GetName(), dynamicClient)
+	if err != nil || pairInstance == nil {
+		return InstanceSpec{}, err
+	}
+	return pairInstance.Spec, nil
+}
+
+// listPairInstanceSpecs ...
+// returns the spec of each instance with a PairInstance by name, to join with the Clusters of instances
+func listPairInstanceSpecs(dynamicClient dynamic.Interface) (specs map[string]InstanceSpec, err error) {
+	items, err := dynamicClient.Resource(PairInstanceGroupVersionResource).Namespace(common.GetTargetNamespace()).List(context.TODO(), metav1.ListOptions{LabelSelector: "io.sharing.pair=instance"})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return nil, fmt.Errorf("Failed to list PairInstances, %#v", err)
+	}
+	specs = map[string]InstanceSpec{}
+	for i := range items.Items {
+		pairInstance, err := pairInstanceFromUnstructured(&items.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		specs[pairInstance.ObjectMeta.Name] = pairInstance.Spec
+	}
+	return specs, nil
+}
+
+// UpdatePairInstanceSpec ...
+// write the spec of an instance to it's PairInstance
+func UpdatePairInstanceSpec(instance InstanceSpec, dynamicClient dynamic.Interface) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+	item, err := dynamicClient.Resource(PairInstanceGroupVersionResource).Namespace(targetNamespace).Get(context.TODO(), instance.Name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		// instances which haven't been converted yet still have their annotations
+		return nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to get PairInstance, %#v", err)
+	}
+	pairInstance := NewPairInstance(instance, targetNamespace)
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pairInstance.Spec)
+	if err != nil {
+		return fmt.Errorf("Failed to unstructure PairInstance spec, %#v", err)
+	}
+	item.Object["spec"] = spec
+	_, err = dynamicClient.Resource(PairInstanceGroupVersionResource).Namespace(targetNamespace).Update(context.TODO(), item, metav1.UpdateOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to update PairInstance, %#v", err)
+	}
+	return nil
+}
+
+// UpdatePairInstanceStatus ...
+// record the observed status of an instance on it's PairInstance, if it's phase has changed
+func UpdatePairInstanceStatus(name string, status InstanceStatus, dynamicClient dynamic.Interface) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+	item, err := dynamicClient.Resource(PairInstanceGroupVersionResource).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to get PairInstance, %#v", err)
+	}
+	currentPhase, _, _ := unstructured.NestedString(item.Object, "status", "phase")
+	if currentPhase == string(status.Phase) {
+		return nil
+	}
+	statusUnstructured, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return fmt.Errorf("Failed to unstructure PairInstance status, %#v", err)
+	}
+	item.Object["status"] = statusUnstructured
+	_, err = dynamicClient.Resource(PairInstanceGroupVersionResource).Namespace(targetNamespace).UpdateStatus(context.TODO(), item, metav1.UpdateOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to update PairInstance status, %#v", err)
+	}
+	log.Printf("PairInstance '%v' is now at phase '%v'\n", name, status.Phase)
+	return nil
+}
+
+// SyncPairInstanceStatus ...
+// observe the status of an instance and record it on it's PairInstance, called by the reconciler so that reads stay side-effect free
+func SyncPairInstanceStatus(name string, instanceType InstanceType, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) (status InstanceStatus, err error) {
+	var instance Instance
+	switch instanceType {
+	case InstanceTypeKubernetes:
+		instance, err = KubernetesGet(name, dynamicClient, clientset)
+	case InstanceTypePlain:
+		instance, err = PlainGet(name, dynamicClient, clientset)
+	default:
+		return InstanceStatus{}, fmt.Errorf("Invalid instance type")
+	}
+	if err != nil {
+		return InstanceStatus{}, err
+	}
+	if instance.Spec.Name == "" {
+		return InstanceStatus{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+	// the remaining lifetime is derived on each read, so a recorded value would only go stale
+	status = instance.Status
+	status.ExpiresIn = ""
+	err = UpdatePairInstanceStatus(name, status, dynamicClient)
+	if err != nil {
+		return InstanceStatus{}, err
+	}
+	return instance.Status, nil
+}
+
+// ConvertAnnotatedClusters ...
+// create a PairInstance for each existing instance which only has it's spec in the annotations of it's Cluster
+func ConvertAnnotatedClusters(dynamicClient dynamic.Interface) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	clusters, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "io.sharing.pair=instance"})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to list Clusters, %#v", err)
+	}
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		// NOTE Clusters created with a PairInstance have no spec annotations, and may not have their PairInstance yet
+		if _, annotated := cluster.GetAnnotations()["io.sharing.pair-spec-name"]; annotated != true {
+			continue
+		}
+		instance := InstanceSpecFromAnnotations(cluster.GetAnnotations())
+		instance.Name = cluster.GetName()
+		pairInstance := NewPairInstance(instance, targetNamespace)
+		pairInstance.ObjectMeta.OwnerReferences = []metav1.OwnerReference{common.ClusterOwnerReference(cluster)}
+		asUnstructured, err := common.ObjectToUnstructured(pairInstance)
+		if err != nil {
+			return fmt.Errorf("Failed to unstructure PairInstance '%v', %#v", instance.Name, err)
+		}
+		_, err = dynamicClient.Resource(PairInstanceGroupVersionResource).Namespace(targetNamespace).Create(context.TODO(), asUnstructured, metav1.CreateOptions{})
+		if err != nil && apierrors.IsAlreadyExists(err) {
+			continue
+		} else if err != nil {
+			log.Printf("%#v\n", err)
+			return fmt.Errorf("Failed to create PairInstance '%v', %#v", instance.Name, err)
+		}
+		log.Printf("Converted the annotations of Cluster '%v' to a PairInstance\n", cluster.GetName())
+	}
+	return nil
+}
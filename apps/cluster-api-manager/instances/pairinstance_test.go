@@ -0,0 +1,146 @@
+package instances
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// newPairInstanceDynamicClient ...
+// returns a fake dynamic client, which can list Clusters and PairInstances
+func newPairInstanceDynamicClient(t *testing.T, objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	t.Setenv("APP_TARGET_NAMESPACE", "sharingio-pair-instances")
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		common.ClusterAPIServedResource(clusterAPIv1beta1.GroupVersion.WithResource("clusters")): "ClusterList",
+		PairInstanceGroupVersionResource: "PairInstanceList",
+	}, objects...)
+}
+
+// newInstanceCluster ...
+// returns the Cluster of an instance with annotations
+func newInstanceCluster(name string, annotations map[string]string) *unstructured.Unstructured {
+	cluster := &unstructured.Unstructured{}
+	cluster.SetAPIVersion(common.ClusterAPIServedResource(clusterAPIv1beta1.GroupVersion.WithResource("clusters")).GroupVersion().String())
+	cluster.SetKind("Cluster")
+	cluster.SetNamespace("sharingio-pair-instances")
+	cluster.SetName(name)
+	cluster.SetLabels(map[string]string{"io.sharing.pair": "instance"})
+	cluster.SetAnnotations(annotations)
+	return cluster
+}
+
+// newUnstructuredPairInstance ...
+// returns the PairInstance of an instance as unstructured
+func newUnstructuredPairInstance(t *testing.T, instance InstanceSpec) *unstructured.Unstructured {
+	pairInstance := NewPairInstance(instance, "sharingio-pair-instances")
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pairInstance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return &unstructured.Unstructured{Object: object}
+}
+
+func TestListPairInstanceSpecs(t *testing.T) {
+	instances := []InstanceSpec{
+		{Name: "bobymcbobs-kubernetes", Type: InstanceTypeKubernetes, Setup: types.SetupSpec{User: "BobyMCbobs", UserLowercase: "bobymcbobs"}},
+		{Name: "bobymcbobs-plain", Type: InstanceTypePlain, Setup: types.SetupSpec{User: "BobyMCbobs", UserLowercase: "bobymcbobs"}},
+	}
+	objects := []runtime.Object{}
+	for _, instance := range instances {
+		objects = append(objects, newUnstructuredPairInstance(t, instance))
+	}
+	dynamicClient := newPairInstanceDynamicClient(t, objects...)
+
+	specs, err := listPairInstanceSpecs(dynamicClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(specs) != len(instances) {
+		t.Fatalf("expected %v specs, got %#v", len(instances), specs)
+	}
+	for _, instance := range instances {
+		if reflect.DeepEqual(specs[instance.Name], instance) != true {
+			t.Errorf("expected spec %#v, got %#v", instance, specs[instance.Name])
+		}
+	}
+}
+
+func TestGetInstanceSpecOfCluster(t *testing.T) {
+	instance := InstanceSpec{Name: "bobymcbobs-plain", Type: InstanceTypePlain, Setup: types.SetupSpec{User: "BobyMCbobs", UserLowercase: "bobymcbobs"}}
+	dynamicClient := newPairInstanceDynamicClient(t, newUnstructuredPairInstance(t, instance))
+
+	tests := []struct {
+		name     string
+		cluster  *unstructured.Unstructured
+		expected InstanceSpec
+	}{
+		{
+			name:     "a Cluster with a PairInstance",
+			cluster:  newInstanceCluster("bobymcbobs-plain", nil),
+			expected: instance,
+		},
+		{
+			name:     "the annotations of a Cluster aren't used",
+			cluster:  newInstanceCluster("bobymcbobs-annotated", map[string]string{"io.sharing.pair-spec-name": "bobymcbobs-annotated", "io.sharing.pair-spec-type": "Plain"}),
+			expected: InstanceSpec{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := GetInstanceSpecOfCluster(tt.cluster, dynamicClient)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reflect.DeepEqual(spec, tt.expected) != true {
+				t.Errorf("expected %#v, got %#v", tt.expected, spec)
+			}
+		})
+	}
+}
+
+func TestConvertAnnotatedClusters(t *testing.T) {
+	dynamicClient := newPairInstanceDynamicClient(t,
+		newInstanceCluster("bobymcbobs-annotated", map[string]string{
+			"io.sharing.pair-spec-name":       "bobymcbobs-annotated",
+			"io.sharing.pair-spec-type":       "Plain",
+			"io.sharing.pair-spec-setup-user": "BobyMCbobs",
+		}),
+		// NOTE a Cluster created with a PairInstance, which hasn't been created yet
+		newInstanceCluster("bobymcbobs-creating", map[string]string{}),
+	)
+
+	err := ConvertAnnotatedClusters(dynamicClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	items, err := dynamicClient.Resource(PairInstanceGroupVersionResource).Namespace("sharingio-pair-instances").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := []string{}
+	for _, item := range items.Items {
+		names = append(names, item.GetName())
+	}
+	sort.Strings(names)
+	if reflect.DeepEqual(names, []string{"bobymcbobs-annotated"}) != true {
+		t.Fatalf("expected only a PairInstance for the annotated Cluster, got %v", names)
+	}
+	pairInstance, err := GetPairInstance("bobymcbobs-annotated", dynamicClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pairInstance.Spec.Type != InstanceTypePlain || pairInstance.Spec.Setup.User != "BobyMCbobs" {
+		t.Errorf("expected the spec from the annotations, got %#v", pairInstance.Spec)
+	}
+}
@@ -1,3 +1,784 @@
 package instances
 
-import ()
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+	"github.com/sharingio/pair/apps/cluster-api-manager/dns"
+
+	"github.com/asaskevich/govalidator"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	clusterAPIPacketv1beta1 "sigs.k8s.io/cluster-api-provider-packet/api/v1beta1"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// misc Plain instance vars
+var (
+	// plainSessionServerPort is the port which the machine serves it's tmate sessions on
+	plainSessionServerPort = 10181
+	// plainSessionServerTimeout is how long to wait for the machine to serve a tmate session
+	plainSessionServerTimeout = 5 * time.Second
+	// plainSessionServerName is the name in the certificate of the session server, which is verified instead of it's IP
+	plainSessionServerName = "sharingio-pair-session-server"
+	// plainSessionServerCertificateLifetime is how long the certificate of the session server is valid for
+	plainSessionServerCertificateLifetime = 10 * 365 * 24 * time.Hour
+)
+
+// PlainInstance ...
+// resources required for Cluster-API to provision a single machine on Packet, running Environment in Docker
+type PlainInstance struct {
+	Cluster         clusterAPIv1beta1.Cluster
+	PacketCluster   clusterAPIPacketv1beta1.PacketCluster
+	Machine         clusterAPIv1beta1.Machine
+	PacketMachine   clusterAPIPacketv1beta1.PacketMachine
+	BootstrapSecret corev1.Secret
+	PairInstance    PairInstance
+	// SetupSecret is only templated when creating the instance, as it holds it's GitHub OAuth token
+	SetupSecret corev1.Secret
+}
+
+// plainBootstrapSecretName ...
+// returns the name of the Secret holding a Plain instance's bootstrap script and session token
+func plainBootstrapSecretName(name string) string {
+	return fmt.Sprintf("%s-bootstrap", name)
+}
+
+// plainGenerateSessionToken ...
+// returns a random token for authenticating with a machine's session server
+func plainGenerateSessionToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tokenBytes), nil
+}
+
+// plainGenerateSessionCertificate ...
+// returns a self-signed certificate and key for a machine's session server, which is trusted by it's certificate alone
+func plainGenerateSessionCertificate() (certificatePEM string, keyPEM string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	certificateTemplate := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: plainSessionServerName},
+		DNSNames:              []string{plainSessionServerName},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(plainSessionServerCertificateLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certificateDER, err := x509.CreateCertificate(rand.Reader, &certificateTemplate, &certificateTemplate, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	certificatePEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDER}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certificatePEM, keyPEM, nil
+}
+
+// plainBootstrapTemplate ...
+// the script which the machine runs on first boot
+// NOTE the rendered output is templated again by cluster-api-provider-packet, so it must not contain double braces
+var plainBootstrapTemplate = `#!/bin/bash
+set -x
+
+cat << EOF >> /root/.sharing-io-pair-init.env
+export SHARINGIO_PAIR_INSTANCE_NAME="{{ $.Instance.Name }}"
+export SHARINGIO_PAIR_INSTANCE_NODE_TYPE=plain
+export SHARINGIO_PAIR_INSTANCE_SETUP_USER="{{ $.Instance.Setup.User }}"
+export SHARINGIO_PAIR_INSTANCE_SETUP_USERLOWERCASE="{{ $.Instance.Setup.UserLowercase }}"
+export SHARINGIO_PAIR_INSTANCE_SETUP_GUESTS="{{ range $.Instance.Setup.Guests }}{{ . }} {{ end }}"
+export SHARINGIO_PAIR_INSTANCE_SETUP_BASEDNSNAME="{{ $.Instance.Setup.BaseDNSName }}"
+export SHARINGIO_PAIR_INSTANCE_ENVIRONMENT_REPOSITORY="{{ $.Instance.Setup.EnvironmentRepository }}"
+export SHARINGIO_PAIR_INSTANCE_ENVIRONMENT_VERSION="{{ $.Instance.Setup.EnvironmentVersion }}"
+export SHARINGIO_PAIR_INSTANCE_SETUP_TIMEZONE="{{ $.Instance.Setup.Timezone }}"
+EOF
+. /root/.sharing-io-pair-init.env
+
+cat << 'EOF' > /root/.sharing-io-pair-environment.env
+TZ={{ $.Instance.Setup.Timezone }}
+GIT_AUTHOR_NAME={{ $.Instance.Setup.Fullname }}
+GIT_AUTHOR_EMAIL={{ $.Instance.Setup.Email }}
+GIT_COMMITTER_NAME={{ $.Instance.Setup.Fullname }}
+GIT_COMMITTER_EMAIL={{ $.Instance.Setup.Email }}
+INIT_DEFAULT_REPOS={{ range $.Instance.Setup.Repos }}{{ . }} {{ end }}
+INIT_DEFAULT_DIR=/home/ii
+SHARINGIO_PAIR_NAME={{ $.Instance.Name }}
+SHARINGIO_PAIR_USER={{ $.Instance.Setup.User }}
+SHARINGIO_PAIR_GUEST_NAMES={{ range $.Instance.Setup.Guests }}{{ . }} {{ end }}
+SHARINGIO_PAIR_BASE_DNS_NAME={{ $.Instance.Setup.BaseDNSName }}
+EOF
+chmod 0600 /root/.sharing-io-pair-environment.env
+
+echo "{{ $.SessionToken }}" > /root/.sharing-io-pair-session-token
+chmod 0600 /root/.sharing-io-pair-session-token
+cat << 'EOF' > /root/.sharing-io-pair-session.crt
+{{ $.SessionCertificate }}EOF
+cat << 'EOF' > /root/.sharing-io-pair-session.key
+{{ $.SessionKey }}EOF
+chmod 0600 /root/.sharing-io-pair-session.key
+
+apt-get -y update
+DEBIAN_FRONTEND=noninteractive apt-get install -y docker.io git python3
+systemctl enable --now docker
+
+cat << 'EOF' > /usr/local/bin/sharingio-pair-session-server
+#!/usr/bin/env python3
+import hmac
+import os
+import ssl
+import subprocess
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
+
+TOKEN = open("/root/.sharing-io-pair-session-token").read().strip()
+FORMATS = {"/tmate/ssh": "#{tmate_ssh}", "/tmate/web": "#{tmate_web}"}
+SETUP_ENV = "/root/.sharing-io-pair-setup.env"
+SETUP_DELIVERED = "/root/.sharing-io-pair-setup-delivered"
+
+
+class Handler(BaseHTTPRequestHandler):
+    def respond(self, code, body):
+        self.send_response(code)
+        self.send_header("Content-Type", "text/plain")
+        self.end_headers()
+        self.wfile.write(body.encode())
+
+    def authorized(self):
+        authorization = self.headers.get("Authorization", "").encode()
+        return hmac.compare_digest(authorization, ("Bearer " + TOKEN).encode())
+
+    def do_POST(self):
+        if not self.authorized():
+            return self.respond(401, "Unauthorized")
+        if self.path != "/setup":
+            return self.respond(404, "Not found")
+        body = self.rfile.read(int(self.headers.get("Content-Length", "0")))
+        # the setup env is only accepted once, then bootstrapping reads and deletes it
+        try:
+            os.close(os.open(SETUP_DELIVERED, os.O_CREAT | os.O_EXCL | os.O_WRONLY, 0o600))
+        except FileExistsError:
+            return self.respond(409, "Setup already delivered")
+        setupEnv = os.open(SETUP_ENV + ".tmp", os.O_CREAT | os.O_TRUNC | os.O_WRONLY, 0o600)
+        with os.fdopen(setupEnv, "wb") as f:
+            f.write(body)
+        os.rename(SETUP_ENV + ".tmp", SETUP_ENV)
+        return self.respond(201, "Setup delivered")
+
+    def do_GET(self):
+        if not self.authorized():
+            return self.respond(401, "Unauthorized")
+        if self.path not in FORMATS:
+            return self.respond(404, "Not found")
+        result = subprocess.run(
+            ["docker", "exec", "environment", "tmate", "-S", "/tmp/ii.default.target.iisocket", "display", "-p", FORMATS[self.path]],
+            stdout=subprocess.PIPE, stderr=subprocess.PIPE, universal_newlines=True)
+        if result.returncode != 0:
+            return self.respond(503, result.stderr.strip())
+        return self.respond(200, result.stdout.strip())
+
+
+# the token is only sent over TLS, with the certificate which cluster-api-manager trusts for this machine
+context = ssl.SSLContext(ssl.PROTOCOL_TLS_SERVER)
+context.load_cert_chain("/root/.sharing-io-pair-session.crt", "/root/.sharing-io-pair-session.key")
+server = ThreadingHTTPServer(("", int(os.environ["PORT"])), Handler)
+server.socket = context.wrap_socket(server.socket, server_side=True)
+server.serve_forever()
+EOF
+chmod 0755 /usr/local/bin/sharingio-pair-session-server
+
+cat << EOF > /etc/systemd/system/sharingio-pair-session-server.service
+[Unit]
+Description=Serves tmate sessions of the Environment container to sharingio/pair
+After=docker.service
+
+[Service]
+Environment=PORT={{ $.SessionServerPort }}
+ExecStart=/usr/local/bin/sharingio-pair-session-server
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+EOF
+systemctl daemon-reload
+systemctl enable --now sharingio-pair-session-server
+
+# the GitHub OAuth token and env are delivered to the session server by cluster-api-manager, which are read once
+for i in $(seq 120); do
+  [ -f /root/.sharing-io-pair-setup.env ] && break
+  sleep 5
+done
+if [ ! -f /root/.sharing-io-pair-setup.env ]; then
+  echo "error: the setup env wasn't delivered within 10 minutes, unable to set up the instance without it's GitHub OAuth token and env" >&2
+  exit 1
+fi
+cat /root/.sharing-io-pair-setup.env >> /root/.sharing-io-pair-environment.env
+rm -f /root/.sharing-io-pair-setup.env
+
+mkdir -p /home/ii
+docker run -d --name environment --restart unless-stopped \
+  --hostname "${SHARINGIO_PAIR_INSTANCE_NAME}" \
+  --network host \
+  --privileged \
+  --env-file /root/.sharing-io-pair-environment.env \
+  -v /var/run/docker.sock:/var/run/docker.sock \
+  -v /home/ii:/home/ii \
+  "${SHARINGIO_PAIR_INSTANCE_ENVIRONMENT_REPOSITORY}:${SHARINGIO_PAIR_INSTANCE_ENVIRONMENT_VERSION}"
+`
+
+// PlainTemplateResources ...
+// given an instance spec and namespace, return the resources for a Plain instance
+func PlainTemplateResources(instance InstanceSpec, namespace string) (newInstance PlainInstance, err error) {
+	instance.NodeSize = common.ReturnValueOrDefault(instance.NodeSize, GetInstanceDefaultNodeSize())
+	instance.NodeOS = common.ReturnValueOrDefault(instance.NodeOS, GetInstanceDefaultNodeOS())
+	instance.Setup.EnvironmentVersion = common.ReturnValueOrDefault(instance.Setup.EnvironmentVersion, GetEnvironmentVersion())
+	instance.Setup.EnvironmentRepository = common.ReturnValueOrDefault(instance.Setup.EnvironmentRepository, GetEnvironmentRepository())
+	instance = UpdateInstanceSpecIfEnvOverrides(instance)
+	instance.Setup.UserLowercase = strings.ToLower(instance.Setup.User)
+	instance.Setup.BaseDNSName = instance.Name + "." + common.GetBaseHost()
+	instance.Setup.GuestsNamesFlat = strings.Join(instance.Setup.Guests, " ")
+
+	sessionToken, err := plainGenerateSessionToken()
+	if err != nil {
+		return newInstance, fmt.Errorf("Failed to generate session token, %v", err)
+	}
+	sessionCertificate, sessionKey, err := plainGenerateSessionCertificate()
+	if err != nil {
+		return newInstance, fmt.Errorf("Failed to generate session server certificate, %v", err)
+	}
+	tmpl, err := template.New(fmt.Sprintf("pair-instance-plain-bootstrap-%s-%v", instance.Name, time.Now().Unix())).Parse(plainBootstrapTemplate)
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return newInstance, fmt.Errorf("Error templating pair-instance-plain-bootstrap script: %#v", err)
+	}
+	templatedBuffer := new(bytes.Buffer)
+	err = tmpl.Execute(templatedBuffer, map[string]interface{}{
+		"Instance":           instance,
+		"SessionToken":       sessionToken,
+		"SessionCertificate": sessionCertificate,
+		"SessionKey":         sessionKey,
+		"SessionServerPort":  plainSessionServerPort,
+	})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return newInstance, fmt.Errorf("Error templating pair-instance-plain-bootstrap script: %#v", err)
+	}
+	bootstrapScript := templatedBuffer.String()
+
+	labels := map[string]string{
+		"io.sharing.pair":               "instance",
+		"cluster.x-k8s.io/cluster-name": instance.Name,
+	}
+	annotations := map[string]string{
+		"io.sharing.pair-spec-name":       instance.Name,
+		"io.sharing.pair-spec-setup-user": instance.Setup.User,
+	}
+	newInstance = PlainInstance{
+		BootstrapSecret: corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        plainBootstrapSecretName(instance.Name),
+				Namespace:   namespace,
+				Labels:      labels,
+				Annotations: annotations,
+			},
+			Type: "cluster.x-k8s.io/secret",
+			Data: map[string][]byte{
+				"value":              []byte(bootstrapScript),
+				"sessionToken":       []byte(sessionToken),
+				"sessionCertificate": []byte(sessionCertificate),
+			},
+		},
+		PacketCluster: clusterAPIPacketv1beta1.PacketCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        instance.Name,
+				Namespace:   namespace,
+				Labels:      labels,
+				Annotations: annotations,
+			},
+			Spec: clusterAPIPacketv1beta1.PacketClusterSpec{
+				// TODO default value configuration scope - deployment based configuration
+				ProjectID: common.GetPacketProjectID(),
+				Facility:  instance.Facility,
+				ControlPlaneEndpoint: clusterAPIv1beta1.APIEndpoint{
+					Host: "sharing.io",
+					Port: 6443,
+				},
+			},
+		},
+		Cluster: clusterAPIv1beta1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        instance.Name,
+				Namespace:   namespace,
+				Labels:      map[string]string{"io.sharing.pair": "instance"},
+				Annotations: map[string]string{},
+			},
+			Spec: clusterAPIv1beta1.ClusterSpec{
+				InfrastructureRef: &corev1.ObjectReference{
+					APIVersion: servedAPIVersion(clusterAPIPacketv1beta1.GroupVersion),
+					Kind:       "PacketCluster",
+					Name:       instance.Name,
+				},
+			},
+		},
+		PacketMachine: clusterAPIPacketv1beta1.PacketMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        instance.Name,
+				Namespace:   namespace,
+				Labels:      labels,
+				Annotations: annotations,
+			},
+			Spec: clusterAPIPacketv1beta1.PacketMachineSpec{
+				OS:           instance.NodeOS,
+				BillingCycle: "hourly",
+				MachineType:  instance.NodeSize,
+				SSHKeys:      GetInstanceSSHKeys(instance),
+			},
+		},
+		Machine: clusterAPIv1beta1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        instance.Name,
+				Namespace:   namespace,
+				Labels:      labels,
+				Annotations: annotations,
+			},
+			Spec: clusterAPIv1beta1.MachineSpec{
+				ClusterName: instance.Name,
+				Bootstrap: clusterAPIv1beta1.Bootstrap{
+					DataSecretName: &[]string{plainBootstrapSecretName(instance.Name)}[0],
+				},
+				InfrastructureRef: corev1.ObjectReference{
+					APIVersion: servedAPIVersion(clusterAPIPacketv1beta1.GroupVersion),
+					Kind:       "PacketMachine",
+					Name:       instance.Name,
+				},
+			},
+		},
+		PairInstance: NewPairInstance(instance, namespace),
+	}
+	return newInstance, nil
+}
+
+// PlainInstanceResources ...
+// returns the resources of a Plain instance, in the order to create them, starting with their owning Cluster
+func PlainInstanceResources(newInstance PlainInstance) []instanceResource {
+	resources := []instanceResource{
+		{"Cluster", clusterAPIv1beta1.GroupVersion.WithResource("clusters"), "Cluster", &newInstance.Cluster},
+		{"PairInstance", PairInstanceGroupVersionResource, "PairInstance", newInstance.PairInstance},
+		{"BootstrapSecret", corev1.SchemeGroupVersion.WithResource("secrets"), "Secret", newInstance.BootstrapSecret},
+		{"PacketCluster", clusterAPIPacketv1beta1.GroupVersion.WithResource("packetclusters"), "PacketCluster", &newInstance.PacketCluster},
+		{"PacketMachine", clusterAPIPacketv1beta1.GroupVersion.WithResource("packetmachines"), "PacketMachine", &newInstance.PacketMachine},
+		{"Machine", clusterAPIv1beta1.GroupVersion.WithResource("machines"), "Machine", &newInstance.Machine},
+	}
+	if newInstance.SetupSecret.ObjectMeta.Name != "" {
+		resources = append(resources, instanceResource{"SetupSecret", corev1.SchemeGroupVersion.WithResource("secrets"), "Secret", newInstance.SetupSecret})
+	}
+	return resources
+}
+
+// PlainRenderManifests ...
+// returns the resources and bootstrap script templated for a Plain instance
+func PlainRenderManifests(instance InstanceSpec, newInstance PlainInstance) (manifests InstanceManifests, err error) {
+	manifests.Instance = instance
+	for _, resource := range PlainInstanceResources(newInstance) {
+		err = manifests.AddResource(resource.Object, resource.GroupVersionResource.GroupVersion().WithKind(resource.Kind))
+		if err != nil {
+			return InstanceManifests{}, err
+		}
+	}
+	manifests.Scripts = map[string]string{
+		"machine/bootstrap": string(newInstance.BootstrapSecret.Data["value"]),
+	}
+	return manifests, nil
+}
+
+// PlainCreate ...
+// create a Plain instance
+func PlainCreate(instance InstanceSpec, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, options InstanceCreateOptions) (instanceCreated InstanceSpec, manifests InstanceManifests, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	newInstance, err := PlainTemplateResources(instance, targetNamespace)
+	if err != nil {
+		return instanceCreated, manifests, err
+	}
+	instanceCreated = instance
+
+	if options.DryRun == true {
+		log.Println("Exiting before create due to dry run")
+		manifests, err = PlainRenderManifests(instance, newInstance)
+		return instanceCreated, manifests, err
+	}
+
+	newInstance.SetupSecret, err = templateSetupSecret(instance, nil)
+	if err != nil {
+		return instanceCreated, manifests, err
+	}
+	newInstance.PairInstance = pairInstanceWithOwner(newInstance.PairInstance, options.Groups, options.Admin)
+	err = createInstanceResources(dynamicClient, targetNamespace, PlainInstanceResources(newInstance))
+	if err != nil {
+		return instanceCreated, manifests, err
+	}
+
+	return instanceCreated, manifests, nil
+}
+
+// PlainGet ...
+// get a Plain instance
+func PlainGet(name string, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) (instance Instance, err error) {
+	targetNamespace := common.GetTargetNamespace()
+
+	//   - newInstance.Cluster
+	groupVersion := clusterAPIv1beta1.GroupVersion
+	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "clusters"}
+	item, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return Instance{}, nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return instance, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+	var itemRestructuredC clusterAPIv1beta1.Cluster
+	err = restructure(item, &itemRestructuredC)
+	if err != nil {
+		return Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructuredC)
+	}
+	if itemRestructuredC.ObjectMeta.Labels["io.sharing.pair"] != "instance" {
+		log.Printf("Not using object %s/%T/%s - not an instance managed by sharingio/pair\n", targetNamespace, itemRestructuredC, itemRestructuredC.ObjectMeta.Name)
+		return Instance{}, nil
+	}
+	spec, err := GetInstanceSpecOfCluster(&itemRestructuredC, dynamicClient)
+	if err != nil {
+		return Instance{}, err
+	}
+	return plainInstanceOfCluster(itemRestructuredC, spec, dynamicClient, clientset)
+}
+
+// plainInstanceOfCluster ...
+// returns the Plain instance of a Cluster and it's spec
+func plainInstanceOfCluster(cluster clusterAPIv1beta1.Cluster, spec InstanceSpec, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) (instance Instance, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	name := cluster.ObjectMeta.Name
+	if spec.Type != InstanceTypePlain {
+		return Instance{}, nil
+	}
+	instance.Spec = spec
+	instance.Status.Resources.Cluster = cluster.Status
+
+	//   - newInstance.Machine
+	machine, err := plainGetMachine(dynamicClient, name)
+	if err != nil {
+		log.Printf("%#v\n", err)
+	} else {
+		instance.Status.Resources.MachineStatus = machine.Status
+	}
+
+	//   - newInstance.PacketMachine
+	groupVersion := clusterAPIPacketv1beta1.GroupVersion
+	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetmachines"}
+	item, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+	} else {
+		var itemRestructuredPM clusterAPIPacketv1beta1.PacketMachine
+		err = restructure(item, &itemRestructuredPM)
+		if err != nil {
+			return Instance{}, fmt.Errorf("Failed to restructure %T", itemRestructuredPM)
+		}
+		var providerID string
+		if itemRestructuredPM.Spec.ProviderID != nil {
+			providerID = *itemRestructuredPM.Spec.ProviderID
+		}
+		providerIDSplit := strings.Split(providerID, "/")
+		if len(providerIDSplit) == 3 {
+			instance.Status.Resources.PacketMachineUID = &providerIDSplit[2]
+		}
+	}
+
+	tmateSSH, err := PlainGetTmateSSHSession(dynamicClient, clientset, name)
+	if err != nil {
+		log.Printf("err: %#v\n", err.Error())
+	}
+	log.Printf("Instance '%v' tmate session: '%v'", instance.Spec.Name, tmateSSH)
+	instance.Status.Phase = InstanceStatusPhaseProvisioning
+	if instance.Status.Resources.Cluster.Phase == string(InstanceStatusPhaseDeleting) {
+		instance.Status.Phase = InstanceStatusPhaseDeleting
+	} else if firstSnippit := strings.Split(tmateSSH, " "); firstSnippit[0] == "ssh" {
+		instance.Status.Phase = InstanceStatusPhaseProvisioned
+	}
+	log.Printf("Instance '%v' is at phase '%v'", instance.Spec.Name, instance.Status.Phase)
+	instance.Status.ExpiresIn = InstanceRemainingLifetime(instance.Spec)
+
+	return instance, nil
+}
+
+// PlainList ...
+// list all Plain instances
+func PlainList(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, options InstanceListOptions) (instances []Instance, err error) {
+	targetNamespace := common.GetTargetNamespace()
+
+	groupVersion := clusterAPIv1beta1.GroupVersion
+	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "clusters"}
+	items, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "io.sharing.pair=instance"})
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+		return instances, fmt.Errorf("Failed to list Cluster, %#v", err)
+	}
+	if items == nil {
+		return []Instance{}, fmt.Errorf("Failed to list Clusters")
+	}
+
+	specs, err := listPairInstanceSpecs(dynamicClient)
+	if err != nil {
+		return instances, err
+	}
+
+	for _, item := range items.Items {
+		spec, ok := specs[item.GetName()]
+		if ok != true || spec.Type != InstanceTypePlain {
+			continue
+		}
+		if options.Filter.Username != "" && spec.Setup.User != options.Filter.Username {
+			log.Printf("Not using object %s/Cluster/%s - not related to username\n", targetNamespace, item.GetName())
+			continue
+		}
+		var itemRestructured clusterAPIv1beta1.Cluster
+		err = restructure(&item, &itemRestructured)
+		if err != nil {
+			return instances, fmt.Errorf("Failed to restructure %T", itemRestructured)
+		}
+		instance, err := plainInstanceOfCluster(itemRestructured, spec, dynamicClient, clientset)
+		if err != nil {
+			return instances, err
+		}
+		if instance.Spec.Name == "" {
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// PlainDelete ...
+// delete a Plain instance
+func PlainDelete(name string, dynamicClient dynamic.Interface) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+
+	// NOTE usage isn't recorded again once the Cluster is deleting
+	err = RecordInstanceUsage(name, dynamicClient)
+	if err != nil {
+		return err
+	}
+
+	// manifests
+
+	//   - newInstance.Machine
+	groupVersion := clusterAPIv1beta1.GroupVersion
+	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "machines"}
+	log.Printf("%#v\n", groupVersionResource)
+	err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to delete Machine, %#v", err)
+	}
+
+	//   - newInstance.PacketMachine
+	groupVersion = clusterAPIPacketv1beta1.GroupVersion
+	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "infrastructure.cluster.x-k8s.io", Resource: "packetmachines"}
+	log.Printf("%#v\n", groupVersionResource)
+	err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to delete PacketMachine, %#v", err)
+	}
+
+	//   - newInstance.Cluster
+	groupVersion = clusterAPIv1beta1.GroupVersion
+	groupVersionResource = schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "clusters"}
+	log.Printf("%#v\n", groupVersionResource)
+	err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to delete Cluster, %#v", err)
+	}
+
+	//   - newInstance.BootstrapSecret
+	groupVersionResource = schema.GroupVersionResource{Version: "v1", Group: "", Resource: "secrets"}
+	log.Printf("%#v\n", groupVersionResource)
+	err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Delete(context.TODO(), plainBootstrapSecretName(name), metav1.DeleteOptions{})
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to delete bootstrap Secret, %#v", err)
+	}
+
+	//   - setup Secret
+	err = deleteSetupSecret(dynamicClient, name)
+	if err != nil {
+		return err
+	}
+
+	//   - newInstance.DNSEndpoint
+	groupVersionResource = schema.GroupVersionResource{Version: "v1alpha1", Group: "externaldns.k8s.io", Resource: "dnsendpoints"}
+	log.Printf("%#v\n", groupVersionResource)
+	err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: "io.sharing.pair-spec-name=" + name})
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to delete DNSEndpoint, %#v", err)
+	}
+
+	return nil
+}
+
+// plainGetMachine ...
+// returns the Machine of a Plain instance
+func plainGetMachine(dynamicClient dynamic.Interface, name string) (machine clusterAPIv1beta1.Machine, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersion := clusterAPIv1beta1.GroupVersion
+	groupVersionResource := schema.GroupVersionResource{Version: groupVersion.Version, Group: "cluster.x-k8s.io", Resource: "machines"}
+	item, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return machine, fmt.Errorf("Failed to get Machine, %#v", err)
+	}
+	err = restructure(item, &machine)
+	if err != nil {
+		return machine, fmt.Errorf("Failed to restructure %T", machine)
+	}
+	return machine, nil
+}
+
+// PlainGetMachineIP ...
+// returns the public IPv4 address of a Plain instance's machine
+func PlainGetMachineIP(dynamicClient dynamic.Interface, name string) (ipAddress string, err error) {
+	machine, err := plainGetMachine(dynamicClient, name)
+	if err != nil {
+		return "", err
+	}
+	for _, address := range machine.Status.Addresses {
+		if address.Type == clusterAPIv1beta1.MachineExternalIP && govalidator.IsIPv4(address.Address) {
+			return address.Address, nil
+		}
+	}
+	return "", fmt.Errorf("machine has no public IPv4 address")
+}
+
+// PlainAddMachineIPToDNS ...
+// upsert the DNS records for a Plain instance to it's machine's IP
+func PlainAddMachineIPToDNS(dynamicClient dynamic.Interface, name string) (err error) {
+	ipAddress, err := PlainGetMachineIP(dynamicClient, name)
+	if err != nil {
+		log.Printf("error: %v\n", err)
+		return err
+	}
+	log.Println("machine IP available:", ipAddress)
+	entry := dns.Entry{
+		Subdomain: name,
+		Values: []string{
+			ipAddress,
+		},
+	}
+	err = dns.UpsertDNSEndpoint(dynamicClient, entry, name)
+	if err != nil {
+		log.Printf("%#v\n", err)
+	}
+	return err
+}
+
+// plainSessionServerRequest ...
+// make a request to the session server on a Plain instance's machine, returning it's status code and body
+func plainSessionServerRequest(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, name string, method string, path string, body []byte) (statusCode int, output string, err error) {
+	secret, err := clientset.CoreV1().Secrets(common.GetTargetNamespace()).Get(context.TODO(), plainBootstrapSecretName(name), metav1.GetOptions{})
+	if err != nil {
+		return 0, "", fmt.Errorf("Failed to get bootstrap Secret, %v", err)
+	}
+	ipAddress, err := PlainGetMachineIP(dynamicClient, name)
+	if err != nil {
+		return 0, "", err
+	}
+	// NOTE the session server is only trusted by the certificate generated for it, so the token isn't sent to anything else at it's address
+	certificatePool := x509.NewCertPool()
+	if certificatePool.AppendCertsFromPEM(secret.Data["sessionCertificate"]) != true {
+		return 0, "", fmt.Errorf("Failed to find the session server certificate of instance '%v'", name)
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("https://%v:%v%v", ipAddress, plainSessionServerPort, path), bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Add("Authorization", "Bearer "+string(secret.Data["sessionToken"]))
+	client := &http.Client{
+		Timeout: plainSessionServerTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:    certificatePool,
+				ServerName: plainSessionServerName,
+				MinVersion: tls.VersionTLS12,
+			},
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, strings.TrimSpace(string(respBody)), nil
+}
+
+// plainGetSession ...
+// fetch a tmate session from the session server on a Plain instance's machine
+func plainGetSession(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, name string, path string) (output string, err error) {
+	statusCode, output, err := plainSessionServerRequest(dynamicClient, clientset, name, http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+	if statusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed to get session from machine (%v): %v", statusCode, output)
+	}
+	return output, nil
+}
+
+// PlainGetTmateSSHSession ...
+// given a Plain instance name, get the tmate SSH session for the Environment container
+func PlainGetTmateSSHSession(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, name string) (output string, err error) {
+	return plainGetSession(dynamicClient, clientset, name, "/tmate/ssh")
+}
+
+// PlainGetTmateWebSession ...
+// given a Plain instance name, get the tmate web session for the Environment container
+func PlainGetTmateWebSession(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, name string) (output string, err error) {
+	return plainGetSession(dynamicClient, clientset, name, "/tmate/web")
+}
@@ -0,0 +1,53 @@
+package instances
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+)
+
+func TestPlainRenderManifestsWithoutSetupValues(t *testing.T) {
+	t.Setenv("APP_INFRASTRUCTURE_PROVIDER", "packet")
+	instance := InstanceSpec{
+		Name: "bobymcbobs-exjk",
+		Type: InstanceTypePlain,
+		Setup: types.SetupSpec{
+			User:             "BobyMCbobs",
+			GitHubOAuthToken: "gho_abcdef",
+			Env:              []map[string]string{{"EDITOR": "emacs-nox", "NPM_TOKEN": "npm_abcdef"}},
+		},
+	}
+	newInstance, err := PlainTemplateResources(instance, "sharingio-pair")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	manifests, err := PlainRenderManifests(instance, newInstance)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rendered, err := json.Marshal(manifests.Resources)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bootstrap := manifests.Scripts["machine/bootstrap"]
+	if strings.Contains(bootstrap, "SHARINGIO_PAIR_INSTANCE_SETUP_USER=\"BobyMCbobs\"") != true {
+		t.Errorf("expected the bootstrap script to export the user, got:\n%s", bootstrap)
+	}
+	for _, value := range []string{"gho_abcdef", "npm_abcdef", "emacs-nox"} {
+		if strings.Contains(bootstrap, value) == true {
+			t.Errorf("expected the bootstrap script not to contain '%v'", value)
+		}
+	}
+	// NOTE the values of env which isn't secret are kept in the spec of the instance
+	for _, value := range []string{"gho_abcdef", "npm_abcdef"} {
+		if strings.Contains(string(rendered), value) == true {
+			t.Errorf("expected the rendered resources not to contain '%v'", value)
+		}
+	}
+	if strings.Index(bootstrap, "/root/.sharing-io-pair-setup.env") > strings.Index(bootstrap, "docker run") {
+		t.Errorf("expected the bootstrap script to wait for the setup env before starting the Environment")
+	}
+}
@@ -0,0 +1,266 @@
+package instances
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// InstancePreset ...
+// a named spec which instances may be created from, with the fields of their request merged over it
+// swagger:response preset
+type InstancePreset struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Spec        InstanceSpec `json:"spec"`
+}
+
+// PresetNotFoundError ...
+// a preset which doesn't exist
+type PresetNotFoundError struct {
+	Name string
+}
+
+func (e PresetNotFoundError) Error() string {
+	return fmt.Sprintf("Preset '%v' not found", e.Name)
+}
+
+// PresetInvalidError ...
+// a preset which can't be stored
+type PresetInvalidError struct {
+	Reason string
+}
+
+func (e PresetInvalidError) Error() string {
+	return e.Reason
+}
+
+// misc preset vars
+var (
+	// presetConfigMapPrefix is the prefix of the ConfigMap which stores each preset
+	presetConfigMapPrefix = "sharingio-pair-preset-"
+	// presetLabelSelector is the labels of the ConfigMaps which store presets
+	presetLabelSelector = "io.sharing.pair=preset"
+)
+
+// presetFromConfigMap ...
+// returns the preset stored in a ConfigMap
+func presetFromConfigMap(item *unstructured.Unstructured) (preset InstancePreset, err error) {
+	name, _, _ := unstructured.NestedString(item.Object, "metadata", "labels", "io.sharing.pair-preset-name")
+	description, _, _ := unstructured.NestedString(item.Object, "data", "description")
+	spec, _, _ := unstructured.NestedString(item.Object, "data", "spec")
+	preset = InstancePreset{
+		Name:        name,
+		Description: description,
+	}
+	err = json.Unmarshal([]byte(spec), &preset.Spec)
+	if err != nil {
+		return InstancePreset{}, fmt.Errorf("Failed to parse spec of preset '%v', %v", name, err)
+	}
+	return preset, nil
+}
+
+// presetToConfigMap ...
+// returns the ConfigMap which stores a preset
+func presetToConfigMap(preset InstancePreset) (item *unstructured.Unstructured, err error) {
+	spec, err := json.Marshal(preset.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal spec of preset '%v', %v", preset.Name, err)
+	}
+	return common.ObjectToUnstructured(corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: presetConfigMapPrefix + preset.Name,
+			Labels: map[string]string{
+				"io.sharing.pair":             "preset",
+				"io.sharing.pair-preset-name": preset.Name,
+			},
+		},
+		Data: map[string]string{
+			"description": preset.Description,
+			"spec":        string(spec),
+		},
+	})
+}
+
+// validatePreset ...
+// returns a preset without the fields which belong to each instance, or an error if it's invalid
+func validatePreset(preset InstancePreset) (InstancePreset, error) {
+	if common.ValidateName(preset.Name) != true || preset.Name == "" || len(preset.Name) > 40 {
+		return InstancePreset{}, PresetInvalidError{Reason: fmt.Sprintf("Invalid preset name '%v', must be up to 40 lowercase alphanumeric characters or '-'", preset.Name)}
+	}
+	switch preset.Spec.Type {
+	case InstanceTypeKubernetes, InstanceTypePlain, "":
+	default:
+		return InstancePreset{}, PresetInvalidError{Reason: fmt.Sprintf("Invalid instance type '%v'", preset.Spec.Type)}
+	}
+	// NOTE the fields of each instance are left for it's request
+	preset.Spec.Name = ""
+	preset.Spec.Preset = ""
+	preset.Spec.ExpiresAt = nil
+	preset.Spec.Setup.User = ""
+	preset.Spec.Setup.GitHubOAuthToken = ""
+	preset.Spec.Setup.RestoreBackup = ""
+	// NOTE presets are readable by everyone, so they can't hold secrets
+	for _, item := range preset.Spec.Setup.Env {
+		for key := range item {
+			if IsSecretEnvKey(key) {
+				return InstancePreset{}, PresetInvalidError{Reason: fmt.Sprintf("Presets can't have secret env '%v', set it when creating an instance instead", key)}
+			}
+		}
+	}
+	err := validateWorkerPools(preset.Spec)
+	if err != nil {
+		return InstancePreset{}, PresetInvalidError{Reason: err.Error()}
+	}
+	err = ValidateInstanceCatalog(preset.Spec)
+	if err != nil {
+		return InstancePreset{}, PresetInvalidError{Reason: err.Error()}
+	}
+	return preset, nil
+}
+
+// ListPresets ...
+// returns the presets, sorted by name
+func ListPresets(dynamicClient dynamic.Interface) (presets []InstancePreset, err error) {
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("configmaps")
+	items, err := dynamicClient.Resource(groupVersionResource).Namespace(common.GetTargetNamespace()).List(context.TODO(), metav1.ListOptions{LabelSelector: presetLabelSelector})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return nil, fmt.Errorf("Failed to list presets, %#v", err)
+	}
+	presets = []InstancePreset{}
+	for i := range items.Items {
+		preset, err := presetFromConfigMap(&items.Items[i])
+		if err != nil {
+			log.Printf("%v\n", err)
+			continue
+		}
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+	return presets, nil
+}
+
+// GetPreset ...
+// returns a preset, or a PresetNotFoundError
+func GetPreset(name string, dynamicClient dynamic.Interface) (preset InstancePreset, err error) {
+	if common.ValidateName(name) != true || name == "" {
+		return InstancePreset{}, PresetNotFoundError{Name: name}
+	}
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("configmaps")
+	item, err := dynamicClient.Resource(groupVersionResource).Namespace(common.GetTargetNamespace()).Get(context.TODO(), presetConfigMapPrefix+name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return InstancePreset{}, PresetNotFoundError{Name: name}
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return InstancePreset{}, fmt.Errorf("Failed to get preset, %#v", err)
+	}
+	return presetFromConfigMap(item)
+}
+
+// CreatePreset ...
+// store a new preset
+func CreatePreset(preset InstancePreset, dynamicClient dynamic.Interface) (presetCreated InstancePreset, err error) {
+	preset, err = validatePreset(preset)
+	if err != nil {
+		return InstancePreset{}, err
+	}
+	item, err := presetToConfigMap(preset)
+	if err != nil {
+		return InstancePreset{}, err
+	}
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("configmaps")
+	_, err = dynamicClient.Resource(groupVersionResource).Namespace(common.GetTargetNamespace()).Create(context.TODO(), item, metav1.CreateOptions{})
+	if err != nil && apierrors.IsAlreadyExists(err) {
+		return InstancePreset{}, PresetInvalidError{Reason: fmt.Sprintf("Preset '%v' already exists", preset.Name)}
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return InstancePreset{}, fmt.Errorf("Failed to create preset, %#v", err)
+	}
+	log.Printf("Created preset '%v'\n", preset.Name)
+	return preset, nil
+}
+
+// UpdatePreset ...
+// replace the description and spec of a preset
+func UpdatePreset(name string, preset InstancePreset, dynamicClient dynamic.Interface) (presetUpdated InstancePreset, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	preset.Name = name
+	preset, err = validatePreset(preset)
+	if err != nil {
+		return InstancePreset{}, err
+	}
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("configmaps")
+	item, err := dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Get(context.TODO(), presetConfigMapPrefix+name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return InstancePreset{}, PresetNotFoundError{Name: name}
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return InstancePreset{}, fmt.Errorf("Failed to get preset, %#v", err)
+	}
+	updated, err := presetToConfigMap(preset)
+	if err != nil {
+		return InstancePreset{}, err
+	}
+	item.Object["data"] = updated.Object["data"]
+	_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Update(context.TODO(), item, metav1.UpdateOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return InstancePreset{}, fmt.Errorf("Failed to update preset, %#v", err)
+	}
+	log.Printf("Updated preset '%v'\n", name)
+	return preset, nil
+}
+
+// DeletePreset ...
+// delete a preset, which doesn't change the instances created from it
+func DeletePreset(name string, dynamicClient dynamic.Interface) (err error) {
+	if common.ValidateName(name) != true || name == "" {
+		return PresetNotFoundError{Name: name}
+	}
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("configmaps")
+	err = dynamicClient.Resource(groupVersionResource).Namespace(common.GetTargetNamespace()).Delete(context.TODO(), presetConfigMapPrefix+name, metav1.DeleteOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return PresetNotFoundError{Name: name}
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to delete preset, %#v", err)
+	}
+	log.Printf("Deleted preset '%v'\n", name)
+	return nil
+}
+
+// InstanceSpecFromRequest ...
+// returns the spec of an instance from the body of a request to create it, with it's fields merged over the preset it names
+func InstanceSpecFromRequest(body []byte, dynamicClient dynamic.Interface) (instance InstanceSpec, err error) {
+	requested := struct {
+		Preset string `json:"preset"`
+	}{}
+	json.Unmarshal(body, &requested)
+	if requested.Preset != "" {
+		preset, err := GetPreset(requested.Preset, dynamicClient)
+		if err != nil {
+			return InstanceSpec{}, err
+		}
+		instance = preset.Spec
+	}
+	// NOTE fields of the request replace those of the preset, where lists and maps are replaced whole
+	json.Unmarshal(body, &instance)
+	return instance, nil
+}
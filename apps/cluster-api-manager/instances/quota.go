@@ -0,0 +1,551 @@
+package instances
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// instanceUsageRecordedAtAnnotation is when the usage of an instance was last recorded, on it's Cluster
+const instanceUsageRecordedAtAnnotation = "io.sharing.pair-usageRecordedAt"
+
+// instanceOwnerGroupsAnnotation is the groups of the owner of an instance when they created it, on it's PairInstance
+const instanceOwnerGroupsAnnotation = "io.sharing.pair-ownerGroups"
+
+// instanceOwnerAdminAnnotation is if the owner of an instance was an admin when they created it, on it's PairInstance
+const instanceOwnerAdminAnnotation = "io.sharing.pair-ownerAdmin"
+
+// QuotaLimits ...
+// the limits of a quota. Unset limits are unlimited
+type QuotaLimits struct {
+	// Instances is the max number of instances
+	Instances *int `json:"instances,omitempty"`
+	// Nodes is the max total of Kubernetes nodes across instances
+	Nodes *int `json:"nodes,omitempty"`
+	// NodeSizes are the node sizes which may be used, or any when empty
+	NodeSizes []string `json:"nodeSizes,omitempty"`
+	// MachineHoursPerMonth is the max hours of machines running in a calendar month (UTC)
+	MachineHoursPerMonth *float64 `json:"machineHoursPerMonth,omitempty"`
+}
+
+// QuotaConfig ...
+// the quotas of everyone, declared as JSON in APP_QUOTAS.
+// The quota of a user replaces the default, otherwise the most generous of the quotas of their groups does
+type QuotaConfig struct {
+	Default QuotaLimits            `json:"default"`
+	Users   map[string]QuotaLimits `json:"users,omitempty"`
+	Groups  map[string]QuotaLimits `json:"groups,omitempty"`
+}
+
+// QuotaUsage ...
+// what a user has used of their quota
+type QuotaUsage struct {
+	Instances    int     `json:"instances"`
+	Nodes        int     `json:"nodes"`
+	MachineHours float64 `json:"machineHours"`
+}
+
+// Quota ...
+// the limits and usage of a user
+// swagger:response quota
+type Quota struct {
+	Username string `json:"username"`
+	// Admin is if the user is an admin, who isn't limited
+	Admin  bool        `json:"admin"`
+	Limits QuotaLimits `json:"limits"`
+	Usage  QuotaUsage  `json:"usage"`
+	// Period is the month which machine hours are counted in
+	Period string `json:"period"`
+}
+
+// QuotaSubject ...
+// who a quota is resolved for
+type QuotaSubject struct {
+	Username string
+	Groups   []string
+	Admin    bool
+}
+
+// QuotaExceededError ...
+// returned when creating or updating an instance would exceed the quota of it's owner
+type QuotaExceededError struct {
+	Reason string
+}
+
+func (e QuotaExceededError) Error() string {
+	return e.Reason
+}
+
+// misc quota vars
+var (
+	// quotaLockConfigMapPrefix is the prefix of the ConfigMap which locks the quota of a user, so that it's checked and used one request at a time across replicas
+	quotaLockConfigMapPrefix = "sharingio-pair-quota-lock-"
+	// quotaLockTTL is how long a quota lock may be held before it's taken over, such as when it's holder stopped
+	quotaLockTTL = 2 * time.Minute
+	// quotaLockTimeout is how long to wait for the quota lock of a user
+	quotaLockTimeout = 30 * time.Second
+	// quotaUsageConfigMapPrefix is the prefix of the ConfigMap which records machine hours of removed machines, for each month
+	quotaUsageConfigMapPrefix = "sharingio-pair-usage-"
+)
+
+// GetQuotaConfig ...
+// returns the quotas declared in APP_QUOTAS, with the default instance count from APP_NON_ADMIN_INSTANCE_MAX_AMOUNT when not declared
+func GetQuotaConfig() (config QuotaConfig) {
+	if quotas := common.GetEnvOrDefault("APP_QUOTAS", ""); quotas != "" {
+		err := json.Unmarshal([]byte(quotas), &config)
+		if err != nil {
+			log.Printf("Failed to parse APP_QUOTAS, %v\n", err)
+			config = QuotaConfig{}
+		}
+	}
+	if max := common.GetNonAdminInstanceMaxAmount(); config.Default.Instances == nil && max >= 0 {
+		config.Default.Instances = &max
+	}
+	return config
+}
+
+// mostGenerousInt ...
+// returns the larger limit, where nil is unlimited
+func mostGenerousInt(a *int, b *int) *int {
+	if a == nil || b == nil {
+		return nil
+	}
+	if *b > *a {
+		return b
+	}
+	return a
+}
+
+// mostGenerousFloat ...
+// returns the larger limit, where nil is unlimited
+func mostGenerousFloat(a *float64, b *float64) *float64 {
+	if a == nil || b == nil {
+		return nil
+	}
+	if *b > *a {
+		return b
+	}
+	return a
+}
+
+// ResolveQuotaLimits ...
+// returns the limits of a user, from their own quota, the quotas of their groups or the default
+func ResolveQuotaLimits(subject QuotaSubject) QuotaLimits {
+	config := GetQuotaConfig()
+	for username, limits := range config.Users {
+		if strings.EqualFold(username, subject.Username) {
+			return limits
+		}
+	}
+
+	var limits *QuotaLimits
+	for _, group := range subject.Groups {
+		groupLimits, ok := config.Groups[group]
+		if ok != true {
+			continue
+		}
+		if limits == nil {
+			limits = &groupLimits
+			continue
+		}
+		limits.Instances = mostGenerousInt(limits.Instances, groupLimits.Instances)
+		limits.Nodes = mostGenerousInt(limits.Nodes, groupLimits.Nodes)
+		limits.MachineHoursPerMonth = mostGenerousFloat(limits.MachineHoursPerMonth, groupLimits.MachineHoursPerMonth)
+		if len(limits.NodeSizes) == 0 || len(groupLimits.NodeSizes) == 0 {
+			limits.NodeSizes = nil
+		} else {
+			// NOTE copied, as appending may write into the node sizes of the first group
+			nodeSizes := append([]string{}, limits.NodeSizes...)
+			limits.NodeSizes = append(nodeSizes, groupLimits.NodeSizes...)
+		}
+	}
+	if limits != nil {
+		return *limits
+	}
+	return config.Default
+}
+
+// quotaLockName ...
+// returns the name of the ConfigMap which locks the quota of a user, as their username may not be a valid name
+func quotaLockName(username string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(username)))
+	return quotaLockConfigMapPrefix + hex.EncodeToString(sum[:])[:16]
+}
+
+// lockQuota ...
+// hold the quota lock of a user, returning the func to release it.
+// The lock is a ConfigMap which only one request may create, and it's only deleted by the request which created it.
+// A lock held for longer than quotaLockTTL is taken over
+func lockQuota(username string, dynamicClient dynamic.Interface) (unlock func(), err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("configmaps")
+	name := quotaLockName(username)
+	deadline := time.Now().Add(quotaLockTimeout)
+	for {
+		lock, err := common.ObjectToUnstructured(corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					"io.sharing.pair": "quota-lock",
+				},
+			},
+			Data: map[string]string{
+				"username": strings.ToLower(username),
+				"lockedAt": time.Now().UTC().Format(time.RFC3339),
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unstructure quota lock, %#v", err)
+		}
+		created, err := dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Create(context.TODO(), lock, metav1.CreateOptions{})
+		if err == nil {
+			resourceVersion := created.GetResourceVersion()
+			return func() {
+				err := dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion}})
+				if err != nil && apierrors.IsNotFound(err) != true {
+					log.Printf("Failed to release the quota lock of '%v', %v\n", username, err)
+				}
+			}, nil
+		} else if apierrors.IsAlreadyExists(err) != true {
+			log.Printf("%#v\n", err)
+			return nil, fmt.Errorf("Failed to lock quota, %#v", err)
+		}
+
+		existing, err := dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil && apierrors.IsNotFound(err) != true {
+			log.Printf("%#v\n", err)
+			return nil, fmt.Errorf("Failed to get quota lock, %#v", err)
+		}
+		if err == nil {
+			lockedAtValue, _, _ := unstructured.NestedString(existing.Object, "data", "lockedAt")
+			if lockedAt, err := time.Parse(time.RFC3339, lockedAtValue); err != nil || time.Since(lockedAt) > quotaLockTTL {
+				// NOTE only the expired lock is deleted, in case it has been taken over in the meantime
+				resourceVersion := existing.GetResourceVersion()
+				log.Printf("Taking over the expired quota lock of '%v'\n", username)
+				dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion}})
+				continue
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("Timed out waiting for the quota lock of '%v'", username)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// pairInstanceWithOwner ...
+// returns a PairInstance with the groups of it's owner and if they're an admin, for resolving their quota when someone else updates it
+func pairInstanceWithOwner(pairInstance PairInstance, groups []string, admin bool) PairInstance {
+	if len(groups) == 0 && admin != true {
+		return pairInstance
+	}
+	if pairInstance.ObjectMeta.Annotations == nil {
+		pairInstance.ObjectMeta.Annotations = map[string]string{}
+	}
+	if len(groups) > 0 {
+		groupsJSON, _ := json.Marshal(groups)
+		pairInstance.ObjectMeta.Annotations[instanceOwnerGroupsAnnotation] = string(groupsJSON)
+	}
+	if admin == true {
+		pairInstance.ObjectMeta.Annotations[instanceOwnerAdminAnnotation] = "true"
+	}
+	return pairInstance
+}
+
+// ownerQuotaSubject ...
+// returns who the quota of an instance is resolved for when it's updated, which is always it's owner.
+// The groups and admin of the caller are only used when they're the owner, otherwise those the owner had when creating it are
+func ownerQuotaSubject(instance InstanceSpec, options InstanceUpdateOptions, dynamicClient dynamic.Interface) (subject QuotaSubject, err error) {
+	subject = QuotaSubject{
+		Username: instance.Setup.User,
+	}
+	if strings.EqualFold(options.Username, instance.Setup.User) {
+		subject.Groups = options.Groups
+		subject.Admin = options.Admin
+		return subject, nil
+	}
+	pairInstance, err := GetPairInstance(instance.Name, dynamicClient)
+	if err != nil {
+		return QuotaSubject{}, err
+	}
+	if pairInstance == nil {
+		return subject, nil
+	}
+	if pairInstance.ObjectMeta.Annotations[instanceOwnerGroupsAnnotation] != "" {
+		err = json.Unmarshal([]byte(pairInstance.ObjectMeta.Annotations[instanceOwnerGroupsAnnotation]), &subject.Groups)
+		if err != nil {
+			return QuotaSubject{}, fmt.Errorf("Failed to parse the groups of the owner of instance '%v', %v", instance.Name, err)
+		}
+	}
+	subject.Admin = pairInstance.ObjectMeta.Annotations[instanceOwnerAdminAnnotation] == "true"
+	return subject, nil
+}
+
+// quotaPeriod ...
+// returns the name and start of the month which machine hours are counted in
+func quotaPeriod(now time.Time) (period string, start time.Time) {
+	now = now.UTC()
+	return now.Format("2006-01"), time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// instanceMachines ...
+// returns how many machines an instance runs
+func instanceMachines(instance InstanceSpec) int {
+	if instance.Type == InstanceTypeKubernetes {
+		// a control plane and the nodes
+		return 1 + instance.KubernetesNodeCount
+	}
+	return 1
+}
+
+// instanceRunningMachineHours ...
+// returns the machine hours of an instance since it's Cluster was created, it's usage was last recorded or the period started, whichever was later.
+// Deleting and hibernated Clusters aren't running
+func instanceRunningMachineHours(instance InstanceSpec, cluster *unstructured.Unstructured, now time.Time) float64 {
+	if cluster == nil || cluster.GetDeletionTimestamp() != nil || cluster.GetAnnotations()[instanceHibernatedAtAnnotation] != "" {
+		return 0
+	}
+	_, start := quotaPeriod(now)
+	if created := cluster.GetCreationTimestamp().Time; created.After(start) {
+		start = created
+	}
+	if recordedAt, err := time.Parse(time.RFC3339, cluster.GetAnnotations()[instanceUsageRecordedAtAnnotation]); err == nil && recordedAt.After(start) {
+		start = recordedAt
+	}
+	if now.Before(start) {
+		return 0
+	}
+	return now.Sub(start).Hours() * float64(instanceMachines(instance))
+}
+
+// getInstanceCluster ...
+// returns the Cluster of an instance, or nil if it doesn't have one
+func getInstanceCluster(name string, dynamicClient dynamic.Interface) (cluster *unstructured.Unstructured, err error) {
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	cluster, err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(common.GetTargetNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return nil, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+	return cluster, nil
+}
+
+// getRecordedMachineHours ...
+// returns the machine hours recorded for a user in the usage ConfigMap of a period
+func getRecordedMachineHours(username string, period string, dynamicClient dynamic.Interface) (hours float64, err error) {
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("configmaps")
+	item, err := dynamicClient.Resource(groupVersionResource).Namespace(common.GetTargetNamespace()).Get(context.TODO(), quotaUsageConfigMapPrefix+period, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return 0, nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return 0, fmt.Errorf("Failed to get usage ConfigMap, %#v", err)
+	}
+	recorded, _, _ := unstructured.NestedString(item.Object, "data", strings.ToLower(username))
+	if recorded == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(recorded, 64)
+}
+
+// recordMachineHours ...
+// add machine hours to a user, in the usage ConfigMap of a period
+func recordMachineHours(username string, period string, hours float64, dynamicClient dynamic.Interface) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("configmaps")
+	key := strings.ToLower(username)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		item, err := dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Get(context.TODO(), quotaUsageConfigMapPrefix+period, metav1.GetOptions{})
+		if err != nil && apierrors.IsNotFound(err) {
+			configMap, err := common.ObjectToUnstructured(corev1.ConfigMap{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "v1",
+					Kind:       "ConfigMap",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name: quotaUsageConfigMapPrefix + period,
+					Labels: map[string]string{
+						"io.sharing.pair": "usage",
+					},
+				},
+				Data: map[string]string{
+					key: strconv.FormatFloat(hours, 'f', 2, 64),
+				},
+			})
+			if err != nil {
+				return err
+			}
+			_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Create(context.TODO(), configMap, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// created in the meantime, so try again as a conflict
+				return apierrors.NewConflict(groupVersionResource.GroupResource(), quotaUsageConfigMapPrefix+period, err)
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+		recorded, _, _ := unstructured.NestedString(item.Object, "data", key)
+		recordedHours, _ := strconv.ParseFloat(recorded, 64)
+		err = unstructured.SetNestedField(item.Object, strconv.FormatFloat(recordedHours+hours, 'f', 2, 64), "data", key)
+		if err != nil {
+			return err
+		}
+		_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Update(context.TODO(), item, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// RecordInstanceUsage ...
+// record the machine hours an instance has run for this period, before it's machines are removed
+func RecordInstanceUsage(name string, dynamicClient dynamic.Interface) (err error) {
+	instance, err := GetSpec(name, dynamicClient)
+	if err != nil || instance.Name == "" {
+		return err
+	}
+	cluster, err := getInstanceCluster(name, dynamicClient)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	hours := instanceRunningMachineHours(instance, cluster, now)
+	if hours <= 0 {
+		return nil
+	}
+	period, _ := quotaPeriod(now)
+	err = recordMachineHours(instance.Setup.User, period, hours, dynamicClient)
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to record usage of instance '%v', %#v", name, err)
+	}
+	// the recorded hours aren't counted again, such as when the nodes of an instance are scaled
+	err = setResourceAnnotation(dynamicClient, clusterAPIv1beta1.GroupVersion.WithResource("clusters"), name, instanceUsageRecordedAtAnnotation, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("Failed to annotate when the usage of instance '%v' was recorded, %v\n", name, err)
+	}
+	return nil
+}
+
+// GetQuotaUsage ...
+// returns what a user has used of their quota, from their PairInstances and recorded machine hours
+func GetQuotaUsage(username string, dynamicClient dynamic.Interface) (usage QuotaUsage, err error) {
+	now := time.Now()
+	period, _ := quotaPeriod(now)
+	usage.MachineHours, err = getRecordedMachineHours(username, period, dynamicClient)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	items, err := dynamicClient.Resource(PairInstanceGroupVersionResource).Namespace(common.GetTargetNamespace()).List(context.TODO(), metav1.ListOptions{LabelSelector: "io.sharing.pair-spec-setup-user=" + strings.ToLower(username)})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return QuotaUsage{}, fmt.Errorf("Failed to list PairInstances, %#v", err)
+	}
+	for i := range items.Items {
+		pairInstance, err := pairInstanceFromUnstructured(&items.Items[i])
+		if err != nil {
+			return QuotaUsage{}, err
+		}
+		usage.Instances++
+		if pairInstance.Spec.Type == InstanceTypeKubernetes {
+			usage.Nodes += pairInstance.Spec.KubernetesNodeCount
+		}
+		cluster, err := getInstanceCluster(pairInstance.Spec.Name, dynamicClient)
+		if err != nil {
+			return QuotaUsage{}, err
+		}
+		usage.MachineHours += instanceRunningMachineHours(pairInstance.Spec, cluster, now)
+	}
+	usage.MachineHours = math.Round(usage.MachineHours*100) / 100
+	return usage, nil
+}
+
+// GetQuota ...
+// returns the limits and usage of a user
+func GetQuota(subject QuotaSubject, dynamicClient dynamic.Interface) (quota Quota, err error) {
+	quota = Quota{
+		Username: subject.Username,
+		Admin:    subject.Admin,
+	}
+	quota.Period, _ = quotaPeriod(time.Now())
+	if subject.Admin != true {
+		quota.Limits = ResolveQuotaLimits(subject)
+	}
+	quota.Usage, err = GetQuotaUsage(subject.Username, dynamicClient)
+	return quota, err
+}
+
+// CheckQuota ...
+// returns a QuotaExceededError if creating the desired instance, or updating the current one to it, would exceed the quota of the subject.
+// The quota lock of the subject must be held until the instance is created or updated
+func CheckQuota(subject QuotaSubject, desired InstanceSpec, current *InstanceSpec, dynamicClient dynamic.Interface) (err error) {
+	if subject.Admin == true {
+		return nil
+	}
+	limits := ResolveQuotaLimits(subject)
+	usage, err := GetQuotaUsage(subject.Username, dynamicClient)
+	if err != nil {
+		return err
+	}
+
+	if current == nil && limits.Instances != nil && usage.Instances+1 > *limits.Instances {
+		return QuotaExceededError{Reason: fmt.Sprintf("Instance quota reached, using %v of %v instances", usage.Instances, *limits.Instances)}
+	}
+
+	nodes := 0
+	if desired.Type == InstanceTypeKubernetes {
+		nodes = desired.KubernetesNodeCount
+	}
+	if current != nil && current.Type == InstanceTypeKubernetes {
+		nodes -= current.KubernetesNodeCount
+	}
+	if nodes > 0 && limits.Nodes != nil && usage.Nodes+nodes > *limits.Nodes {
+		return QuotaExceededError{Reason: fmt.Sprintf("Node quota exceeded, using %v of %v nodes and requesting %v more", usage.Nodes, *limits.Nodes, nodes)}
+	}
+
+	if current == nil && len(limits.NodeSizes) > 0 {
+		nodeSizes := []string{common.ReturnValueOrDefault(UpdateInstanceSpecIfEnvOverrides(desired).NodeSize, GetInstanceDefaultNodeSize())}
+		for _, pool := range desired.WorkerPools {
+			if pool.NodeSize != "" {
+				nodeSizes = append(nodeSizes, pool.NodeSize)
+			}
+		}
+		for _, nodeSize := range nodeSizes {
+			allowed := false
+			for _, size := range limits.NodeSizes {
+				if size == nodeSize {
+					allowed = true
+				}
+			}
+			if allowed != true {
+				return QuotaExceededError{Reason: fmt.Sprintf("Node size '%v' is not allowed, allowed sizes are: %v", nodeSize, strings.Join(limits.NodeSizes, ", "))}
+			}
+		}
+	}
+
+	if (current == nil || nodes > 0) && limits.MachineHoursPerMonth != nil && usage.MachineHours >= *limits.MachineHoursPerMonth {
+		return QuotaExceededError{Reason: fmt.Sprintf("Machine hour quota reached, using %v of %v hours this month", usage.MachineHours, *limits.MachineHoursPerMonth)}
+	}
+	return nil
+}
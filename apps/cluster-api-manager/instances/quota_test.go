@@ -0,0 +1,205 @@
+package instances
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestResolveQuotaLimits(t *testing.T) {
+	intPointer := func(i int) *int { return &i }
+	floatPointer := func(f float64) *float64 { return &f }
+
+	quotas := `{
+  "default": {"instances": 1, "nodes": 0, "nodeSizes": ["c3.small.x86"], "machineHoursPerMonth": 100},
+  "users": {"BobyMCbobs": {"instances": 10}},
+  "groups": {
+    "ii": {"instances": 3, "nodes": 2, "nodeSizes": ["c3.small.x86"], "machineHoursPerMonth": 200},
+    "cncf": {"instances": 2, "nodes": 6, "nodeSizes": ["m3.large.x86"], "machineHoursPerMonth": 150},
+    "unlimited": {"instances": 5}
+  }
+}`
+
+	tests := []struct {
+		name         string
+		quotas       string
+		maxInstances string
+		subject      QuotaSubject
+		expected     QuotaLimits
+	}{
+		{
+			name:     "the quota of the user is used over those of their groups",
+			quotas:   quotas,
+			subject:  QuotaSubject{Username: "bobymcbobs", Groups: []string{"ii"}},
+			expected: QuotaLimits{Instances: intPointer(10)},
+		},
+		{
+			name:    "the quota of a group",
+			quotas:  quotas,
+			subject: QuotaSubject{Username: "calebwoodbine", Groups: []string{"ii"}},
+			expected: QuotaLimits{
+				Instances:            intPointer(3),
+				Nodes:                intPointer(2),
+				NodeSizes:            []string{"c3.small.x86"},
+				MachineHoursPerMonth: floatPointer(200),
+			},
+		},
+		{
+			name:    "the most generous limits of each group",
+			quotas:  quotas,
+			subject: QuotaSubject{Username: "calebwoodbine", Groups: []string{"ii", "cncf"}},
+			expected: QuotaLimits{
+				Instances:            intPointer(3),
+				Nodes:                intPointer(6),
+				NodeSizes:            []string{"c3.small.x86", "m3.large.x86"},
+				MachineHoursPerMonth: floatPointer(200),
+			},
+		},
+		{
+			name:    "the node sizes of three groups",
+			quotas:  `{"groups": {"a": {"nodeSizes": ["c3.small.x86"]}, "b": {"nodeSizes": ["m3.large.x86"]}, "c": {"nodeSizes": ["s3.xlarge.x86"]}}}`,
+			subject: QuotaSubject{Username: "calebwoodbine", Groups: []string{"a", "b", "c"}},
+			expected: QuotaLimits{
+				NodeSizes: []string{"c3.small.x86", "m3.large.x86", "s3.xlarge.x86"},
+			},
+		},
+		{
+			name:     "limits which a group doesn't set are unlimited",
+			quotas:   quotas,
+			subject:  QuotaSubject{Username: "calebwoodbine", Groups: []string{"ii", "unlimited"}},
+			expected: QuotaLimits{Instances: intPointer(5)},
+		},
+		{
+			name:    "unknown groups are ignored",
+			quotas:  quotas,
+			subject: QuotaSubject{Username: "calebwoodbine", Groups: []string{"unknown", "cncf"}},
+			expected: QuotaLimits{
+				Instances:            intPointer(2),
+				Nodes:                intPointer(6),
+				NodeSizes:            []string{"m3.large.x86"},
+				MachineHoursPerMonth: floatPointer(150),
+			},
+		},
+		{
+			name:    "the default without a quota of the user or their groups",
+			quotas:  quotas,
+			subject: QuotaSubject{Username: "zachmandeville"},
+			expected: QuotaLimits{
+				Instances:            intPointer(1),
+				Nodes:                intPointer(0),
+				NodeSizes:            []string{"c3.small.x86"},
+				MachineHoursPerMonth: floatPointer(100),
+			},
+		},
+		{
+			name:         "the default instances come from the non-admin max without quotas",
+			maxInstances: "2",
+			subject:      QuotaSubject{Username: "zachmandeville"},
+			expected:     QuotaLimits{Instances: intPointer(2)},
+		},
+		{
+			name:     "unlimited without quotas or a non-admin max",
+			subject:  QuotaSubject{Username: "zachmandeville"},
+			expected: QuotaLimits{},
+		},
+		{
+			name:         "invalid quotas are ignored",
+			quotas:       `{"default":`,
+			maxInstances: "1",
+			subject:      QuotaSubject{Username: "zachmandeville", Groups: []string{"ii"}},
+			expected:     QuotaLimits{Instances: intPointer(1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_QUOTAS", tt.quotas)
+			t.Setenv("APP_NON_ADMIN_INSTANCE_MAX_AMOUNT", tt.maxInstances)
+			limits := ResolveQuotaLimits(tt.subject)
+			if reflect.DeepEqual(limits, tt.expected) != true {
+				limitsJSON, _ := json.Marshal(limits)
+				expectedJSON, _ := json.Marshal(tt.expected)
+				t.Errorf("expected %s, got %s", expectedJSON, limitsJSON)
+			}
+		})
+	}
+}
+
+func TestOwnerQuotaSubject(t *testing.T) {
+	newInstance := func(name string) InstanceSpec {
+		return InstanceSpec{Name: name, Setup: types.SetupSpec{User: "BobyMCbobs"}}
+	}
+	objects := []runtime.Object{}
+	for _, pairInstance := range []PairInstance{
+		pairInstanceWithOwner(NewPairInstance(newInstance("bobymcbobs"), "sharingio-pair-instances"), []string{"ii"}, false),
+		pairInstanceWithOwner(NewPairInstance(newInstance("bobymcbobs-admin"), "sharingio-pair-instances"), []string{"ii"}, true),
+		pairInstanceWithOwner(NewPairInstance(newInstance("bobymcbobs-nogroups"), "sharingio-pair-instances"), nil, false),
+	} {
+		object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pairInstance)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		objects = append(objects, &unstructured.Unstructured{Object: object})
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+
+	tests := []struct {
+		name     string
+		instance string
+		options  InstanceUpdateOptions
+		expected QuotaSubject
+	}{
+		{
+			name:     "the owner uses their own groups",
+			instance: "bobymcbobs",
+			options:  InstanceUpdateOptions{Username: "bobymcbobs", Groups: []string{"cncf"}},
+			expected: QuotaSubject{Username: "BobyMCbobs", Groups: []string{"cncf"}},
+		},
+		{
+			name:     "an owner which is an admin",
+			instance: "bobymcbobs",
+			options:  InstanceUpdateOptions{Username: "BobyMCbobs", Admin: true},
+			expected: QuotaSubject{Username: "BobyMCbobs", Admin: true},
+		},
+		{
+			name:     "an admin updating the instance of a non-admin",
+			instance: "bobymcbobs",
+			options:  InstanceUpdateOptions{Username: "hh", Admin: true, Groups: []string{"pair:admins"}},
+			expected: QuotaSubject{Username: "BobyMCbobs", Groups: []string{"ii"}},
+		},
+		{
+			name:     "someone updating the instance of an admin",
+			instance: "bobymcbobs-admin",
+			options:  InstanceUpdateOptions{Username: "hh"},
+			expected: QuotaSubject{Username: "BobyMCbobs", Groups: []string{"ii"}, Admin: true},
+		},
+		{
+			name:     "an owner without groups",
+			instance: "bobymcbobs-nogroups",
+			options:  InstanceUpdateOptions{Username: "hh", Admin: true},
+			expected: QuotaSubject{Username: "BobyMCbobs"},
+		},
+		{
+			name:     "an instance without a PairInstance",
+			instance: "bobymcbobs-annotated",
+			options:  InstanceUpdateOptions{Username: "hh", Admin: true},
+			expected: QuotaSubject{Username: "BobyMCbobs"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := ownerQuotaSubject(newInstance(tt.instance), tt.options, dynamicClient)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reflect.DeepEqual(subject, tt.expected) != true {
+				t.Errorf("expected %#v, got %#v", tt.expected, subject)
+			}
+		})
+	}
+}
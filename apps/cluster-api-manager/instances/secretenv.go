@@ -0,0 +1,218 @@
+package instances
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// InstanceRevealedEnv ...
+// the env of an instance, with it's secret values
+// swagger:response env
+type InstanceRevealedEnv struct {
+	Env []map[string]string `json:"env"`
+}
+
+// misc secret env vars
+var (
+	// instanceDefaultSecretEnvKeyPattern is the keys of env which are secret, unless set in APP_SECRET_ENV_KEY_PATTERN
+	instanceDefaultSecretEnvKeyPattern = `(?i)(TOKEN|SECRET|PASSWORD|PASSWD|CREDENTIAL|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY)`
+)
+
+// GetSecretEnvKeyPattern ...
+// get the pattern of the keys of env which are secret, which are stored in the setup Secret of an instance and shown as ***
+func GetSecretEnvKeyPattern() *regexp.Regexp {
+	pattern, err := regexp.Compile(common.GetEnvOrDefault("APP_SECRET_ENV_KEY_PATTERN", instanceDefaultSecretEnvKeyPattern))
+	if err != nil {
+		log.Printf("Invalid APP_SECRET_ENV_KEY_PATTERN, using the default, %v\n", err)
+		return regexp.MustCompile(instanceDefaultSecretEnvKeyPattern)
+	}
+	return pattern
+}
+
+// IsSecretEnvKey ...
+// returns if the value of an env key is secret
+func IsSecretEnvKey(key string) bool {
+	return GetSecretEnvKeyPattern().MatchString(key)
+}
+
+// MaskSecretEnv ...
+// returns env with the values of it's secret keys shown as ***
+func MaskSecretEnv(env []map[string]string) []map[string]string {
+	if env == nil {
+		return nil
+	}
+	pattern := GetSecretEnvKeyPattern()
+	masked := []map[string]string{}
+	for _, item := range env {
+		maskedItem := map[string]string{}
+		for key, value := range item {
+			if value != "" && pattern.MatchString(key) {
+				value = redactedValue
+			}
+			maskedItem[key] = value
+		}
+		masked = append(masked, maskedItem)
+	}
+	return masked
+}
+
+// restoreSecretEnv ...
+// returns env with it's masked secret values replaced by those of the same keys in stored, staying masked when stored has none
+func restoreSecretEnv(env []map[string]string, stored []map[string]string) []map[string]string {
+	if env == nil {
+		return nil
+	}
+	restored := []map[string]string{}
+	for _, item := range env {
+		restoredItem := map[string]string{}
+		for key, value := range item {
+			if storedValue := GetValueFromEnvSlice(stored, key); value == redactedValue && storedValue != "" && IsSecretEnvKey(key) {
+				value = storedValue
+			}
+			restoredItem[key] = value
+		}
+		restored = append(restored, restoredItem)
+	}
+	return restored
+}
+
+// hasUnmaskedSecretEnv ...
+// returns if env has secret values which aren't masked
+func hasUnmaskedSecretEnv(env []map[string]string) bool {
+	for _, item := range env {
+		for key, value := range item {
+			if value != "" && value != redactedValue && IsSecretEnvKey(key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withoutSecretEnv ...
+// returns env without it's secret keys
+func withoutSecretEnv(env []map[string]string) []map[string]string {
+	if env == nil {
+		return nil
+	}
+	pattern := GetSecretEnvKeyPattern()
+	kept := []map[string]string{}
+	for _, item := range env {
+		keptItem := map[string]string{}
+		for key, value := range item {
+			if pattern.MatchString(key) != true {
+				keptItem[key] = value
+			}
+		}
+		if len(keptItem) > 0 {
+			kept = append(kept, keptItem)
+		}
+	}
+	return kept
+}
+
+// getSecretEnv ...
+// returns the env of an instance with it's secret values, from it's setup Secret
+func getSecretEnv(instance InstanceSpec, dynamicClient dynamic.Interface) (env []map[string]string, err error) {
+	secret, err := getSetupSecret(dynamicClient, instance.Name)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := getSetupSecretEnv(secret)
+	if err != nil {
+		return nil, err
+	}
+	return restoreSecretEnv(instance.Setup.Env, stored), nil
+}
+
+// RevealEnv ...
+// returns the env of an instance with it's secret values, for it's owner
+func RevealEnv(name string, dynamicClient dynamic.Interface) (env InstanceRevealedEnv, err error) {
+	instance, err := GetSpec(name, dynamicClient)
+	if err != nil {
+		return InstanceRevealedEnv{}, err
+	}
+	if instance.Name == "" {
+		return InstanceRevealedEnv{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+	env.Env, err = getSecretEnv(instance, dynamicClient)
+	if err != nil {
+		return InstanceRevealedEnv{}, err
+	}
+	if env.Env == nil {
+		env.Env = []map[string]string{}
+	}
+	return env, nil
+}
+
+// BackfillSecretEnv ...
+// move the secret env values of each existing instance into it's setup Secret, masking them in it's Cluster and PairInstance
+func BackfillSecretEnv(dynamicClient dynamic.Interface) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	clusters, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: "io.sharing.pair=instance"})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to list Clusters, %#v", err)
+	}
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		name := cluster.GetName()
+		var env []map[string]string
+		json.Unmarshal([]byte(cluster.GetAnnotations()["io.sharing.pair-spec-setup-env"]), &env)
+		pairInstance, err := dynamicClient.Resource(PairInstanceGroupVersionResource).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil && apierrors.IsNotFound(err) != true {
+			log.Printf("%#v\n", err)
+			return fmt.Errorf("Failed to get PairInstance, %#v", err)
+		}
+		hasPairInstance := err == nil
+		// NOTE the PairInstance is the spec of the instance, with any values it has masked kept from the annotations
+		if hasPairInstance == true {
+			if pairInstanceEnv, found, _ := unstructured.NestedSlice(pairInstance.Object, "spec", "setup", "env"); found == true {
+				var storedEnv []map[string]string
+				data, _ := json.Marshal(pairInstanceEnv)
+				json.Unmarshal(data, &storedEnv)
+				env = restoreSecretEnv(storedEnv, env)
+			}
+		}
+		if hasUnmaskedSecretEnv(env) != true {
+			continue
+		}
+		err = upsertSetupSecret(dynamicClient, InstanceSpec{Name: name, Setup: types.SetupSpec{Env: env}})
+		if err != nil {
+			return err
+		}
+		maskedEnvJSON, err := json.Marshal(MaskSecretEnv(env))
+		if err != nil {
+			return fmt.Errorf("Failed to marshal env of instance '%v', %v", name, err)
+		}
+		err = setResourceAnnotation(dynamicClient, groupVersionResource, name, "io.sharing.pair-spec-setup-env", string(maskedEnvJSON))
+		if err != nil {
+			return err
+		}
+		if hasPairInstance == true {
+			spec, err := GetSpec(name, dynamicClient)
+			if err != nil {
+				return err
+			}
+			err = UpdatePairInstanceSpec(spec, dynamicClient)
+			if err != nil {
+				return err
+			}
+		}
+		log.Printf("Moved the secret env of instance '%v' into it's setup Secret\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package instances
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaskSecretEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		env      []map[string]string
+		expected []map[string]string
+	}{
+		{
+			name:     "no env",
+			env:      nil,
+			expected: nil,
+		},
+		{
+			name: "secret keys are masked with the default pattern",
+			env: []map[string]string{
+				{"GITHUB_TOKEN": "ghp_abc"},
+				{"AWS_SECRET_ACCESS_KEY": "abc", "DB_PASSWORD": "hunter2"},
+				{"STRIPE_API_KEY": "sk_abc", "github_token": "ghp_def"},
+				{"EDITOR": "emacs"},
+			},
+			expected: []map[string]string{
+				{"GITHUB_TOKEN": "***"},
+				{"AWS_SECRET_ACCESS_KEY": "***", "DB_PASSWORD": "***"},
+				{"STRIPE_API_KEY": "***", "github_token": "***"},
+				{"EDITOR": "emacs"},
+			},
+		},
+		{
+			name:     "empty secret values stay empty",
+			env:      []map[string]string{{"GITHUB_TOKEN": ""}},
+			expected: []map[string]string{{"GITHUB_TOKEN": ""}},
+		},
+		{
+			name:     "a custom pattern",
+			pattern:  `^PRIVATE_`,
+			env:      []map[string]string{{"PRIVATE_NOTE": "abc", "GITHUB_TOKEN": "ghp_abc"}},
+			expected: []map[string]string{{"PRIVATE_NOTE": "***", "GITHUB_TOKEN": "ghp_abc"}},
+		},
+		{
+			name:     "an invalid pattern falls back to the default",
+			pattern:  `(`,
+			env:      []map[string]string{{"GITHUB_TOKEN": "ghp_abc"}},
+			expected: []map[string]string{{"GITHUB_TOKEN": "***"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_SECRET_ENV_KEY_PATTERN", tt.pattern)
+			masked := MaskSecretEnv(tt.env)
+			if reflect.DeepEqual(masked, tt.expected) != true {
+				t.Errorf("expected %v, got %v", tt.expected, masked)
+			}
+		})
+	}
+}
+
+func TestRestoreSecretEnv(t *testing.T) {
+	stored := []map[string]string{
+		{"GITHUB_TOKEN": "ghp_abc"},
+		{"EDITOR": "emacs"},
+	}
+
+	tests := []struct {
+		name     string
+		env      []map[string]string
+		expected []map[string]string
+	}{
+		{
+			name:     "masked secret values are restored",
+			env:      []map[string]string{{"GITHUB_TOKEN": "***"}},
+			expected: []map[string]string{{"GITHUB_TOKEN": "ghp_abc"}},
+		},
+		{
+			name:     "new secret values replace stored ones",
+			env:      []map[string]string{{"GITHUB_TOKEN": "ghp_def"}},
+			expected: []map[string]string{{"GITHUB_TOKEN": "ghp_def"}},
+		},
+		{
+			name:     "masked values without a stored value stay masked",
+			env:      []map[string]string{{"DB_PASSWORD": "***"}},
+			expected: []map[string]string{{"DB_PASSWORD": "***"}},
+		},
+		{
+			name:     "values which aren't secret are never restored",
+			env:      []map[string]string{{"EDITOR": "***"}},
+			expected: []map[string]string{{"EDITOR": "***"}},
+		},
+		{
+			name:     "no env",
+			env:      nil,
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored := restoreSecretEnv(tt.env, stored)
+			if reflect.DeepEqual(restored, tt.expected) != true {
+				t.Errorf("expected %v, got %v", tt.expected, restored)
+			}
+		})
+	}
+}
@@ -0,0 +1,537 @@
+package instances
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// misc setup Secret vars
+var (
+	// instanceSetupDeliveredAtAnnotation is when the setup Secret of an instance was copied into it's cluster, on it's Cluster
+	instanceSetupDeliveredAtAnnotation = "io.sharing.pair-setupDeliveredAt"
+	// instanceSetupSecretName is the Secret in the cluster of an instance, which it's control plane reads once while bootstrapping then deletes
+	instanceSetupSecretName = "sharingio-pair-setup"
+	// instanceSetupSecretNamespace is the namespace of the Secret in the cluster of an instance
+	instanceSetupSecretNamespace = "kube-system"
+	// redactedValue replaces secret values in logs and responses
+	redactedValue = "***"
+	// instanceSetupUpdatedAtAnnotation is when the guests, repos, env or timezone of an instance were last updated, on it's Cluster
+	instanceSetupUpdatedAtAnnotation = "io.sharing.pair-setupUpdatedAt"
+	// instanceSetupSyncedAtAnnotation is the update which the Environment of an instance was last synced with, on it's Cluster
+	instanceSetupSyncedAtAnnotation = "io.sharing.pair-setupSyncedAt"
+	// instanceEnvironmentSecretName is the Secret in the cluster of an instance, which the env of it's Environment is read from once it's been updated
+	instanceEnvironmentSecretName = "sharingio-pair-environment"
+	// instanceEnvironmentStatefulSetName is the StatefulSet of the Environment in the cluster of an instance
+	instanceEnvironmentStatefulSetName = "environment"
+)
+
+// setupSecretName ...
+// returns the name of the Secret which stores the secret setup values of an instance
+func setupSecretName(name string) string {
+	return name + "-setup"
+}
+
+// setupSecretLabelSelector ...
+// returns the labels of the Secret which stores the secret setup values of an instance
+func setupSecretLabelSelector(name string) string {
+	return "io.sharing.pair=setup,io.sharing.pair-spec-name=" + name
+}
+
+// shellQuote ...
+// returns a value single quoted for a shell, so that it's never expanded or run
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// yamlQuote ...
+// returns a value as a double quoted YAML string, escaping it's quotes and control characters
+func yamlQuote(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
+// setupEnvExpanded ...
+// returns the env of an instance as the YAML list of the env of the Environment container
+func setupEnvExpanded(env []map[string]string) string {
+	expanded := ""
+	for _, item := range env {
+		keys := make([]string, 0, len(item))
+		for key := range item {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			expanded += fmt.Sprintf("\n            - name: %v\n              value: %v", yamlQuote(key), yamlQuote(item[key]))
+		}
+	}
+	return expanded + "\n"
+}
+
+// setupSecretEnvTemplate is the env file sourced while bootstrapping an instance, where every value is quoted
+var setupSecretEnvTemplate = template.Must(template.New("pair-instance-setup-env").Funcs(template.FuncMap{
+	"shellQuote":       shellQuote,
+	"setupEnvExpanded": setupEnvExpanded,
+}).Parse(`export SHARINGIO_PAIR_INSTANCE_SETUP_GITHUBOAUTHTOKEN={{ shellQuote $.GitHubOAuthToken }}
+export SHARINGIO_PAIR_INSTANCE_SETUP_ENV_EXPANDED={{ shellQuote (setupEnvExpanded $.Env) }}
+`))
+
+// templateSetupEnv ...
+// returns the env file of the GitHub OAuth token and env of an instance, for it to source while bootstrapping
+func templateSetupEnv(setup types.SetupSpec) (env []byte, err error) {
+	templatedBuffer := new(bytes.Buffer)
+	err = setupSecretEnvTemplate.Execute(templatedBuffer, setup)
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return nil, fmt.Errorf("Error templating setup env: %#v", err)
+	}
+	return templatedBuffer.Bytes(), nil
+}
+
+// templatePlainSetupEnv ...
+// returns the Docker env file of the GitHub OAuth token and env of a Plain instance, for it's Environment container.
+// Docker reads each line as is, so values can't be quoted and mustn't contain newlines
+func templatePlainSetupEnv(setup types.SetupSpec) (env []byte, err error) {
+	if strings.ContainsAny(setup.GitHubOAuthToken, "\r\n") == true {
+		return nil, fmt.Errorf("Error templating setup env: the GitHub OAuth token of a Plain instance can't contain newlines")
+	}
+	lines := []string{"GITHUB_TOKEN=" + setup.GitHubOAuthToken}
+	for _, item := range setup.Env {
+		keys := make([]string, 0, len(item))
+		for key := range item {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if strings.ContainsAny(key+item[key], "\r\n") == true {
+				return nil, fmt.Errorf("Error templating setup env: env '%v' of a Plain instance can't contain newlines", key)
+			}
+			lines = append(lines, key+"="+item[key])
+		}
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// RedactSetupSpec ...
+// returns the spec of an instance with it's GitHub OAuth token and env values replaced, for logging
+func RedactSetupSpec(instance InstanceSpec) InstanceSpec {
+	if instance.Setup.GitHubOAuthToken != "" {
+		instance.Setup.GitHubOAuthToken = redactedValue
+	}
+	env := []map[string]string{}
+	for _, item := range instance.Setup.Env {
+		redacted := map[string]string{}
+		for key := range item {
+			redacted[key] = redactedValue
+		}
+		env = append(env, redacted)
+	}
+	instance.Setup.Env = env
+	return instance
+}
+
+// RedactSetupValues ...
+// returns text with the GitHub OAuth token and env values of an instance replaced, for logging
+func RedactSetupValues(text string, instance InstanceSpec) string {
+	values := []string{instance.Setup.GitHubOAuthToken}
+	for _, item := range instance.Setup.Env {
+		for _, value := range item {
+			values = append(values, value)
+		}
+	}
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		text = strings.ReplaceAll(text, value, redactedValue)
+	}
+	return text
+}
+
+// getSetupSecret ...
+// returns the setup Secret of an instance, or nil if it has none
+func getSetupSecret(dynamicClient dynamic.Interface, name string) (secret *corev1.Secret, err error) {
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("secrets")
+	item, err := dynamicClient.Resource(groupVersionResource).Namespace(common.GetTargetNamespace()).Get(context.TODO(), setupSecretName(name), metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return nil, fmt.Errorf("Failed to get setup Secret, %#v", err)
+	}
+	data, err := item.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal setup Secret, %v", err)
+	}
+	secret = &corev1.Secret{}
+	err = json.Unmarshal(data, secret)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to restructure %T", secret)
+	}
+	return secret, nil
+}
+
+// getSetupSecretEnv ...
+// returns the env stored in the setup Secret of an instance, with it's secret values
+func getSetupSecretEnv(secret *corev1.Secret) (env []map[string]string, err error) {
+	if secret == nil || len(secret.Data["env"]) == 0 {
+		return nil, nil
+	}
+	err = json.Unmarshal(secret.Data["env"], &env)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse env of setup Secret, %v", err)
+	}
+	return env, nil
+}
+
+// templateSetupSecret ...
+// returns the Secret which stores the GitHub OAuth token and env of an instance.
+// The token of existingSecret is kept when the instance has none, such as when it's resumed from it's PairInstance,
+// as are it's values of secret env which are masked in the instance
+func templateSetupSecret(instance InstanceSpec, existingSecret *corev1.Secret) (secret corev1.Secret, err error) {
+	env := instance.Setup.Env
+	token := instance.Setup.GitHubOAuthToken
+	if existingSecret != nil {
+		existingEnv, err := getSetupSecretEnv(existingSecret)
+		if err != nil {
+			return corev1.Secret{}, err
+		}
+		env = restoreSecretEnv(env, existingEnv)
+		if token == "" {
+			token = string(existingSecret.Data["githubOAuthToken"])
+		}
+	}
+	envJSON, err := json.Marshal(env)
+	if err != nil {
+		return corev1.Secret{}, fmt.Errorf("Failed to marshal env of instance '%v', %v", instance.Name, err)
+	}
+	secret = corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      setupSecretName(instance.Name),
+			Namespace: common.GetTargetNamespace(),
+			Labels: map[string]string{
+				"io.sharing.pair":           "setup",
+				"io.sharing.pair-spec-name": instance.Name,
+			},
+		},
+		Data: map[string][]byte{
+			"githubOAuthToken": []byte(token),
+			"env":              envJSON,
+		},
+	}
+	return secret, nil
+}
+
+// upsertSetupSecret ...
+// store the GitHub OAuth token and env of an existing instance in it's setup Secret, owned by it's Cluster
+func upsertSetupSecret(dynamicClient dynamic.Interface, instance InstanceSpec) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+	existingSecret, err := getSetupSecret(dynamicClient, instance.Name)
+	if err != nil {
+		return err
+	}
+	secret, err := templateSetupSecret(instance, existingSecret)
+	if err != nil {
+		return err
+	}
+	if existingSecret == nil {
+		ownerReference, err := common.GetInstanceClusterOwnerReference(dynamicClient, instance.Name)
+		if err != nil {
+			log.Printf("Not setting owner of setup Secret of instance '%v', %v\n", instance.Name, err)
+		} else {
+			common.AddOwnerReference(&secret, ownerReference)
+		}
+	} else {
+		secret.SetResourceVersion(existingSecret.GetResourceVersion())
+		secret.SetOwnerReferences(existingSecret.GetOwnerReferences())
+	}
+	item, err := common.ObjectToUnstructured(secret)
+	if err != nil {
+		return fmt.Errorf("Failed to unstructure setup Secret, %#v", err)
+	}
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("secrets")
+	if existingSecret == nil {
+		_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Create(context.TODO(), item, metav1.CreateOptions{})
+		if err != nil {
+			log.Printf("%#v\n", err)
+			return fmt.Errorf("Failed to create setup Secret, %#v", err)
+		}
+		return nil
+	}
+	_, err = dynamicClient.Resource(groupVersionResource).Namespace(targetNamespace).Update(context.TODO(), item, metav1.UpdateOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to update setup Secret, %#v", err)
+	}
+	return nil
+}
+
+// deleteSetupSecret ...
+// delete the setup Secret of an instance
+func deleteSetupSecret(dynamicClient dynamic.Interface, name string) (err error) {
+	groupVersionResource := corev1.SchemeGroupVersion.WithResource("secrets")
+	err = dynamicClient.Resource(groupVersionResource).Namespace(common.GetTargetNamespace()).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: setupSecretLabelSelector(name)})
+	if err != nil && apierrors.IsNotFound(err) != true {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to delete setup Secret, %#v", err)
+	}
+	return nil
+}
+
+// KubernetesDeliverSetupSecret ...
+// copy the setup Secret of a Kubernetes instance into it's cluster once it's API server is live, for it's control plane to read while bootstrapping.
+// Returns false when it has already been delivered, or the instance has no setup Secret
+func KubernetesDeliverSetupSecret(name string, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) (delivered bool, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	cluster, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return false, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+	if cluster.GetAnnotations()[instanceSetupDeliveredAtAnnotation] != "" || cluster.GetAnnotations()[instanceHibernatedAtAnnotation] != "" {
+		return false, nil
+	}
+	// NOTE instances created before setup Secrets had their setup values in their bootstrap commands
+	secret, err := getSetupSecret(dynamicClient, name)
+	if err != nil || secret == nil {
+		return false, err
+	}
+	setup := types.SetupSpec{GitHubOAuthToken: string(secret.Data["githubOAuthToken"])}
+	setup.Env, err = getSetupSecretEnv(secret)
+	if err != nil {
+		return false, err
+	}
+	setupEnv, err := templateSetupEnv(setup)
+	if err != nil {
+		return false, err
+	}
+
+	err = KubernetesGetInstanceAPIServerLiveness(clientset, name)
+	if err != nil {
+		return false, err
+	}
+	instanceClientset, _, err := kubernetesInstanceClients(clientset, name)
+	if err != nil {
+		return false, err
+	}
+	instanceSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instanceSetupSecretName,
+			Namespace: instanceSetupSecretNamespace,
+			Labels: map[string]string{
+				"io.sharing.pair": "setup",
+			},
+		},
+		Data: map[string][]byte{
+			"setup.env": setupEnv,
+		},
+	}
+	_, err = instanceClientset.CoreV1().Secrets(instanceSetupSecretNamespace).Create(context.TODO(), instanceSecret, metav1.CreateOptions{})
+	if err != nil && apierrors.IsAlreadyExists(err) != true {
+		log.Printf("%#v\n", err)
+		return false, fmt.Errorf("Failed to create setup Secret on Instance '%v', %#v", name, err)
+	}
+	err = setResourceAnnotation(dynamicClient, groupVersionResource, name, instanceSetupDeliveredAtAnnotation, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Delivered setup Secret to instance '%v'\n", name)
+	return true, nil
+}
+
+// PlainDeliverSetupSecret ...
+// send the setup Secret of a Plain instance to the session server on it's machine, for it's bootstrap script to read once before starting the Environment.
+// Returns false when it has already been delivered, or the instance has no setup Secret
+func PlainDeliverSetupSecret(name string, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) (delivered bool, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	cluster, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return false, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+	if cluster.GetAnnotations()[instanceSetupDeliveredAtAnnotation] != "" {
+		return false, nil
+	}
+	// NOTE instances created before setup Secrets had their setup values in their bootstrap script
+	secret, err := getSetupSecret(dynamicClient, name)
+	if err != nil || secret == nil {
+		return false, err
+	}
+	setup := types.SetupSpec{GitHubOAuthToken: string(secret.Data["githubOAuthToken"])}
+	setup.Env, err = getSetupSecretEnv(secret)
+	if err != nil {
+		return false, err
+	}
+	setupEnv, err := templatePlainSetupEnv(setup)
+	if err != nil {
+		return false, err
+	}
+
+	statusCode, output, err := plainSessionServerRequest(dynamicClient, clientset, name, http.MethodPost, "/setup", setupEnv)
+	if err != nil {
+		return false, fmt.Errorf("Failed to deliver setup to the machine of instance '%v', %v", name, err)
+	}
+	if statusCode != http.StatusCreated && statusCode != http.StatusConflict {
+		return false, fmt.Errorf("Failed to deliver setup to the machine of instance '%v' (%v): %v", name, statusCode, output)
+	}
+	err = setResourceAnnotation(dynamicClient, groupVersionResource, name, instanceSetupDeliveredAtAnnotation, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Delivered setup Secret to instance '%v'\n", name)
+	return true, nil
+}
+
+// environmentSetupValues ...
+// returns the env of the Environment of an instance which may change after it's provisioned, with the secret values of env
+func environmentSetupValues(instance InstanceSpec, env []map[string]string) (values map[string][]byte) {
+	values = map[string][]byte{
+		"TZ":                             []byte(instance.Setup.Timezone),
+		"INIT_DEFAULT_REPOS":             []byte(strings.Join(instance.Setup.Repos, " ")),
+		"SHARINGIO_PAIR_GUEST_NAMES":     []byte(strings.Join(instance.Setup.Guests, " ")),
+		"SHARINGIO_PAIR_AUTHORIZED_KEYS": []byte(strings.Join(GetInstanceSSHKeys(instance), "\n")),
+	}
+	for _, item := range env {
+		for key, value := range item {
+			values[key] = []byte(value)
+		}
+	}
+	return values
+}
+
+// KubernetesSyncEnvironmentSetup ...
+// push the guests, repos, env and timezone of an updated Kubernetes instance to it's running Environment, which is restarted to read them.
+// Returns false when the Environment already has them, or isn't running yet
+func KubernetesSyncEnvironmentSetup(name string, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) (synced bool, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	cluster, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return false, fmt.Errorf("Failed to get Cluster, %#v", err)
+	}
+	annotations := cluster.GetAnnotations()
+	updatedAt := annotations[instanceSetupUpdatedAtAnnotation]
+	// NOTE an Environment which hasn't bootstrapped yet reads the updated setup from the setup Secret
+	if updatedAt == "" || updatedAt == annotations[instanceSetupSyncedAtAnnotation] || annotations[instanceSetupDeliveredAtAnnotation] == "" || annotations[instanceHibernatedAtAnnotation] != "" {
+		return false, nil
+	}
+	instance, err := GetSpec(name, dynamicClient)
+	if err != nil {
+		return false, err
+	}
+	secret, err := getSetupSecret(dynamicClient, name)
+	if err != nil {
+		return false, err
+	}
+	env, err := getSetupSecretEnv(secret)
+	if err != nil {
+		return false, err
+	}
+
+	err = KubernetesGetInstanceAPIServerLiveness(clientset, name)
+	if err != nil {
+		return false, err
+	}
+	instanceClientset, _, err := kubernetesInstanceClients(clientset, name)
+	if err != nil {
+		return false, err
+	}
+	namespace := instance.Setup.UserLowercase
+	statefulSet, err := instanceClientset.AppsV1().StatefulSets(namespace).Get(context.TODO(), instanceEnvironmentStatefulSetName, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		log.Printf("%#v\n", err)
+		return false, fmt.Errorf("Failed to get Environment StatefulSet of instance '%v', %#v", name, err)
+	}
+
+	values := environmentSetupValues(instance, env)
+	instanceSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instanceEnvironmentSecretName,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"io.sharing.pair": "setup",
+			},
+		},
+		Data: values,
+	}
+	_, err = instanceClientset.CoreV1().Secrets(namespace).Update(context.TODO(), instanceSecret, metav1.UpdateOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		_, err = instanceClientset.CoreV1().Secrets(namespace).Create(context.TODO(), instanceSecret, metav1.CreateOptions{})
+	}
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return false, fmt.Errorf("Failed to write Environment Secret of instance '%v', %#v", name, err)
+	}
+
+	// NOTE env which is removed is optional, so the Environment no longer has it
+	optional := true
+	for i := range statefulSet.Spec.Template.Spec.Containers {
+		container := &statefulSet.Spec.Template.Spec.Containers[i]
+		if container.Name != "environment" {
+			continue
+		}
+		for key := range values {
+			envVar := corev1.EnvVar{
+				Name: key,
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: instanceEnvironmentSecretName},
+						Key:                  key,
+						Optional:             &optional,
+					},
+				},
+			}
+			replaced := false
+			for j := range container.Env {
+				if container.Env[j].Name == key {
+					container.Env[j] = envVar
+					replaced = true
+				}
+			}
+			if replaced == false {
+				container.Env = append(container.Env, envVar)
+			}
+		}
+	}
+	if statefulSet.Spec.Template.ObjectMeta.Annotations == nil {
+		statefulSet.Spec.Template.ObjectMeta.Annotations = map[string]string{}
+	}
+	statefulSet.Spec.Template.ObjectMeta.Annotations[instanceSetupUpdatedAtAnnotation] = updatedAt
+	_, err = instanceClientset.AppsV1().StatefulSets(namespace).Update(context.TODO(), statefulSet, metav1.UpdateOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return false, fmt.Errorf("Failed to update Environment StatefulSet of instance '%v', %#v", name, err)
+	}
+	err = setResourceAnnotation(dynamicClient, groupVersionResource, name, instanceSetupSyncedAtAnnotation, updatedAt)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Synced the setup of instance '%v' to it's Environment\n", name)
+	return true, nil
+}
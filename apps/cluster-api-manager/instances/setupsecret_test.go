@@ -0,0 +1,229 @@
+package instances
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/types"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestRedactSetupSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    types.SetupSpec
+		expected types.SetupSpec
+	}{
+		{
+			name: "the token and every env value are redacted",
+			setup: types.SetupSpec{
+				User:             "BobyMCbobs",
+				GitHubOAuthToken: "gho_abc",
+				Env: []map[string]string{
+					{"GITHUB_TOKEN": "ghp_abc"},
+					{"EDITOR": "emacs", "PAGER": "less"},
+				},
+			},
+			expected: types.SetupSpec{
+				User:             "BobyMCbobs",
+				GitHubOAuthToken: "***",
+				Env: []map[string]string{
+					{"GITHUB_TOKEN": "***"},
+					{"EDITOR": "***", "PAGER": "***"},
+				},
+			},
+		},
+		{
+			name:     "no token or env",
+			setup:    types.SetupSpec{User: "BobyMCbobs"},
+			expected: types.SetupSpec{User: "BobyMCbobs", Env: []map[string]string{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := InstanceSpec{Name: "bobymcbobs-exjk", Setup: tt.setup}
+			redacted := RedactSetupSpec(instance)
+			if reflect.DeepEqual(redacted.Setup, tt.expected) != true {
+				t.Errorf("expected %#v, got %#v", tt.expected, redacted.Setup)
+			}
+			if instance.Setup.GitHubOAuthToken != tt.setup.GitHubOAuthToken || reflect.DeepEqual(instance.Setup.Env, tt.setup.Env) != true {
+				t.Errorf("redacting modified the instance, %#v", instance.Setup)
+			}
+		})
+	}
+}
+
+func TestRedactSetupValues(t *testing.T) {
+	instance := InstanceSpec{
+		Setup: types.SetupSpec{
+			GitHubOAuthToken: "gho_abc",
+			Env: []map[string]string{
+				{"GITHUB_TOKEN": "ghp_abc", "EMPTY": ""},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "the token and env values are replaced",
+			text:     `export SHARINGIO_PAIR_INSTANCE_SETUP_GITHUBOAUTHTOKEN="gho_abc" GITHUB_TOKEN="ghp_abc"`,
+			expected: `export SHARINGIO_PAIR_INSTANCE_SETUP_GITHUBOAUTHTOKEN="***" GITHUB_TOKEN="***"`,
+		},
+		{
+			name:     "every occurrence is replaced",
+			text:     "ghp_abc ghp_abc",
+			expected: "*** ***",
+		},
+		{
+			name:     "empty values don't replace anything",
+			text:     `EMPTY=""`,
+			expected: `EMPTY=""`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redacted := RedactSetupValues(tt.text, instance)
+			if redacted != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, redacted)
+			}
+		})
+	}
+}
+
+func TestTemplateSetupEnv(t *testing.T) {
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is required to source the setup env")
+	}
+
+	tests := []struct {
+		name  string
+		setup types.SetupSpec
+	}{
+		{
+			name: "plain values",
+			setup: types.SetupSpec{
+				GitHubOAuthToken: "gho_abc",
+				Env:              []map[string]string{{"EDITOR": "emacs", "PAGER": "less"}},
+			},
+		},
+		{
+			name: "values which would run as code",
+			setup: types.SetupSpec{
+				GitHubOAuthToken: `gho_abc"; touch pwned; echo "`,
+				Env: []map[string]string{
+					{"A": `$(touch pwned)`, "B": "`touch pwned`"},
+					{"C": `'; touch pwned; echo '`, "D": `"quoted" \ back\slash`},
+					{"E": "multi\nline: value\n- list"},
+				},
+			},
+		},
+		{
+			name:  "no token or env",
+			setup: types.SetupSpec{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := templateSetupEnv(tt.setup)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			dir := t.TempDir()
+			envFile := filepath.Join(dir, "setup.env")
+			err = os.WriteFile(envFile, env, 0600)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cmd := exec.Command(shell, "-c", `. ./setup.env && printf '%s\0%s' "$SHARINGIO_PAIR_INSTANCE_SETUP_GITHUBOAUTHTOKEN" "$SHARINGIO_PAIR_INSTANCE_SETUP_ENV_EXPANDED"`)
+			cmd.Dir = dir
+			output, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("failed to source the setup env, %v:\n%s", err, env)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+				t.Fatalf("sourcing the setup env ran a value as code:\n%s", env)
+			}
+			values := strings.SplitN(string(output), "\x00", 2)
+			if values[0] != tt.setup.GitHubOAuthToken {
+				t.Errorf("expected token %q, got %q", tt.setup.GitHubOAuthToken, values[0])
+			}
+
+			expanded := []map[string]string{}
+			err = yaml.Unmarshal([]byte(values[1]), &expanded)
+			if err != nil {
+				t.Fatalf("failed to parse the expanded env, %v:\n%s", err, values[1])
+			}
+			expected := []map[string]string{}
+			for _, item := range tt.setup.Env {
+				for key, value := range item {
+					expected = append(expected, map[string]string{"name": key, "value": value})
+				}
+			}
+			found := map[string]string{}
+			for _, item := range expanded {
+				found[item["name"]] = item["value"]
+			}
+			if len(expanded) != len(expected) {
+				t.Errorf("expected %v env, got %v", len(expected), expanded)
+			}
+			for _, item := range expected {
+				if found[item["name"]] != item["value"] {
+					t.Errorf("expected env '%v' to be %q, got %q", item["name"], item["value"], found[item["name"]])
+				}
+			}
+		})
+	}
+}
+
+func TestTemplatePlainSetupEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    types.SetupSpec
+		expected string
+		wantErr  bool
+	}{
+		{
+			name: "the token and env",
+			setup: types.SetupSpec{
+				GitHubOAuthToken: "gho_abc",
+				Env:              []map[string]string{{"PAGER": "less", "EDITOR": "emacs"}, {"QUOTED": `"a b"`}},
+			},
+			expected: "GITHUB_TOKEN=gho_abc\nEDITOR=emacs\nPAGER=less\nQUOTED=\"a b\"\n",
+		},
+		{
+			name:     "no token or env",
+			expected: "GITHUB_TOKEN=\n",
+		},
+		{
+			name:    "env with a newline",
+			setup:   types.SetupSpec{Env: []map[string]string{{"A": "b\nGITHUB_TOKEN=ghp_abc"}}},
+			wantErr: true,
+		},
+		{
+			name:    "a token with a newline",
+			setup:   types.SetupSpec{GitHubOAuthToken: "gho_abc\nA=b"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := templatePlainSetupEnv(tt.setup)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if string(env) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, string(env))
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package instances
 import (
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strings"
 )
@@ -22,3 +23,21 @@ func GetGitHubUserSSHKeys(username string) (sshKeys []string, err error) {
 	sshKeys = strings.Split(sshKeysString, "\n")
 	return sshKeys, err
 }
+
+// GetInstanceSSHKeys ...
+// returns the public SSH keys of the user and guests of an instance
+func GetInstanceSSHKeys(instance InstanceSpec) (sshKeys []string) {
+	for _, account := range append(instance.Setup.Guests, instance.Setup.User) {
+		log.Printf("Fetching SSH key for '%v'\n", account)
+		if account == "" {
+			continue
+		}
+		githubSSHKeys, err := GetGitHubUserSSHKeys(account)
+		if err != nil {
+			log.Printf("Error getting SSH keys: %v\n", err.Error())
+			continue
+		}
+		sshKeys = append(sshKeys, githubSSHKeys...)
+	}
+	return sshKeys
+}
@@ -1,12 +1,17 @@
 package instances
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/sharingio/pair/apps/cluster-api-manager/types"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	// networkingv1 "k8s.io/api/networking/v1"
-	clusterAPIv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
-	clusterAPIControlPlaneKubeadmv1alpha3 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1alpha3"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterAPIControlPlaneKubeadmv1beta1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
 )
 
 // Instance ...
@@ -30,15 +35,35 @@ type InstanceSpec struct {
 	Facility            string             `json:"facility"`
 	NameScheme          InstanceNameScheme `json:"nameScheme"`
 	RegistryMirrors     []string           `json:"registryMirrors"`
+	// WorkerPools are the pools of worker nodes of a Kubernetes instance.
+	// Without any, the instance has a single pool of KubernetesNodeCount nodes with it's NodeSize and NodeOS
+	WorkerPools []InstanceWorkerPool `json:"workerPools,omitempty"`
+	// Preset is the preset which the instance was created from, with the fields of it's request merged over it
+	Preset string `json:"preset,omitempty"`
+	// ExpiresAt is when the instance is deleted, unless extended. Instances without it never expire
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// InstanceWorkerPool ...
+// a pool of worker nodes of a Kubernetes instance
+type InstanceWorkerPool struct {
+	Name string `json:"name"`
+	// NodeSize is the size of the nodes, or the NodeSize of the instance when not set
+	NodeSize string `json:"nodeSize,omitempty"`
+	// NodeOS is the OS of the nodes, or the NodeOS of the instance when not set
+	NodeOS string            `json:"nodeOS,omitempty"`
+	Count  int               `json:"count"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Taints []corev1.Taint    `json:"taints,omitempty"`
 }
 
 // InstanceResourceStatus ...
 // various status fields for an instance
 type InstanceResourceStatus struct {
-	KubeadmControlPlane clusterAPIControlPlaneKubeadmv1alpha3.KubeadmControlPlaneStatus
-	Cluster             clusterAPIv1alpha3.ClusterStatus
+	KubeadmControlPlane clusterAPIControlPlaneKubeadmv1beta1.KubeadmControlPlaneStatus
+	Cluster             clusterAPIv1beta1.ClusterStatus
 	EnvironmentPod      corev1.PodStatus
-	MachineStatus       clusterAPIv1alpha3.MachineStatus
+	MachineStatus       clusterAPIv1beta1.MachineStatus
 	PacketMachineUID    *string
 }
 
@@ -47,6 +72,10 @@ type InstanceResourceStatus struct {
 type InstanceStatus struct {
 	Phase     InstanceStatusPhase    `json:"phase"`
 	Resources InstanceResourceStatus `json:"resources"`
+	// ExpiresIn is the remaining lifetime of the instance, if it expires
+	ExpiresIn string `json:"expiresIn,omitempty"`
+	// Upgrade is the progress of upgrading the Kubernetes version of the instance, while it's being upgraded
+	Upgrade *InstanceUpgradeStatus `json:"upgrade,omitempty"`
 }
 
 // InstanceList ...
@@ -84,6 +113,8 @@ const (
 	InstanceStatusPhaseProvisioning InstanceStatusPhase = "Provisioning"
 	InstanceStatusPhaseProvisioned  InstanceStatusPhase = "Provisioned"
 	InstanceStatusPhaseDeleting     InstanceStatusPhase = "Deleting"
+	InstanceStatusPhaseHibernated   InstanceStatusPhase = "Hibernated"
+	InstanceStatusPhaseUpgrading    InstanceStatusPhase = "Upgrading"
 )
 
 // InstanceType ...
@@ -125,4 +156,72 @@ const (
 type InstanceCreateOptions struct {
 	DryRun     bool
 	NameScheme InstanceNameScheme
+	// Admin is if the instance is created by an admin, who may give it a longer lifetime
+	Admin bool
+	// Lifetime is how long the instance should live for, using the default lifetime when zero
+	Lifetime time.Duration
+	// Groups are the groups of the creator, for resolving their quota
+	Groups []string
+}
+
+// InstanceUpdateOptions ...
+// options for updating instances
+type InstanceUpdateOptions struct {
+	// Admin is if who updates the instance is an admin, which resolves the quota of the owner when they're the owner
+	Admin bool
+	// Username is who updates the instance
+	Username string
+	// Groups are the groups of who updates the instance, which resolve the quota of the owner when they're the owner
+	Groups []string
+}
+
+// InstanceManifests ...
+// the rendered resources and bootstrap scripts of an instance
+// swagger:response instanceManifests
+type InstanceManifests struct {
+	Instance  InstanceSpec             `json:"instance"`
+	Resources []map[string]interface{} `json:"resources"`
+	Scripts   map[string]string        `json:"scripts,omitempty"`
+}
+
+// InstanceUpdateInvalidError ...
+// returned when an update can't be applied to a live instance
+type InstanceUpdateInvalidError struct {
+	Reason string
+}
+
+func (e InstanceUpdateInvalidError) Error() string {
+	return e.Reason
+}
+
+// InstanceCreateError ...
+// returned when creating an instance fails part way, after removing the resources which were created
+type InstanceCreateError struct {
+	Step           string   `json:"step"`
+	Reason         string   `json:"reason"`
+	RolledBack     []string `json:"rolledBack"`
+	RollbackFailed []string `json:"rollbackFailed,omitempty"`
+}
+
+func (e InstanceCreateError) Error() string {
+	return fmt.Sprintf("Failed to create %v, %v", e.Step, e.Reason)
+}
+
+// instanceResource ...
+// a resource of an instance and the API which serves it
+type instanceResource struct {
+	Step                 string
+	GroupVersionResource schema.GroupVersionResource
+	Kind                 string
+	Object               interface{}
+}
+
+// instanceResourceQuery ...
+// how to find resources of an instance, by name or label selector
+type instanceResourceQuery struct {
+	GroupVersionResource schema.GroupVersionResource
+	Name                 string
+	LabelSelector        string
+	// Owned is if the resource is created by sharingio/pair, to be owned by the instance's Cluster
+	Owned bool
 }
@@ -0,0 +1,315 @@
+package instances
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	cabpkv1beta1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1"
+	clusterAPIControlPlaneKubeadmv1beta1 "sigs.k8s.io/cluster-api/controlplane/kubeadm/api/v1beta1"
+)
+
+// misc upgrade vars
+var (
+	// instanceUpgradeFromAnnotation is the version an instance is being upgraded from, on it's Cluster
+	instanceUpgradeFromAnnotation = "io.sharing.pair-upgradeFrom"
+	// kubernetesVersionExportPattern matches where the bootstrap commands of a node declare the version of Kubernetes to install
+	kubernetesVersionExportPattern = regexp.MustCompile(`export KUBERNETES_VERSION=\S*`)
+)
+
+// InstanceUpgradeStatus ...
+// the progress of upgrading the Kubernetes version of an instance
+type InstanceUpgradeStatus struct {
+	From                string `json:"from"`
+	To                  string `json:"to"`
+	ControlPlaneUpdated bool   `json:"controlPlaneUpdated"`
+	WorkersUpdated      bool   `json:"workersUpdated"`
+}
+
+// parseKubernetesVersion ...
+// returns the major, minor and patch of a Kubernetes version, such as 1.23.5
+func parseKubernetesVersion(version string) (parts [3]int, err error) {
+	split := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(split) != 3 {
+		return parts, fmt.Errorf("Invalid Kubernetes version '%v'", version)
+	}
+	for i := range split {
+		parts[i], err = strconv.Atoi(split[i])
+		if err != nil || parts[i] < 0 {
+			return parts, fmt.Errorf("Invalid Kubernetes version '%v'", version)
+		}
+	}
+	return parts, nil
+}
+
+// ValidateKubernetesUpgrade ...
+// returns an error unless upgrading from a version to another moves forward, by at most one minor version
+func ValidateKubernetesUpgrade(from string, to string) (err error) {
+	fromParts, err := parseKubernetesVersion(from)
+	if err != nil {
+		return err
+	}
+	toParts, err := parseKubernetesVersion(to)
+	if err != nil {
+		return err
+	}
+	switch {
+	case toParts[0] != fromParts[0]:
+		return fmt.Errorf("Unable to upgrade across major versions, from '%v' to '%v'", from, to)
+	case toParts[1] > fromParts[1]+1:
+		return fmt.Errorf("Unable to skip minor versions, from '%v' to '%v'", from, to)
+	case toParts[1] < fromParts[1] || (toParts[1] == fromParts[1] && toParts[2] <= fromParts[2]):
+		return fmt.Errorf("Unable to upgrade from '%v' to '%v', which isn't newer", from, to)
+	}
+	return nil
+}
+
+// kubernetesVersionTemplateName ...
+// returns the name of a template of an instance, for a version of Kubernetes
+func kubernetesVersionTemplateName(name string, version string) string {
+	return name + "-" + strings.ReplaceAll(strings.TrimPrefix(version, "v"), ".", "-")
+}
+
+// setKubernetesVersionExports ...
+// returns bootstrap commands, declaring the version of Kubernetes to install as version
+func setKubernetesVersionExports(commands []string, version string) []string {
+	updated := make([]string, 0, len(commands))
+	for _, command := range commands {
+		updated = append(updated, kubernetesVersionExportPattern.ReplaceAllString(command, "export KUBERNETES_VERSION="+version))
+	}
+	return updated
+}
+
+// copyTemplate ...
+// create a copy of a template as a new name, keeping it's labels, annotations and owners, and modifying it's copy.
+// An existing copy is kept, so that an upgrade can be retried
+func copyTemplate(dynamicClient dynamic.Interface, groupVersionResource schema.GroupVersionResource, name string, newName string, modify func(item *unstructured.Unstructured) error) (err error) {
+	targetNamespace := common.GetTargetNamespace()
+	item, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to get %v '%v', %#v", groupVersionResource.Resource, name, err)
+	}
+	copied := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": item.GetAPIVersion(),
+		"kind":       item.GetKind(),
+		"spec":       item.Object["spec"],
+	}}
+	copied.SetName(newName)
+	copied.SetNamespace(targetNamespace)
+	copied.SetLabels(item.GetLabels())
+	copied.SetAnnotations(item.GetAnnotations())
+	copied.SetOwnerReferences(item.GetOwnerReferences())
+	if modify != nil {
+		err = modify(copied)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(targetNamespace).Create(context.TODO(), copied, metav1.CreateOptions{})
+	if err != nil && apierrors.IsAlreadyExists(err) != true {
+		log.Printf("%#v\n", err)
+		return fmt.Errorf("Failed to create %v '%v', %#v", groupVersionResource.Resource, newName, err)
+	}
+	return nil
+}
+
+// KubernetesUpgrade ...
+// upgrade the Kubernetes version of an instance in place, rolling out it's control plane and workers onto new machine templates
+func KubernetesUpgrade(name string, version string, admin bool, groups []string, dynamicClient dynamic.Interface) (instanceUpdated InstanceSpec, err error) {
+	targetNamespace := common.GetTargetNamespace()
+	instance, err := GetSpec(name, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	if instance.Name == "" {
+		return InstanceSpec{}, fmt.Errorf("Failed to find instance '%v'", name)
+	}
+	if instance.Type != InstanceTypeKubernetes {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: "Only Kubernetes instances can be upgraded"}
+	}
+	cluster, err := getInstanceCluster(name, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	if cluster == nil {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: "Unable to upgrade an instance which is being resumed"}
+	}
+	if cluster.GetAnnotations()[instanceHibernatedAtAnnotation] != "" {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: "Unable to upgrade a hibernated instance, resume it first"}
+	}
+	if from := cluster.GetAnnotations()[instanceUpgradeFromAnnotation]; from != "" {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: fmt.Sprintf("Instance is already being upgraded from '%v'", from)}
+	}
+
+	//   - newInstance.KubeadmControlPlane
+	kcpGroupVersionResource := clusterAPIControlPlaneKubeadmv1beta1.GroupVersion.WithResource("kubeadmcontrolplanes")
+	kcp, err := dynamicClient.Resource(common.ClusterAPIServedResource(kcpGroupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), name+"-control-plane", metav1.GetOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return InstanceSpec{}, fmt.Errorf("Failed to get KubeadmControlPlane, %#v", err)
+	}
+	from, _, _ := unstructured.NestedString(kcp.Object, "spec", "version")
+	err = ValidateKubernetesUpgrade(from, version)
+	if err != nil {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: err.Error()}
+	}
+	versions := GetCatalog().KubernetesVersions
+	if entry := versions.Find(version); entry == nil && len(versions.Options) > 0 {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: fmt.Sprintf("Kubernetes version '%v' is not in the catalog", version)}
+	} else if entry != nil && entry.IsAvailable(admin, groups) != true {
+		return InstanceSpec{}, InstanceUpdateInvalidError{Reason: fmt.Sprintf("Kubernetes version '%v' is not available to you from the catalog", version)}
+	}
+	upgraded := instance
+	upgraded.Setup.KubernetesVersion = version
+
+	// new templates roll out new machines, which install the new version
+	machineTemplateQueries := GetInfrastructureProvider().KubernetesResourceQueries(instance).MachineTemplates
+	controlPlaneTemplate, _, _ := unstructured.NestedString(kcp.Object, "spec", "machineTemplate", "infrastructureRef", "name")
+	controlPlaneTemplateUpgraded := kubernetesVersionTemplateName(name+"-control-plane", version)
+	err = copyTemplate(dynamicClient, machineTemplateQueries[0].GroupVersionResource, controlPlaneTemplate, controlPlaneTemplateUpgraded, nil)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+
+	//   - newInstance.WorkerPools MachineDeployments
+	mdGroupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("machinedeployments")
+	mds := []*unstructured.Unstructured{}
+	for i, pool := range InstanceWorkerPools(instance) {
+		md, err := dynamicClient.Resource(common.ClusterAPIServedResource(mdGroupVersionResource)).Namespace(targetNamespace).Get(context.TODO(), workerPoolResourceName(name, pool.Name), metav1.GetOptions{})
+		if err != nil {
+			log.Printf("%#v\n", err)
+			return InstanceSpec{}, fmt.Errorf("Failed to get MachineDeployment of worker pool '%v', %#v", pool.Name, err)
+		}
+		workerTemplate, _, _ := unstructured.NestedString(md.Object, "spec", "template", "spec", "infrastructureRef", "name")
+		workerTemplateUpgraded := kubernetesVersionTemplateName(workerPoolResourceName(name, pool.Name), version)
+		err = copyTemplate(dynamicClient, machineTemplateQueries[i+1].GroupVersionResource, workerTemplate, workerTemplateUpgraded, nil)
+		if err != nil {
+			return InstanceSpec{}, err
+		}
+		workerConfigTemplate, _, _ := unstructured.NestedString(md.Object, "spec", "template", "spec", "bootstrap", "configRef", "name")
+		err = copyTemplate(dynamicClient, cabpkv1beta1.GroupVersion.WithResource("kubeadmconfigtemplates"), workerConfigTemplate, workerTemplateUpgraded, func(item *unstructured.Unstructured) error {
+			commands, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "template", "spec", "preKubeadmCommands")
+			return unstructured.SetNestedStringSlice(item.Object, setKubernetesVersionExports(commands, version), "spec", "template", "spec", "preKubeadmCommands")
+		})
+		if err != nil {
+			return InstanceSpec{}, err
+		}
+		err = unstructured.SetNestedField(md.Object, version, "spec", "template", "spec", "version")
+		if err == nil {
+			err = unstructured.SetNestedField(md.Object, workerTemplateUpgraded, "spec", "template", "spec", "infrastructureRef", "name")
+		}
+		if err == nil {
+			err = unstructured.SetNestedField(md.Object, workerTemplateUpgraded, "spec", "template", "spec", "bootstrap", "configRef", "name")
+		}
+		if err != nil {
+			return InstanceSpec{}, fmt.Errorf("Failed to set MachineDeployment version, %#v", err)
+		}
+		mds = append(mds, md)
+	}
+
+	err = setResourceAnnotation(dynamicClient, clusterAPIv1beta1.GroupVersion.WithResource("clusters"), name, instanceUpgradeFromAnnotation, from)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+
+	commands, _, _ := unstructured.NestedStringSlice(kcp.Object, "spec", "kubeadmConfigSpec", "preKubeadmCommands")
+	err = unstructured.SetNestedStringSlice(kcp.Object, setKubernetesVersionExports(commands, version), "spec", "kubeadmConfigSpec", "preKubeadmCommands")
+	if err == nil {
+		err = unstructured.SetNestedField(kcp.Object, version, "spec", "version")
+	}
+	if err == nil {
+		err = unstructured.SetNestedField(kcp.Object, controlPlaneTemplateUpgraded, "spec", "machineTemplate", "infrastructureRef", "name")
+	}
+	if err != nil {
+		return InstanceSpec{}, fmt.Errorf("Failed to set KubeadmControlPlane version, %#v", err)
+	}
+	_, err = dynamicClient.Resource(common.ClusterAPIServedResource(kcpGroupVersionResource)).Namespace(targetNamespace).Update(context.TODO(), kcp, metav1.UpdateOptions{})
+	if err != nil {
+		log.Printf("%#v\n", err)
+		return InstanceSpec{}, fmt.Errorf("Failed to update KubeadmControlPlane, %#v", err)
+	}
+
+	for _, md := range mds {
+		_, err = dynamicClient.Resource(common.ClusterAPIServedResource(mdGroupVersionResource)).Namespace(targetNamespace).Update(context.TODO(), md, metav1.UpdateOptions{})
+		if err != nil {
+			log.Printf("%#v\n", err)
+			return InstanceSpec{}, fmt.Errorf("Failed to update MachineDeployment '%v', %#v", md.GetName(), err)
+		}
+	}
+
+	// an override of the version in the env of the instance would otherwise be used when it's resumed
+	for i := range upgraded.Setup.Env {
+		if _, ok := upgraded.Setup.Env[i]["__SHARINGIO_PAIR_KUBERNETES_VERSION"]; ok {
+			upgraded.Setup.Env[i]["__SHARINGIO_PAIR_KUBERNETES_VERSION"] = version
+		}
+	}
+	err = UpdatePairInstanceSpec(upgraded, dynamicClient)
+	if err != nil {
+		return InstanceSpec{}, err
+	}
+	return upgraded, nil
+}
+
+// kubernetesUpgradeStatus ...
+// returns the progress of upgrading an instance, or nil if it isn't being upgraded
+func kubernetesUpgradeStatus(cluster metav1.Object, kcp clusterAPIControlPlaneKubeadmv1beta1.KubeadmControlPlane, dynamicClient dynamic.Interface) (status *InstanceUpgradeStatus, err error) {
+	from := cluster.GetAnnotations()[instanceUpgradeFromAnnotation]
+	if from == "" {
+		return nil, nil
+	}
+	status = &InstanceUpgradeStatus{
+		From: from,
+		To:   kcp.Spec.Version,
+	}
+	status.ControlPlaneUpdated = kcp.Status.Version != nil && *kcp.Status.Version == kcp.Spec.Version &&
+		kcp.Status.UpdatedReplicas == kcp.Status.Replicas && kcp.Status.UnavailableReplicas == 0
+
+	instance, err := GetInstanceSpecOfCluster(cluster, dynamicClient)
+	if err != nil {
+		return status, err
+	}
+	instance.Name = cluster.GetName()
+	groupVersionResource := clusterAPIv1beta1.GroupVersion.WithResource("machinedeployments")
+	status.WorkersUpdated = true
+	for _, pool := range InstanceWorkerPools(instance) {
+		item, err := dynamicClient.Resource(common.ClusterAPIServedResource(groupVersionResource)).Namespace(common.GetTargetNamespace()).Get(context.TODO(), workerPoolResourceName(instance.Name, pool.Name), metav1.GetOptions{})
+		if err != nil {
+			log.Printf("%#v\n", err)
+			return status, fmt.Errorf("Failed to get MachineDeployment of worker pool '%v', %#v", pool.Name, err)
+		}
+		var md clusterAPIv1beta1.MachineDeployment
+		err = restructure(item, &md)
+		if err != nil {
+			return status, fmt.Errorf("Failed to restructure %T", md)
+		}
+		replicas := int32(0)
+		if md.Spec.Replicas != nil {
+			replicas = *md.Spec.Replicas
+		}
+		if (md.Status.ObservedGeneration >= md.Generation &&
+			md.Status.UpdatedReplicas == replicas && md.Status.Replicas == replicas && md.Status.UnavailableReplicas == 0) != true {
+			status.WorkersUpdated = false
+		}
+	}
+
+	if status.ControlPlaneUpdated == true && status.WorkersUpdated == true {
+		err = setResourceAnnotation(dynamicClient, clusterAPIv1beta1.GroupVersion.WithResource("clusters"), cluster.GetName(), instanceUpgradeFromAnnotation, "")
+		if err != nil {
+			return status, err
+		}
+		log.Printf("Instance '%v' is upgraded from '%v' to '%v'\n", cluster.GetName(), status.From, status.To)
+	}
+	return status, nil
+}
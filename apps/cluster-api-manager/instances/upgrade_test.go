@@ -0,0 +1,68 @@
+package instances
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateKubernetesUpgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		wantErr bool
+	}{
+		{name: "a newer patch", from: "1.23.5", to: "1.23.6"},
+		{name: "the next minor", from: "1.23.5", to: "1.24.0"},
+		{name: "the next minor at an older patch", from: "1.23.6", to: "1.24.0"},
+		{name: "with a v prefix", from: "v1.23.5", to: "v1.23.6"},
+		{name: "the same version", from: "1.23.5", to: "1.23.5", wantErr: true},
+		{name: "an older patch", from: "1.23.6", to: "1.23.5", wantErr: true},
+		{name: "an older minor", from: "1.23.5", to: "1.22.8", wantErr: true},
+		{name: "skipping a minor", from: "1.22.8", to: "1.24.0", wantErr: true},
+		{name: "another major", from: "1.23.5", to: "2.0.0", wantErr: true},
+		{name: "an invalid version", from: "1.23.5", to: "1.24", wantErr: true},
+		{name: "an invalid current version", from: "", to: "1.23.6", wantErr: true},
+		{name: "a version which isn't a number", from: "1.23.5", to: "1.23.x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateKubernetesUpgrade(tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDefaultCatalogKubernetesUpgrades(t *testing.T) {
+	t.Setenv("APP_CATALOG", "")
+	t.Setenv("APP_INSTANCE_KUBERNETES_VERSION", "")
+
+	// NOTE instances of the default version must be able to upgrade without a configured catalog
+	upgrades := []string{}
+	for _, entry := range GetCatalog().KubernetesVersions.Options {
+		if ValidateKubernetesUpgrade(GetKubernetesVersion(), entry.Name) == nil && entry.IsAvailable(false, nil) == true {
+			upgrades = append(upgrades, entry.Name)
+		}
+	}
+	expected := []string{"1.23.6", "1.24.0"}
+	if reflect.DeepEqual(upgrades, expected) != true {
+		t.Errorf("expected upgrades from '%v' to %v, got %v", GetKubernetesVersion(), expected, upgrades)
+	}
+}
+
+func TestSetKubernetesVersionExports(t *testing.T) {
+	commands := []string{
+		"cat << EOF >> /root/.sharing-io-pair-init.env\nexport KUBERNETES_VERSION=1.23.5\nexport SHARINGIO_PAIR_INSTANCE_SETUP_USER=\"BobyMCbobs\"\nEOF",
+		"kubeadm init",
+	}
+	expected := []string{
+		"cat << EOF >> /root/.sharing-io-pair-init.env\nexport KUBERNETES_VERSION=1.24.0\nexport SHARINGIO_PAIR_INSTANCE_SETUP_USER=\"BobyMCbobs\"\nEOF",
+		"kubeadm init",
+	}
+	updated := setKubernetesVersionExports(commands, "1.24.0")
+	if reflect.DeepEqual(updated, expected) != true {
+		t.Errorf("expected %q, got %q", expected, updated)
+	}
+}
@@ -0,0 +1,179 @@
+package instances
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// misc worker pool vars
+var (
+	// instanceDefaultWorkerPoolName is the pool of instances which don't declare any
+	instanceDefaultWorkerPoolName = "a"
+	// workerPoolNamePattern is the names which pools may have, being part of the names of their resources
+	workerPoolNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,14}[a-z0-9])?$`)
+	// workerPoolLabelDomains are the domains of labels which the kubelet may set on it's own Node
+	workerPoolLabelDomains = []string{"node.kubernetes.io", "kubelet.kubernetes.io"}
+)
+
+// InstanceWorkerPools ...
+// returns the pools of worker nodes of an instance, with the node size and OS of the instance where they aren't set
+func InstanceWorkerPools(instance InstanceSpec) (pools []InstanceWorkerPool) {
+	if len(instance.WorkerPools) == 0 {
+		return []InstanceWorkerPool{{
+			Name:     instanceDefaultWorkerPoolName,
+			NodeSize: instance.NodeSize,
+			NodeOS:   instance.NodeOS,
+			Count:    instance.KubernetesNodeCount,
+		}}
+	}
+	for _, pool := range instance.WorkerPools {
+		pool.NodeSize = common.ReturnValueOrDefault(pool.NodeSize, instance.NodeSize)
+		pool.NodeOS = common.ReturnValueOrDefault(pool.NodeOS, instance.NodeOS)
+		pools = append(pools, pool)
+	}
+	return pools
+}
+
+// workerPoolResourceName ...
+// returns the name of the MachineDeployment and templates of a pool of an instance
+func workerPoolResourceName(name string, pool string) string {
+	return name + "-worker-" + pool
+}
+
+// workerPoolNodeCount ...
+// returns the total of worker nodes across the pools of an instance
+func workerPoolNodeCount(pools []InstanceWorkerPool) (count int) {
+	for _, pool := range pools {
+		count += pool.Count
+	}
+	return count
+}
+
+// NormalizeWorkerPools ...
+// returns an instance with it's node count as the total of it's worker pools, when it declares any
+func NormalizeWorkerPools(instance InstanceSpec) InstanceSpec {
+	if len(instance.WorkerPools) > 0 {
+		instance.KubernetesNodeCount = workerPoolNodeCount(instance.WorkerPools)
+	}
+	return instance
+}
+
+// validateWorkerPools ...
+// returns an error if the worker pools of an instance are invalid
+func validateWorkerPools(instance InstanceSpec) (err error) {
+	if len(instance.WorkerPools) > 0 && instance.Type != InstanceTypeKubernetes {
+		return fmt.Errorf("Only Kubernetes instances have worker pools")
+	}
+	names := map[string]bool{}
+	for _, pool := range instance.WorkerPools {
+		if workerPoolNamePattern.MatchString(pool.Name) != true {
+			return fmt.Errorf("Invalid worker pool name '%v', must be up to 16 lowercase alphanumeric characters or '-'", pool.Name)
+		}
+		if names[pool.Name] == true {
+			return fmt.Errorf("Worker pool '%v' is declared more than once", pool.Name)
+		}
+		names[pool.Name] = true
+		if pool.Count < 0 {
+			return fmt.Errorf("Invalid count of worker pool '%v'", pool.Name)
+		}
+		for key, value := range pool.Labels {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return fmt.Errorf("Invalid label '%v' of worker pool '%v', %v", key, pool.Name, strings.Join(errs, ", "))
+			}
+			if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+				return fmt.Errorf("Invalid value of label '%v' of worker pool '%v', %v", key, pool.Name, strings.Join(errs, ", "))
+			}
+			if workerPoolLabelAllowed(key) != true {
+				return fmt.Errorf("Label '%v' of worker pool '%v' is in a domain reserved by Kubernetes", key, pool.Name)
+			}
+		}
+		for _, taint := range pool.Taints {
+			if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+				return fmt.Errorf("Invalid taint '%v' of worker pool '%v', %v", taint.Key, pool.Name, strings.Join(errs, ", "))
+			}
+			if taint.Value != "" {
+				if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+					return fmt.Errorf("Invalid value of taint '%v' of worker pool '%v', %v", taint.Key, pool.Name, strings.Join(errs, ", "))
+				}
+			}
+			switch taint.Effect {
+			case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+			default:
+				return fmt.Errorf("Invalid effect '%v' of taint '%v' of worker pool '%v'", taint.Effect, taint.Key, pool.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// workerPoolLabelAllowed ...
+// returns if the kubelet may set a label on it's own Node, which it can't for most Kubernetes domains
+func workerPoolLabelAllowed(key string) bool {
+	split := strings.SplitN(key, "/", 2)
+	if len(split) != 2 {
+		return true
+	}
+	domain := split[0]
+	for _, allowed := range workerPoolLabelDomains {
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return domain != "kubernetes.io" && domain != "k8s.io" &&
+		strings.HasSuffix(domain, ".kubernetes.io") != true && strings.HasSuffix(domain, ".k8s.io") != true
+}
+
+// workerPoolKubeletExtraArgs ...
+// returns the args for the kubelet of the nodes of a pool, which labels their Node
+func workerPoolKubeletExtraArgs(kubeletExtraArgs map[string]string, pool InstanceWorkerPool) map[string]string {
+	args := map[string]string{}
+	for key, value := range kubeletExtraArgs {
+		args[key] = value
+	}
+	labels := []string{"io.sharing.pair/pool=" + pool.Name}
+	for key, value := range pool.Labels {
+		labels = append(labels, key+"="+value)
+	}
+	sort.Strings(labels)
+	args["node-labels"] = strings.Join(labels, ",")
+	return args
+}
+
+// GetWorkerPoolChanges ...
+// returns the fields of the worker pools of an instance which changed, besides their counts which are mutable.
+// Unset node sizes and OSes are unchanged
+func GetWorkerPoolChanges(current []InstanceWorkerPool, desired []InstanceWorkerPool) (fields []string) {
+	if len(desired) == 0 {
+		return fields
+	}
+	if len(current) != len(desired) {
+		return []string{"workerPools"}
+	}
+	withoutCount := func(pool InstanceWorkerPool) InstanceWorkerPool {
+		pool.Count = 0
+		if len(pool.Labels) == 0 {
+			pool.Labels = nil
+		}
+		if len(pool.Taints) == 0 {
+			pool.Taints = nil
+		}
+		return pool
+	}
+	for i := range desired {
+		currentPool, desiredPool := withoutCount(current[i]), withoutCount(desired[i])
+		desiredPool.NodeSize = common.ReturnValueOrDefault(desiredPool.NodeSize, currentPool.NodeSize)
+		desiredPool.NodeOS = common.ReturnValueOrDefault(desiredPool.NodeOS, currentPool.NodeOS)
+		if reflect.DeepEqual(currentPool, desiredPool) != true {
+			fields = append(fields, fmt.Sprintf("workerPools[%v]", i))
+		}
+	}
+	return fields
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+	"github.com/sharingio/pair/apps/cluster-api-manager/instances"
 	"github.com/sharingio/pair/apps/cluster-api-manager/kubernetes"
 	"github.com/sharingio/pair/apps/cluster-api-manager/routes"
 )
@@ -58,8 +59,35 @@ func handleWebserver() {
 		return
 	}
 
+	// use the Cluster-API versions which the management cluster serves
+	err = common.DiscoverClusterAPIVersions(clientset.Discovery())
+	if err != nil {
+		log.Panicln(err)
+		return
+	}
+
+	// migrate instances created before their resources were owned by their Cluster,
+	// before their secret env was kept in their setup Secret or before their spec was stored in a PairInstance
+	go func() {
+		err := instances.BackfillOwnerReferences(kubernetesDynamicClientset)
+		if err != nil {
+			log.Printf("Failed to backfill owner references, %v\n", err)
+		}
+		err = instances.BackfillSecretEnv(kubernetesDynamicClientset)
+		if err != nil {
+			log.Printf("Failed to move secret env into setup Secrets, %v\n", err)
+		}
+		err = instances.ConvertAnnotatedClusters(kubernetesDynamicClientset)
+		if err != nil {
+			log.Printf("Failed to convert annotated Clusters to PairInstances, %v\n", err)
+		}
+	}()
+
+	// all API endpoints require an authenticated identity
+	apiRouter := router.NewRoute().Subrouter()
+	apiRouter.Use(common.Authentication)
 	for _, endpoint := range routes.GetEndpoints(apiEndpointPrefix, clientset, kubernetesDynamicClientset, restConfig) {
-		router.HandleFunc(endpoint.EndpointPath, endpoint.HandlerFunc).Methods(endpoint.HTTPMethods...)
+		apiRouter.HandleFunc(endpoint.EndpointPath, endpoint.HandlerFunc).Methods(endpoint.HTTPMethods...)
 	}
 
 	router.HandleFunc(apiEndpointPrefix+"/{.*}", routes.APIUnknownEndpoint)
@@ -70,7 +98,7 @@ func handleWebserver() {
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedHeaders:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
 		AllowCredentials: true,
 	})
 
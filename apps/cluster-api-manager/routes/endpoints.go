@@ -3,6 +3,7 @@ package routes
 import (
 	"net/http"
 
+	"github.com/sharingio/pair/apps/cluster-api-manager/instances"
 	"github.com/sharingio/pair/apps/cluster-api-manager/types"
 
 	"k8s.io/client-go/dynamic"
@@ -55,6 +56,227 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 			HTTPMethods:  []string{http.MethodGet},
 		},
 
+		// swagger:route GET /catalog catalog getCatalog
+		//
+		// Get the node sizes, OS images, facilities and versions which instances may use, and which are available to the caller
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: catalog
+		{
+			EndpointPath: endpointPrefix + "/catalog",
+			HandlerFunc:  GetCatalog,
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route GET /quota quota getQuota
+		//
+		// Get the quota limits and usage of the caller, or of the user given for admins
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: quota
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/quota",
+			HandlerFunc:  GetQuota(dynamicClient),
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route GET /presets preset listPresets
+		//
+		// List the presets which instances may be created from
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: preset
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/presets",
+			HandlerFunc:  ListPresets(dynamicClient),
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route POST /presets preset createPreset
+		//
+		// Create a preset, for admins
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       201: preset
+		//       403: failure
+		//       422: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/presets",
+			HandlerFunc:  PostPreset(dynamicClient),
+			HTTPMethods:  []string{http.MethodPost},
+		},
+
+		// swagger:route GET /presets/{name} preset getPreset
+		//
+		// Get a preset
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: preset
+		//       404: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/presets/{name}",
+			HandlerFunc:  GetPreset(dynamicClient),
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route PUT /presets/{name} preset updatePreset
+		//
+		// Replace the description and spec of a preset, for admins
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: preset
+		//       403: failure
+		//       404: failure
+		//       422: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/presets/{name}",
+			HandlerFunc:  UpdatePreset(dynamicClient),
+			HTTPMethods:  []string{http.MethodPut},
+		},
+
+		// swagger:route DELETE /presets/{name} preset deletePreset
+		//
+		// Delete a preset, for admins
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: metaResponse
+		//       403: failure
+		//       404: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/presets/{name}",
+			HandlerFunc:  DeletePreset(dynamicClient),
+			HTTPMethods:  []string{http.MethodDelete},
+		},
+
+		// swagger:route GET /backups backup listBackups
+		//
+		// List the home directory backups of the caller, or of the user given for admins
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: backup
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/backups",
+			HandlerFunc:  ListBackups,
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route GET /backups/{name} backup getBackup
+		//
+		// Download the archive of a home directory backup of the caller, or of the user given for admins
+		//
+		//     Produces:
+		//     - application/gzip
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: backupArchive
+		//       403: failure
+		//       404: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/backups/{name}",
+			HandlerFunc:  GetBackup,
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route DELETE /backups/{name} backup deleteBackup
+		//
+		// Delete a home directory backup of the caller, or of the user given for admins
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: metaResponse
+		//       403: failure
+		//       404: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/backups/{name}",
+			HandlerFunc:  DeleteBackup,
+			HTTPMethods:  []string{http.MethodDelete},
+		},
+
 		// swagger:route GET /instance instance listInstances
 		//
 		// List all instances
@@ -111,6 +333,7 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//
 		//     Responses:
 		//       200: instance
+		//       403: failure
 		//       500: failure
 		{
 			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}",
@@ -132,10 +355,11 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//
 		//     Responses:
 		//       200: instanceData
+		//       403: failure
 		//       500: failure
 		{
 			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/kubeconfig",
-			HandlerFunc:  GetKubernetesKubeconfig(clientset),
+			HandlerFunc:  GetKubernetesKubeconfig(clientset, dynamicClient),
 			HTTPMethods:  []string{http.MethodGet},
 		},
 
@@ -153,10 +377,34 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//
 		//     Responses:
 		//       200: instanceIngresses
+		//       403: failure
 		//       500: failure
 		{
 			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/ingresses",
-			HandlerFunc:  GetKubernetesIngresses(clientset),
+			HandlerFunc:  GetKubernetesIngresses(clientset, dynamicClient),
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route GET /instance/kubernetes/{name}/manifests instance getInstanceKubernetesManifests
+		//
+		// export the management cluster resources of a Kubernetes instance, with Secret data redacted
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/yaml
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: instanceManifests
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/manifests",
+			HandlerFunc:  GetKubernetesManifests(dynamicClient),
 			HTTPMethods:  []string{http.MethodGet},
 		},
 
@@ -174,6 +422,7 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//
 		//     Responses:
 		//       200: metaResponse
+		//       403: failure
 		//       500: failure
 		{
 			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/certmanage",
@@ -195,6 +444,7 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//
 		//     Responses:
 		//       200: metaResponse
+		//       403: failure
 		//       500: failure
 		{
 			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/dnsmanage",
@@ -202,6 +452,28 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 			HTTPMethods:  []string{http.MethodGet, http.MethodPost},
 		},
 
+		// swagger:route POST /instance/kubernetes/{name}/statusmanage instance postInstanceKubernetesStatusmanage
+		//
+		// record the observed status of a Kubernetes instance on it's PairInstance
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: metaResponse
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/statusmanage",
+			HandlerFunc:  PostInstanceStatusManage(instances.InstanceTypeKubernetes, dynamicClient, clientset),
+			HTTPMethods:  []string{http.MethodGet, http.MethodPost},
+		},
+
 		// swagger:route GET /instance/kubernetes/{name}/tmate instance getInstanceKubernetesTmate
 		//
 		// get a tmate SSH sesion for an instance
@@ -216,6 +488,7 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//
 		//     Responses:
 		//       200: instanceData
+		//       403: failure
 		//       500: failure
 		{
 			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/tmate",
@@ -237,6 +510,7 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//
 		//     Responses:
 		//       200: instanceData
+		//       403: failure
 		//       500: failure
 		{
 			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/tmate/ssh",
@@ -258,6 +532,7 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//
 		//     Responses:
 		//       200: instanceData
+		//       403: failure
 		//       500: failure
 		{
 			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/tmate/web",
@@ -265,9 +540,9 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 			HTTPMethods:  []string{http.MethodGet},
 		},
 
-		// swagger:route POST /instance instance postInstance
+		// swagger:route GET /instance/plain instance listInstancesPlain
 		//
-		// creates an instance
+		// List all Plain instances
 		//
 		//     Consumes:
 		//     - application/json
@@ -278,17 +553,17 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//     Schemes: http
 		//
 		//     Responses:
-		//       200: instance
+		//       200: instanceList
 		//       500: failure
 		{
-			EndpointPath: endpointPrefix + "/instance",
-			HandlerFunc:  PostInstance(dynamicClient, clientset),
-			HTTPMethods:  []string{http.MethodPost},
+			EndpointPath: endpointPrefix + "/instance/plain",
+			HandlerFunc:  ListInstancesPlain(dynamicClient, clientset),
+			HTTPMethods:  []string{http.MethodGet},
 		},
 
-		// swagger:route DELETE /instance/kubernetes/{name} instance deleteInstanceKubernetes
+		// swagger:route GET /instance/plain/{name} instance getInstancePlain
 		//
-		// delete a Kubernetes instance
+		// get a Plain instance
 		//
 		//     Consumes:
 		//     - application/json
@@ -300,16 +575,17 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//
 		//     Responses:
 		//       200: instance
+		//       403: failure
 		//       500: failure
 		{
-			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}",
-			HandlerFunc:  DeleteInstanceKubernetes(dynamicClient, clientset),
-			HTTPMethods:  []string{http.MethodDelete},
+			EndpointPath: endpointPrefix + "/instance/plain/{name}",
+			HandlerFunc:  GetInstancePlain(dynamicClient, clientset),
+			HTTPMethods:  []string{http.MethodGet},
 		},
 
-		// swagger:route DELETE /instance instance deleteInstance
+		// swagger:route POST /instance/plain/{name}/dnsmanage instance getInstancePlainDNSmanage
 		//
-		// delete an instance
+		// initiate DNS management for a Plain instance
 		//
 		//     Consumes:
 		//     - application/json
@@ -320,12 +596,489 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//     Schemes: http
 		//
 		//     Responses:
-		//       200: instance
+		//       200: metaResponse
+		//       403: failure
 		//       500: failure
 		{
-			EndpointPath: endpointPrefix + "/instance",
-			HandlerFunc:  DeleteInstance(dynamicClient),
-			HTTPMethods:  []string{http.MethodDelete},
+			EndpointPath: endpointPrefix + "/instance/plain/{name}/dnsmanage",
+			HandlerFunc:  PostPlainDNSManage(dynamicClient),
+			HTTPMethods:  []string{http.MethodGet, http.MethodPost},
+		},
+
+		// swagger:route POST /instance/plain/{name}/setupmanage instance setupManageInstancePlain
+		//
+		// deliver the GitHub OAuth token and env of a Plain instance to it's machine, for it's bootstrap script to read once before starting it's Environment
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: metaResponse
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/plain/{name}/setupmanage",
+			HandlerFunc:  PostPlainSetupManage(clientset, dynamicClient),
+			HTTPMethods:  []string{http.MethodGet, http.MethodPost},
+		},
+
+		// swagger:route POST /instance/plain/{name}/statusmanage instance postInstancePlainStatusmanage
+		//
+		// record the observed status of a Plain instance on it's PairInstance
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: metaResponse
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/plain/{name}/statusmanage",
+			HandlerFunc:  PostInstanceStatusManage(instances.InstanceTypePlain, dynamicClient, clientset),
+			HTTPMethods:  []string{http.MethodGet, http.MethodPost},
+		},
+
+		// swagger:route GET /instance/plain/{name}/env instance getInstancePlainEnv
+		//
+		// reveal the env of a Plain instance with it's secret values, which only it's owner may
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: env
+		//       403: failure
+		//       404: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/plain/{name}/env",
+			HandlerFunc:  GetInstanceEnv(instances.InstanceTypePlain, dynamicClient),
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route GET /instance/plain/{name}/tmate/ssh instance getInstancePlainTmateSSH
+		//
+		// get a tmate SSH sesion for a Plain instance
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: instanceData
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/plain/{name}/tmate/ssh",
+			HandlerFunc:  GetPlainTmateSSHSession(clientset, dynamicClient),
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route GET /instance/plain/{name}/tmate/web instance getInstancePlainTmateWeb
+		//
+		// get a tmate web sesion for a Plain instance
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: instanceData
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/plain/{name}/tmate/web",
+			HandlerFunc:  GetPlainTmateWebSession(clientset, dynamicClient),
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route DELETE /instance/plain/{name} instance deleteInstancePlain
+		//
+		// delete a Plain instance
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: instance
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/plain/{name}",
+			HandlerFunc:  DeleteInstancePlain(dynamicClient),
+			HTTPMethods:  []string{http.MethodDelete},
+		},
+
+		// swagger:route POST /instance instance postInstance
+		//
+		// creates an instance, from a preset when one is named, or renders it's resources and scripts without creating when dryRun=true
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: instanceManifests
+		//       201: instance
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance",
+			HandlerFunc:  PostInstance(dynamicClient, clientset),
+			HTTPMethods:  []string{http.MethodPost},
+		},
+
+		// swagger:route PATCH /instance/kubernetes/{name} instance updateInstanceKubernetes
+		//
+		// update the guests, repos, env, timezone or node count of a Kubernetes instance
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: instance
+		//       400: failure
+		//       403: failure
+		//       422: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}",
+			HandlerFunc:  UpdateInstanceKubernetes(dynamicClient),
+			HTTPMethods:  []string{http.MethodPatch, http.MethodPut},
+		},
+
+		// swagger:route POST /instance/kubernetes/{name}/extend instance extendInstanceKubernetes
+		//
+		// extend the lifetime of a Kubernetes instance by the hours given, up to the max lifetime
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: instance
+		//       400: failure
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/extend",
+			HandlerFunc:  PostKubernetesExtend(dynamicClient),
+			HTTPMethods:  []string{http.MethodPost},
+		},
+
+		// swagger:route POST /instance/kubernetes/{name}/hibernate instance hibernateInstanceKubernetes
+		//
+		// snapshot the home directory of a Kubernetes instance and release it's machines, keeping it's spec, DNS names and cached cert
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: instance
+		//       403: failure
+		//       422: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/hibernate",
+			HandlerFunc:  PostKubernetesHibernate(clientset, dynamicClient),
+			HTTPMethods:  []string{http.MethodPost},
+		},
+
+		// swagger:route POST /instance/kubernetes/{name}/resume instance resumeInstanceKubernetes
+		//
+		// reprovision a hibernated Kubernetes instance from it's stored spec, restoring it's home directory once it's ready
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       202: instance
+		//       403: failure
+		//       422: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/resume",
+			HandlerFunc:  PostKubernetesResume(clientset, dynamicClient),
+			HTTPMethods:  []string{http.MethodPost},
+		},
+
+		// swagger:route POST /instance/kubernetes/{name}/upgrade instance upgradeInstanceKubernetes
+		//
+		// upgrade the Kubernetes version of a Kubernetes instance to the next minor or a newer patch version, rolling out new machines
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       202: instance
+		//       400: failure
+		//       403: failure
+		//       422: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/upgrade",
+			HandlerFunc:  PostKubernetesUpgrade(dynamicClient),
+			HTTPMethods:  []string{http.MethodPost},
+		},
+
+		// swagger:route POST /instance/kubernetes/{name}/clone instance cloneInstanceKubernetes
+		//
+		// create a Kubernetes instance like another, with a generated name and the fields in the body overriding those of the other
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       201: instance
+		//       400: failure
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/clone",
+			HandlerFunc:  PostKubernetesClone(dynamicClient, clientset),
+			HTTPMethods:  []string{http.MethodPost},
+		},
+
+		// swagger:route GET /instance/kubernetes/{name}/env instance getInstanceKubernetesEnv
+		//
+		// reveal the env of a Kubernetes instance with it's secret values, which only it's owner may
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: env
+		//       403: failure
+		//       404: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/env",
+			HandlerFunc:  GetInstanceEnv(instances.InstanceTypeKubernetes, dynamicClient),
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route GET /instance/kubernetes/{name}/nodes instance getInstanceKubernetesNodes
+		//
+		// get the worker nodes of a Kubernetes instance and the progress of it's machines
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: nodes
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/nodes",
+			HandlerFunc:  GetKubernetesNodes(dynamicClient),
+			HTTPMethods:  []string{http.MethodGet},
+		},
+
+		// swagger:route PUT /instance/kubernetes/{name}/nodes instance updateInstanceKubernetesNodes
+		//
+		// scale the worker nodes of a Kubernetes instance, or one of it's worker pools, within the quota of it's user
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       202: nodes
+		//       400: failure
+		//       403: failure
+		//       422: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/nodes",
+			HandlerFunc:  UpdateKubernetesNodes(dynamicClient),
+			HTTPMethods:  []string{http.MethodPut},
+		},
+
+		// swagger:route DELETE /instance/kubernetes/{name} instance deleteInstanceKubernetes
+		//
+		// delete a Kubernetes instance
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: instance
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}",
+			HandlerFunc:  DeleteInstanceKubernetes(dynamicClient, clientset),
+			HTTPMethods:  []string{http.MethodDelete},
+		},
+
+		// swagger:route DELETE /instance instance deleteInstance
+		//
+		// delete an instance
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: instance
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance",
+			HandlerFunc:  DeleteInstance(dynamicClient, clientset),
+			HTTPMethods:  []string{http.MethodDelete},
+		},
+
+		// swagger:route POST /instance/kubernetes/{name}/homemanage instance homeManageInstanceKubernetes
+		//
+		// restore the home directory snapshot of a resumed Kubernetes instance, once it's Environment is ready
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: metaResponse
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/homemanage",
+			HandlerFunc:  PostKubernetesHomeManage(clientset, dynamicClient),
+			HTTPMethods:  []string{http.MethodGet, http.MethodPost},
+		},
+
+		// swagger:route POST /instance/kubernetes/{name}/setupmanage instance setupManageInstanceKubernetes
+		//
+		// deliver the GitHub OAuth token and env of a Kubernetes instance into it's cluster, for it's control plane to read once while bootstrapping,
+		// or push it's updated guests, repos, env and timezone to it's running Environment
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: metaResponse
+		//       403: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/setupmanage",
+			HandlerFunc:  PostKubernetesSetupManage(clientset, dynamicClient),
+			HTTPMethods:  []string{http.MethodGet, http.MethodPost},
+		},
+
+		// swagger:route POST /instance/kubernetes/{name}/homebackup instance backupInstanceKubernetesHome
+		//
+		// back up the home directory of a Kubernetes instance once it's due, or now when forced
+		//
+		//     Consumes:
+		//     - application/json
+		//
+		//     Produces:
+		//     - application/json
+		//
+		//     Schemes: http
+		//
+		//     Responses:
+		//       200: backup
+		//       403: failure
+		//       422: failure
+		//       500: failure
+		{
+			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/homebackup",
+			HandlerFunc:  PostKubernetesHomeBackup(clientset, dynamicClient),
+			HTTPMethods:  []string{http.MethodGet, http.MethodPost},
 		},
 
 		// swagger:route POST /instance/kubernetes/{name}/syncProviderID instance updateInstanceKubernetesNodeProviderID
@@ -342,6 +1095,7 @@ func GetEndpoints(endpointPrefix string, clientset *kubernetes.Clientset, dynami
 		//
 		//     Responses:
 		//       200: metaResponse
+		//       403: failure
 		//       500: failure
 		{
 			EndpointPath: endpointPrefix + "/instance/kubernetes/{name}/syncProviderID",
@@ -6,11 +6,14 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	// networkingv1 "k8s.io/api/networking/v1"
@@ -24,6 +27,67 @@ import (
 	"github.com/sharingio/pair/apps/cluster-api-manager/types"
 )
 
+// authorizeInstance ...
+// responds and returns false when an instance of the type doesn't exist or the requester may not take the action on it
+func authorizeInstance(w http.ResponseWriter, r *http.Request, dynamicClient dynamic.Interface, name string, instanceType instances.InstanceType, action instances.InstanceAction) bool {
+	identity, _ := common.IdentityFromRequest(r)
+	spec, err := instances.GetSpec(name, dynamicClient)
+	if err != nil {
+		common.JSONResponse(r, w, http.StatusInternalServerError, types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: err.Error(),
+			},
+		})
+		return false
+	}
+	if spec.Name == "" || spec.Type != instanceType {
+		common.JSONResponse(r, w, http.StatusNotFound, types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Resource not found",
+			},
+		})
+		return false
+	}
+	if instances.IdentityCanOnInstance(spec, identity, action) != true {
+		log.Printf("Identity '%v' is not permitted to '%v' instance '%v'\n", identity.Username, action, name)
+		common.JSONResponse(r, w, http.StatusForbidden, types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Forbidden",
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// authorizeAdmin ...
+// returns if the requester is an admin, responding as forbidden when they're not
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	identity, _ := common.IdentityFromRequest(r)
+	if identity.Admin == true {
+		return true
+	}
+	log.Printf("Identity '%v' is not permitted to '%v %v', which is only for admins\n", identity.Username, r.Method, r.URL.Path)
+	common.JSONResponse(r, w, http.StatusForbidden, types.JSONMessageResponse{
+		Metadata: types.JSONResponseMetadata{
+			Response: "Forbidden",
+		},
+	})
+	return false
+}
+
+// filterInstancesForRequest ...
+// returns only the instances which the requester is the owner or a guest of, unless they're an admin
+func filterInstancesForRequest(r *http.Request, availableInstances []instances.Instance) (filteredInstances []instances.Instance) {
+	identity, _ := common.IdentityFromRequest(r)
+	for _, instance := range availableInstances {
+		if instances.IdentityCanOnInstance(instance.Spec, identity, instances.InstanceActionRead) == true {
+			filteredInstances = append(filteredInstances, instance)
+		}
+	}
+	return filteredInstances
+}
+
 // GetInstanceKubernetes ...
 // handler for getting a kubernetes instance type
 func GetInstanceKubernetes(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) http.HandlerFunc {
@@ -32,6 +96,9 @@ func GetInstanceKubernetes(dynamicClient dynamic.Interface, clientset *kubernete
 
 		vars := mux.Vars(r)
 		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionRead) != true {
+			return
+		}
 
 		instance, err := instances.KubernetesGet(name, dynamicClient, clientset)
 		if instance.Spec.Name == "" && err == nil {
@@ -86,6 +153,7 @@ func ListInstances(dynamicClient dynamic.Interface, clientset *kubernetes.Client
 		}
 
 		availableInstances, err := instances.List(dynamicClient, clientset, options)
+		availableInstances = filterInstancesForRequest(r, availableInstances)
 		if err != nil {
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
@@ -125,6 +193,7 @@ func ListInstancesKubernetes(dynamicClient dynamic.Interface, clientset *kuberne
 		}
 
 		availableInstances, err := instances.KubernetesList(dynamicClient, clientset, options)
+		availableInstances = filterInstancesForRequest(r, availableInstances)
 		if err != nil {
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
@@ -155,16 +224,54 @@ func PostInstance(dynamicClient dynamic.Interface, clientset *kubernetes.Clients
 	return func(w http.ResponseWriter, r *http.Request) {
 		responseCode := http.StatusInternalServerError
 
-		var instance instances.InstanceSpec
 		body, _ := ioutil.ReadAll(r.Body)
-		json.Unmarshal(body, &instance)
+		instance, err := instances.InstanceSpecFromRequest(body, dynamicClient)
+		if err != nil {
+			var notFoundErr instances.PresetNotFoundError
+			if errors.As(err, &notFoundErr) {
+				responseCode = http.StatusBadRequest
+			}
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		// the owner of an instance is always the authenticated identity
+		identity, _ := common.IdentityFromRequest(r)
+		instance.Setup.User = identity.Username
 
 		dryRunFormValue := r.FormValue("dryRun")
+		lifetimeHours, _ := strconv.Atoi(r.FormValue("lifetimeHours"))
 		options := instances.InstanceCreateOptions{
-			DryRun: dryRunFormValue == "true",
+			DryRun:   dryRunFormValue == "true",
+			Admin:    identity.Admin,
+			Lifetime: time.Duration(lifetimeHours) * time.Hour,
+			Groups:   identity.Groups,
 		}
 
-		instanceCreated, err := instances.Create(instance, dynamicClient, clientset, options)
+		instanceCreated, manifests, err := instances.Create(instance, dynamicClient, clientset, options)
+		var quotaErr instances.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			responseCode = http.StatusForbidden
+		}
+		var createErr instances.InstanceCreateError
+		if errors.As(err, &createErr) {
+			// report the step which failed and what was rolled back
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   createErr,
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
 		if err != nil {
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
@@ -176,6 +283,17 @@ func PostInstance(dynamicClient dynamic.Interface, clientset *kubernetes.Clients
 			common.JSONResponse(r, w, responseCode, JSONresp)
 			return
 		}
+		if options.DryRun == true {
+			responseCode = http.StatusOK
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Rendered instance (dry run)",
+				},
+				Spec: manifests,
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
 		responseCode = http.StatusCreated
 		JSONresp := types.JSONMessageResponse{
 			Metadata: types.JSONResponseMetadata{
@@ -190,16 +308,20 @@ func PostInstance(dynamicClient dynamic.Interface, clientset *kubernetes.Clients
 	}
 }
 
-// DeleteInstanceKubernetes ...
-// handler for deleting a Kubernetes instance type
-func DeleteInstanceKubernetes(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) http.HandlerFunc {
+// PostKubernetesClone ...
+// handler for creating a Kubernetes instance like another, with the fields in the body overriding those of the other
+func PostKubernetesClone(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		responseCode := http.StatusInternalServerError
 
 		vars := mux.Vars(r)
 		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
 
-		instance, err := instances.KubernetesGet(name, dynamicClient, clientset)
+		identity, _ := common.IdentityFromRequest(r)
+		instance, err := instances.KubernetesCloneSpec(name, identity.Username, dynamicClient, clientset)
 		if err != nil {
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
@@ -211,20 +333,53 @@ func DeleteInstanceKubernetes(dynamicClient dynamic.Interface, clientset *kubern
 			common.JSONResponse(r, w, responseCode, JSONresp)
 			return
 		}
-		if instance.Spec.Name == "" {
-			responseCode = http.StatusNotFound
+		body, _ := ioutil.ReadAll(r.Body)
+		if len(body) > 0 {
+			err = json.Unmarshal(body, &instance)
+			if err != nil {
+				responseCode = http.StatusBadRequest
+				JSONresp := types.JSONMessageResponse{
+					Metadata: types.JSONResponseMetadata{
+						Response: fmt.Sprintf("Invalid overrides, %v", err.Error()),
+					},
+					Spec:   instances.InstanceSpec{},
+					Status: instances.InstanceStatus{},
+				}
+				common.JSONResponse(r, w, responseCode, JSONresp)
+				return
+			}
+		}
+		// the owner of the clone is always the authenticated identity
+		instance.Setup.User = identity.Username
+		instance.Type = instances.InstanceTypeKubernetes
+
+		dryRunFormValue := r.FormValue("dryRun")
+		lifetimeHours, _ := strconv.Atoi(r.FormValue("lifetimeHours"))
+		options := instances.InstanceCreateOptions{
+			DryRun:     dryRunFormValue == "true",
+			NameScheme: instances.InstanceNameSchemeGenerateFromUsername,
+			Admin:      identity.Admin,
+			Lifetime:   time.Duration(lifetimeHours) * time.Hour,
+			Groups:     identity.Groups,
+		}
+
+		instanceCreated, manifests, err := instances.Create(instance, dynamicClient, clientset, options)
+		var quotaErr instances.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			responseCode = http.StatusForbidden
+		}
+		var createErr instances.InstanceCreateError
+		if errors.As(err, &createErr) {
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
-					Response: "Resource not found",
+					Response: err.Error(),
 				},
-				Spec:   instances.InstanceSpec{},
+				Spec:   createErr,
 				Status: instances.InstanceStatus{},
 			}
 			common.JSONResponse(r, w, responseCode, JSONresp)
 			return
 		}
-
-		err = instances.KubernetesDelete(name, dynamicClient)
 		if err != nil {
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
@@ -236,37 +391,71 @@ func DeleteInstanceKubernetes(dynamicClient dynamic.Interface, clientset *kubern
 			common.JSONResponse(r, w, responseCode, JSONresp)
 			return
 		}
-		responseCode = http.StatusOK
+		if options.DryRun == true {
+			responseCode = http.StatusOK
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Rendered clone of instance (dry run)",
+				},
+				Spec: manifests,
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusCreated
 		JSONresp := types.JSONMessageResponse{
 			Metadata: types.JSONResponseMetadata{
-				Response: "Deleting instance",
+				Response: fmt.Sprintf("Creating clone of instance '%v'", name),
 			},
+			Spec: instanceCreated,
 			Status: instances.InstanceStatus{
-				Phase: instances.InstanceStatusPhaseDeleting,
+				Phase: instances.InstanceStatusPhasePending,
 			},
 		}
 		common.JSONResponse(r, w, responseCode, JSONresp)
 	}
 }
 
-// DeleteInstance ...
-// handler for deleting an instance
-func DeleteInstance(dynamicClient dynamic.Interface) http.HandlerFunc {
+// GetCatalog ...
+// handler for getting the catalog, with the entries available to the caller
+func GetCatalog(w http.ResponseWriter, r *http.Request) {
+	identity, _ := common.IdentityFromRequest(r)
+	admin := identity.Admin
+	JSONresp := types.JSONMessageResponse{
+		Metadata: types.JSONResponseMetadata{
+			Response: "Fetched catalog",
+		},
+		Spec: instances.GetCatalog().ForCaller(admin, identity.Groups),
+	}
+	common.JSONResponse(r, w, http.StatusOK, JSONresp)
+}
+
+// presetErrorResponseCode ...
+// returns the response code for an error from managing presets
+func presetErrorResponseCode(err error) int {
+	var notFoundErr instances.PresetNotFoundError
+	if errors.As(err, &notFoundErr) {
+		return http.StatusNotFound
+	}
+	var invalidErr instances.PresetInvalidError
+	if errors.As(err, &invalidErr) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// ListPresets ...
+// handler for listing the presets which instances may be created from
+func ListPresets(dynamicClient dynamic.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		responseCode := http.StatusInternalServerError
 
-		var instance instances.InstanceSpec
-		body, _ := ioutil.ReadAll(r.Body)
-		json.Unmarshal(body, &instance)
-
-		err := instances.Delete(instance, dynamicClient)
+		presets, err := instances.ListPresets(dynamicClient)
 		if err != nil {
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
 					Response: err.Error(),
 				},
-				Spec:   instances.InstanceSpec{},
-				Status: instances.InstanceStatus{},
 			}
 			common.JSONResponse(r, w, responseCode, JSONresp)
 			return
@@ -274,235 +463,1233 @@ func DeleteInstance(dynamicClient dynamic.Interface) http.HandlerFunc {
 		responseCode = http.StatusOK
 		JSONresp := types.JSONMessageResponse{
 			Metadata: types.JSONResponseMetadata{
-				Response: "Deleting instance",
-			},
-			Status: instances.InstanceStatus{
-				Phase: instances.InstanceStatusPhaseDeleting,
+				Response: "Fetched presets",
 			},
+			List: presets,
 		}
 		common.JSONResponse(r, w, responseCode, JSONresp)
 	}
 }
 
-// GetKubernetesKubeconfig ...
-// handler for getting an instance's KubeConfig as YAML
-func GetKubernetesKubeconfig(kubernetesClientset *kubernetes.Clientset) http.HandlerFunc {
+// GetPreset ...
+// handler for getting a preset
+func GetPreset(dynamicClient dynamic.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		response := "Fetched Kubeconfig for instance"
-		responseCode := http.StatusInternalServerError
-
 		vars := mux.Vars(r)
 		name := vars["name"]
 
-		kubeconfig, err := instances.KubernetesGetKubeconfigYAML(name, kubernetesClientset)
-		if kubeconfig == "" && err == nil {
-			responseCode = http.StatusNotFound
-			JSONresp := types.JSONMessageResponse{
-				Metadata: types.JSONResponseMetadata{
-					Response: "Resource not found",
-				},
-				Spec: clientcmdapi.Config{},
-			}
-			common.JSONResponse(r, w, responseCode, JSONresp)
-			return
-		}
+		preset, err := instances.GetPreset(name, dynamicClient)
 		if err != nil {
-			log.Println(err)
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
 					Response: err.Error(),
 				},
-				Spec: kubeconfig,
 			}
-			common.JSONResponse(r, w, responseCode, JSONresp)
+			common.JSONResponse(r, w, presetErrorResponseCode(err), JSONresp)
 			return
 		}
-		responseCode = http.StatusOK
 		JSONresp := types.JSONMessageResponse{
 			Metadata: types.JSONResponseMetadata{
-				Response: response,
+				Response: "Fetched preset",
 			},
-			Spec: kubeconfig,
+			Spec: preset,
 		}
-		common.JSONResponse(r, w, responseCode, JSONresp)
+		common.JSONResponse(r, w, http.StatusOK, JSONresp)
 	}
 }
 
-// GetKubernetesTmateSSHSession ...
-// handler for getting an instance's tmate SSH session
-func GetKubernetesTmateSSHSession(clientset *kubernetes.Clientset, restConfig *rest.Config, dynamicClientSet dynamic.Interface) http.HandlerFunc {
+// PostPreset ...
+// handler for creating a preset, for admins
+func PostPreset(dynamicClient dynamic.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		response := "Fetched Tmate session for instance"
-		responseCode := http.StatusInternalServerError
-
-		vars := mux.Vars(r)
-		name := vars["name"]
-
-		instance, err := instances.KubernetesGet(name, dynamicClientSet, clientset)
-		if instance.Spec.Name == "" && err == nil {
-			responseCode = http.StatusNotFound
-			JSONresp := types.JSONMessageResponse{
-				Metadata: types.JSONResponseMetadata{
-					Response: "Resource not found",
-				},
-				Spec:   instances.InstanceSpec{},
-				Status: instances.InstanceStatus{},
-			}
-			common.JSONResponse(r, w, responseCode, JSONresp)
+		if authorizeAdmin(w, r) != true {
 			return
 		}
 
-		instance.Spec.Setup.UserLowercase = strings.ToLower(instance.Spec.Setup.User)
-		session, err := instances.KubernetesGetTmateSSHSession(clientset, name, instance.Spec.Setup.UserLowercase)
-		notFound := err != nil && (strings.Contains(err.Error(), "Failed to get Kubernetes cluster Kubeconfig") ||
-			strings.Contains(err.Error(), "not found"))
-		if firstSnippit := strings.Split(session, " "); firstSnippit[0] != "ssh" && err == nil || notFound {
-			responseCode = http.StatusNotFound
-			JSONresp := types.JSONMessageResponse{
-				Metadata: types.JSONResponseMetadata{
-					Response: "Resource not found",
-				},
-				Spec: "",
-			}
-			common.JSONResponse(r, w, responseCode, JSONresp)
-			return
-		}
+		var preset instances.InstancePreset
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &preset)
+
+		presetCreated, err := instances.CreatePreset(preset, dynamicClient)
 		if err != nil {
-			log.Println(err)
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
 					Response: err.Error(),
 				},
-				Spec: "",
 			}
-			common.JSONResponse(r, w, responseCode, JSONresp)
+			common.JSONResponse(r, w, presetErrorResponseCode(err), JSONresp)
 			return
 		}
-		responseCode = http.StatusOK
 		JSONresp := types.JSONMessageResponse{
 			Metadata: types.JSONResponseMetadata{
-				Response: response,
+				Response: "Created preset",
 			},
-			Spec: session,
+			Spec: presetCreated,
 		}
-		common.JSONResponse(r, w, responseCode, JSONresp)
+		common.JSONResponse(r, w, http.StatusCreated, JSONresp)
 	}
 }
 
-// GetKubernetesTmateWebSession ...
-// handler for getting an instance's tmate web session
-func GetKubernetesTmateWebSession(clientset *kubernetes.Clientset, restConfig *rest.Config, dynamicClientSet dynamic.Interface) http.HandlerFunc {
+// UpdatePreset ...
+// handler for replacing the description and spec of a preset, for admins
+func UpdatePreset(dynamicClient dynamic.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		response := "Fetched Tmate session for instance"
-		responseCode := http.StatusInternalServerError
+		if authorizeAdmin(w, r) != true {
+			return
+		}
 
 		vars := mux.Vars(r)
 		name := vars["name"]
+		var preset instances.InstancePreset
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &preset)
 
-		instance, err := instances.KubernetesGet(name, dynamicClientSet, clientset)
-		if instance.Spec.Name == "" && err == nil {
-			responseCode = http.StatusNotFound
-			JSONresp := types.JSONMessageResponse{
-				Metadata: types.JSONResponseMetadata{
-					Response: "Resource not found",
-				},
-				Spec:   instances.InstanceSpec{},
-				Status: instances.InstanceStatus{},
-			}
-			common.JSONResponse(r, w, responseCode, JSONresp)
-			return
-		}
-
-		instance.Spec.Setup.UserLowercase = strings.ToLower(instance.Spec.Setup.User)
-		session, err := instances.KubernetesGetTmateWebSession(clientset, name, instance.Spec.Setup.UserLowercase)
-		notFound := err != nil && (strings.Contains(err.Error(), "Failed to get Kubernetes cluster Kubeconfig") ||
-			strings.Contains(err.Error(), "not found"))
-		if firstSnippit := strings.Split(session, ":"); firstSnippit[0] != "https" && err == nil || notFound {
-			responseCode = http.StatusNotFound
-			JSONresp := types.JSONMessageResponse{
-				Metadata: types.JSONResponseMetadata{
-					Response: "Resource not found",
-				},
-				Spec: "",
-			}
-			common.JSONResponse(r, w, responseCode, JSONresp)
-			return
-		}
+		presetUpdated, err := instances.UpdatePreset(name, preset, dynamicClient)
 		if err != nil {
-			log.Println(err)
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
 					Response: err.Error(),
 				},
-				Spec: "",
 			}
-			common.JSONResponse(r, w, responseCode, JSONresp)
+			common.JSONResponse(r, w, presetErrorResponseCode(err), JSONresp)
 			return
 		}
-		responseCode = http.StatusOK
 		JSONresp := types.JSONMessageResponse{
 			Metadata: types.JSONResponseMetadata{
-				Response: response,
+				Response: "Updated preset",
 			},
-			Spec: session,
+			Spec: presetUpdated,
 		}
-		common.JSONResponse(r, w, responseCode, JSONresp)
+		common.JSONResponse(r, w, http.StatusOK, JSONresp)
 	}
 }
 
-// GetKubernetesIngresses ...
-// handler for getting an instance's ingresse mappings
-func GetKubernetesIngresses(kubernetesClientset *kubernetes.Clientset) http.HandlerFunc {
+// DeletePreset ...
+// handler for deleting a preset, for admins
+func DeletePreset(dynamicClient dynamic.Interface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		response := "Fetched Kubeconfig for instance"
-		responseCode := http.StatusInternalServerError
+		if authorizeAdmin(w, r) != true {
+			return
+		}
 
 		vars := mux.Vars(r)
 		name := vars["name"]
-
-		ingresses, err := instances.KubernetesGetInstanceIngresses(kubernetesClientset, name)
-		if len(ingresses) == 0 && err == nil {
-			responseCode = http.StatusNotFound
-			JSONresp := types.JSONMessageResponse{
-				Metadata: types.JSONResponseMetadata{
-					Response: "Resource not found",
-				},
-				Spec: []instances.Ingress{},
-			}
-			common.JSONResponse(r, w, responseCode, JSONresp)
-			return
-		}
+		err := instances.DeletePreset(name, dynamicClient)
 		if err != nil {
-			log.Println(err)
 			JSONresp := types.JSONMessageResponse{
 				Metadata: types.JSONResponseMetadata{
 					Response: err.Error(),
 				},
-				Spec: []instances.Ingress{},
 			}
-			common.JSONResponse(r, w, responseCode, JSONresp)
+			common.JSONResponse(r, w, presetErrorResponseCode(err), JSONresp)
 			return
 		}
-		responseCode = http.StatusOK
 		JSONresp := types.JSONMessageResponse{
 			Metadata: types.JSONResponseMetadata{
-				Response: response,
+				Response: "Deleted preset",
 			},
-			List: ingresses,
 		}
-		common.JSONResponse(r, w, responseCode, JSONresp)
+		common.JSONResponse(r, w, http.StatusOK, JSONresp)
 	}
 }
 
-// PostKubernetesDNSManage ...
-// handler for initiating DNS management for an instance
-func PostKubernetesDNSManage(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		response := "Failed to initiate DNS management"
+// backupUserForRequest ...
+// returns the user whose backups are requested, being the caller or the user given for admins.
+// Responds as forbidden and returns false when a non-admin gives another user
+func backupUserForRequest(w http.ResponseWriter, r *http.Request) (user string, ok bool) {
+	identity, _ := common.IdentityFromRequest(r)
+	user = identity.Username
+	if username := r.FormValue("username"); username != "" && strings.EqualFold(username, identity.Username) != true {
+		if identity.Admin != true {
+			common.JSONResponse(r, w, http.StatusForbidden, types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Forbidden",
+				},
+			})
+			return "", false
+		}
+		user = username
+	}
+	return user, true
+}
+
+// ListBackups ...
+// handler for listing the home directory backups of the caller, or of a user for admins
+func ListBackups(w http.ResponseWriter, r *http.Request) {
+	responseCode := http.StatusInternalServerError
+
+	user, ok := backupUserForRequest(w, r)
+	if ok != true {
+		return
+	}
+	backups, err := instances.ListHomeBackups(user)
+	if err != nil {
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: err.Error(),
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+		return
+	}
+	responseCode = http.StatusOK
+	JSONresp := types.JSONMessageResponse{
+		Metadata: types.JSONResponseMetadata{
+			Response: "Fetched backups",
+		},
+		List: backups,
+	}
+	common.JSONResponse(r, w, responseCode, JSONresp)
+}
+
+// GetBackup ...
+// handler for downloading the archive of a home directory backup of the caller, or of a user for admins
+func GetBackup(w http.ResponseWriter, r *http.Request) {
+	responseCode := http.StatusInternalServerError
+
+	vars := mux.Vars(r)
+	name := vars["name"]
+	user, ok := backupUserForRequest(w, r)
+	if ok != true {
+		return
+	}
+	archive, err := instances.GetHomeBackup(user, name)
+	var notFoundErr instances.HomeBackupNotFoundError
+	if errors.As(err, &notFoundErr) {
+		responseCode = http.StatusNotFound
+	}
+	if err != nil {
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: err.Error(),
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".tar.gz"))
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// DeleteBackup ...
+// handler for deleting a home directory backup of the caller, or of a user for admins
+func DeleteBackup(w http.ResponseWriter, r *http.Request) {
+	responseCode := http.StatusInternalServerError
+
+	vars := mux.Vars(r)
+	name := vars["name"]
+	user, ok := backupUserForRequest(w, r)
+	if ok != true {
+		return
+	}
+	err := instances.DeleteHomeBackup(user, name)
+	var notFoundErr instances.HomeBackupNotFoundError
+	if errors.As(err, &notFoundErr) {
+		responseCode = http.StatusNotFound
+	}
+	if err != nil {
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: err.Error(),
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+		return
+	}
+	responseCode = http.StatusOK
+	JSONresp := types.JSONMessageResponse{
+		Metadata: types.JSONResponseMetadata{
+			Response: "Deleted backup",
+		},
+	}
+	common.JSONResponse(r, w, responseCode, JSONresp)
+}
+
+// GetQuota ...
+// handler for getting the quota limits and usage of the caller, or of a user for admins
+func GetQuota(dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		identity, _ := common.IdentityFromRequest(r)
+		subject := instances.QuotaSubject{
+			Username: identity.Username,
+			Groups:   identity.Groups,
+			Admin:    identity.Admin,
+		}
+		if username := r.FormValue("username"); username != "" && strings.EqualFold(username, identity.Username) != true {
+			if identity.Admin != true {
+				responseCode = http.StatusForbidden
+				JSONresp := types.JSONMessageResponse{
+					Metadata: types.JSONResponseMetadata{
+						Response: "Forbidden",
+					},
+				}
+				common.JSONResponse(r, w, responseCode, JSONresp)
+				return
+			}
+			// the groups of other users aren't known, so their quota is resolved from their own or the default
+			subject = instances.QuotaSubject{Username: username}
+		}
+
+		quota, err := instances.GetQuota(subject, dynamicClient)
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Fetched quota",
+			},
+			Spec: quota,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// UpdateInstanceKubernetes ...
+// handler for updating the mutable fields of a Kubernetes instance
+// PATCH changes only the fields given, PUT replaces all mutable fields
+func UpdateInstanceKubernetes(dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
+
+		var instance instances.InstanceSpec
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method == http.MethodPatch {
+			current, err := instances.GetSpec(name, dynamicClient)
+			if err != nil {
+				JSONresp := types.JSONMessageResponse{
+					Metadata: types.JSONResponseMetadata{
+						Response: err.Error(),
+					},
+					Spec:   instances.InstanceSpec{},
+					Status: instances.InstanceStatus{},
+				}
+				common.JSONResponse(r, w, responseCode, JSONresp)
+				return
+			}
+			instance, err = instances.PatchInstanceSpec(current, body)
+			if err != nil {
+				responseCode = http.StatusBadRequest
+				JSONresp := types.JSONMessageResponse{
+					Metadata: types.JSONResponseMetadata{
+						Response: fmt.Sprintf("Invalid instance, %v", err.Error()),
+					},
+					Spec:   instances.InstanceSpec{},
+					Status: instances.InstanceStatus{},
+				}
+				common.JSONResponse(r, w, responseCode, JSONresp)
+				return
+			}
+		}
+		var err error
+		if r.Method == http.MethodPut {
+			err = json.Unmarshal(body, &instance)
+		}
+		if err != nil {
+			responseCode = http.StatusBadRequest
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: fmt.Sprintf("Invalid instance, %v", err.Error()),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+
+		identity, _ := common.IdentityFromRequest(r)
+		instanceUpdated, err := instances.Update(name, instance, dynamicClient, instances.InstanceUpdateOptions{
+			Admin:    identity.Admin,
+			Username: identity.Username,
+			Groups:   identity.Groups,
+		})
+		var invalidErr instances.InstanceUpdateInvalidError
+		if errors.As(err, &invalidErr) {
+			responseCode = http.StatusUnprocessableEntity
+		}
+		var quotaErr instances.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			responseCode = http.StatusForbidden
+		}
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Updated instance",
+			},
+			Spec: instanceUpdated,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// PostKubernetesExtend ...
+// handler for extending the lifetime of a Kubernetes instance, by the hours given or the default lifetime
+func PostKubernetesExtend(dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
+
+		hours := 0
+		if hoursFormValue := r.FormValue("hours"); hoursFormValue != "" {
+			var err error
+			hours, err = strconv.Atoi(hoursFormValue)
+			if err != nil || hours < 1 {
+				responseCode = http.StatusBadRequest
+				JSONresp := types.JSONMessageResponse{
+					Metadata: types.JSONResponseMetadata{
+						Response: fmt.Sprintf("Invalid hours '%v'", hoursFormValue),
+					},
+					Spec:   instances.InstanceSpec{},
+					Status: instances.InstanceStatus{},
+				}
+				common.JSONResponse(r, w, responseCode, JSONresp)
+				return
+			}
+		}
+
+		identity, _ := common.IdentityFromRequest(r)
+		instanceUpdated, err := instances.Extend(name, time.Duration(hours)*time.Hour, identity.Admin, dynamicClient)
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: fmt.Sprintf("Extended instance until %v", instanceUpdated.ExpiresAt.Format(time.RFC3339)),
+			},
+			Spec: instanceUpdated,
+			Status: instances.InstanceStatus{
+				ExpiresIn: instances.InstanceRemainingLifetime(instanceUpdated),
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// PostKubernetesHibernate ...
+// handler for hibernating a Kubernetes instance, releasing it's machines until it's resumed
+func PostKubernetesHibernate(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
+
+		instance, err := instances.KubernetesHibernate(name, clientset, dynamicClient)
+		var invalidErr instances.InstanceUpdateInvalidError
+		if errors.As(err, &invalidErr) {
+			responseCode = http.StatusUnprocessableEntity
+		}
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Hibernated instance",
+			},
+			Spec: instance,
+			Status: instances.InstanceStatus{
+				Phase: instances.InstanceStatusPhaseHibernated,
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// PostKubernetesResume ...
+// handler for resuming a hibernated Kubernetes instance, reprovisioning it from it's stored spec
+func PostKubernetesResume(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
+
+		instance, err := instances.KubernetesResume(name, clientset, dynamicClient)
+		var invalidErr instances.InstanceUpdateInvalidError
+		if errors.As(err, &invalidErr) {
+			responseCode = http.StatusUnprocessableEntity
+		}
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusAccepted
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Resuming instance",
+			},
+			Spec: instance,
+			Status: instances.InstanceStatus{
+				Phase: instances.InstanceStatusPhasePending,
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// PostKubernetesUpgrade ...
+// handler for upgrading the Kubernetes version of a Kubernetes instance, one minor version at a time
+func PostKubernetesUpgrade(dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
+
+		version := r.FormValue("version")
+		if version == "" {
+			responseCode = http.StatusBadRequest
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "A version to upgrade to is required",
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+
+		identity, _ := common.IdentityFromRequest(r)
+		admin := identity.Admin
+		instance, err := instances.KubernetesUpgrade(name, version, admin, identity.Groups, dynamicClient)
+		var invalidErr instances.InstanceUpdateInvalidError
+		if errors.As(err, &invalidErr) {
+			responseCode = http.StatusUnprocessableEntity
+		}
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusAccepted
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Upgrading instance",
+			},
+			Spec: instance,
+			Status: instances.InstanceStatus{
+				Phase: instances.InstanceStatusPhaseUpgrading,
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// GetKubernetesNodes ...
+// handler for the worker nodes of a Kubernetes instance
+func GetKubernetesNodes(dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionRead) != true {
+			return
+		}
+
+		nodes, err := instances.KubernetesNodesStatus(name, dynamicClient)
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Fetched nodes",
+			},
+			Status: nodes,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// GetInstanceEnv ...
+// handler for revealing the secret env values of an instance of a type to it's owner
+func GetInstanceEnv(instanceType instances.InstanceType, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instanceType, instances.InstanceActionReveal) != true {
+			return
+		}
+
+		env, err := instances.RevealEnv(name, dynamicClient)
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Fetched env",
+			},
+			Spec: env,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// UpdateKubernetesNodes ...
+// handler for scaling the worker nodes of a Kubernetes instance
+func UpdateKubernetesNodes(dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
+
+		countFormValue := r.FormValue("count")
+		count, err := strconv.Atoi(countFormValue)
+		if err != nil {
+			responseCode = http.StatusBadRequest
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: fmt.Sprintf("Invalid count '%v'", countFormValue),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+
+		identity, _ := common.IdentityFromRequest(r)
+		instance, err := instances.KubernetesScaleNodes(name, r.FormValue("pool"), count, dynamicClient, instances.InstanceUpdateOptions{
+			Admin:    identity.Admin,
+			Username: identity.Username,
+			Groups:   identity.Groups,
+		})
+		var invalidErr instances.InstanceUpdateInvalidError
+		if errors.As(err, &invalidErr) {
+			responseCode = http.StatusUnprocessableEntity
+		}
+		var quotaErr instances.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			responseCode = http.StatusForbidden
+		}
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		nodes, err := instances.KubernetesNodesStatus(name, dynamicClient)
+		if err != nil {
+			log.Printf("%#v\n", err)
+		}
+		responseCode = http.StatusAccepted
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: fmt.Sprintf("Scaling instance to %v worker nodes", instance.KubernetesNodeCount),
+			},
+			Spec:   instance,
+			Status: nodes,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// PostKubernetesHomeBackup ...
+// handler for backing up the home directory of a Kubernetes instance once it's due, or now when forced
+func PostKubernetesHomeBackup(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
+
+		var backup *instances.HomeBackup
+		var err error
+		if r.FormValue("force") == "true" {
+			var created instances.HomeBackup
+			created, err = instances.KubernetesBackupHome(name, clientset, dynamicClient)
+			backup = &created
+		} else {
+			backup, err = instances.KubernetesBackupHomeIfDue(name, clientset, dynamicClient)
+		}
+		var invalidErr instances.InstanceUpdateInvalidError
+		if errors.As(err, &invalidErr) {
+			responseCode = http.StatusUnprocessableEntity
+		}
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: fmt.Sprintf("Failed to back up home directory: %v", err.Error()),
+				},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "No home directory backup due",
+			},
+		}
+		if backup != nil {
+			JSONresp.Metadata.Response = "Backed up home directory"
+			JSONresp.Spec = backup
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// PostKubernetesHomeManage ...
+// handler for restoring the home directory of a resumed Kubernetes instance
+func PostKubernetesHomeManage(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Failed to restore home directory"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
+
+		restored, err := instances.KubernetesRestoreHome(name, clientset, dynamicClient)
+		if err != nil {
+			response = fmt.Sprintf("%v: %v", response, err.Error())
+		} else if restored == true {
+			response = "Restored home directory"
+			responseCode = http.StatusOK
+		} else {
+			response = "No home directory to restore"
+			responseCode = http.StatusOK
+		}
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// PostKubernetesSetupManage ...
+// deliver the setup Secret of a Kubernetes instance into it's cluster, once it's API server is live
+func PostKubernetesSetupManage(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Failed to deliver setup Secret"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
+
+		delivered, err := instances.KubernetesDeliverSetupSecret(name, clientset, dynamicClient)
+		synced := false
+		if err == nil && delivered == false {
+			synced, err = instances.KubernetesSyncEnvironmentSetup(name, clientset, dynamicClient)
+		}
+		if err != nil {
+			response = fmt.Sprintf("%v: %v", response, err.Error())
+		} else if delivered == true {
+			response = "Delivered setup Secret"
+			responseCode = http.StatusOK
+		} else if synced == true {
+			response = "Synced setup to Environment"
+			responseCode = http.StatusOK
+		} else {
+			response = "No setup Secret to deliver"
+			responseCode = http.StatusOK
+		}
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// DeleteInstanceKubernetes ...
+// handler for deleting a Kubernetes instance type
+func DeleteInstanceKubernetes(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionDelete) != true {
+			return
+		}
+
+		instance, err := instances.KubernetesGet(name, dynamicClient, clientset)
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		if instance.Spec.Name == "" {
+			responseCode = http.StatusNotFound
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Resource not found",
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+
+		err = instances.KubernetesDelete(name, dynamicClient, clientset)
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Deleting instance",
+			},
+			Status: instances.InstanceStatus{
+				Phase: instances.InstanceStatusPhaseDeleting,
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// DeleteInstance ...
+// handler for deleting an instance
+func DeleteInstance(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		var instance instances.InstanceSpec
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &instance)
+
+		if authorizeInstance(w, r, dynamicClient, instance.Name, instance.Type, instances.InstanceActionDelete) != true {
+			return
+		}
+
+		err := instances.Delete(instance, dynamicClient, clientset)
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Deleting instance",
+			},
+			Status: instances.InstanceStatus{
+				Phase: instances.InstanceStatusPhaseDeleting,
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// GetKubernetesKubeconfig ...
+// handler for getting an instance's KubeConfig as YAML
+func GetKubernetesKubeconfig(kubernetesClientset *kubernetes.Clientset, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Fetched Kubeconfig for instance"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionRead) != true {
+			return
+		}
+
+		kubeconfig, err := instances.KubernetesGetKubeconfigYAML(name, kubernetesClientset)
+		if kubeconfig == "" && err == nil {
+			responseCode = http.StatusNotFound
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Resource not found",
+				},
+				Spec: clientcmdapi.Config{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec: kubeconfig,
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+			Spec: kubeconfig,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// GetKubernetesTmateSSHSession ...
+// handler for getting an instance's tmate SSH session
+func GetKubernetesTmateSSHSession(clientset *kubernetes.Clientset, restConfig *rest.Config, dynamicClientSet dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Fetched Tmate session for instance"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClientSet, name, instances.InstanceTypeKubernetes, instances.InstanceActionAttach) != true {
+			return
+		}
+
+		instance, err := instances.KubernetesGet(name, dynamicClientSet, clientset)
+		if instance.Spec.Name == "" && err == nil {
+			responseCode = http.StatusNotFound
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Resource not found",
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+
+		instance.Spec.Setup.UserLowercase = strings.ToLower(instance.Spec.Setup.User)
+		session, err := instances.KubernetesGetTmateSSHSession(clientset, name, instance.Spec.Setup.UserLowercase)
+		notFound := err != nil && (strings.Contains(err.Error(), "Failed to get Kubernetes cluster Kubeconfig") ||
+			strings.Contains(err.Error(), "not found"))
+		if firstSnippit := strings.Split(session, " "); firstSnippit[0] != "ssh" && err == nil || notFound {
+			responseCode = http.StatusNotFound
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Resource not found",
+				},
+				Spec: "",
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec: "",
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+			Spec: session,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// GetKubernetesTmateWebSession ...
+// handler for getting an instance's tmate web session
+func GetKubernetesTmateWebSession(clientset *kubernetes.Clientset, restConfig *rest.Config, dynamicClientSet dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Fetched Tmate session for instance"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClientSet, name, instances.InstanceTypeKubernetes, instances.InstanceActionAttach) != true {
+			return
+		}
+
+		instance, err := instances.KubernetesGet(name, dynamicClientSet, clientset)
+		if instance.Spec.Name == "" && err == nil {
+			responseCode = http.StatusNotFound
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Resource not found",
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+
+		instance.Spec.Setup.UserLowercase = strings.ToLower(instance.Spec.Setup.User)
+		session, err := instances.KubernetesGetTmateWebSession(clientset, name, instance.Spec.Setup.UserLowercase)
+		notFound := err != nil && (strings.Contains(err.Error(), "Failed to get Kubernetes cluster Kubeconfig") ||
+			strings.Contains(err.Error(), "not found"))
+		if firstSnippit := strings.Split(session, ":"); firstSnippit[0] != "https" && err == nil || notFound {
+			responseCode = http.StatusNotFound
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Resource not found",
+				},
+				Spec: "",
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec: "",
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+			Spec: session,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// GetKubernetesIngresses ...
+// handler for getting an instance's ingresse mappings
+func GetKubernetesIngresses(kubernetesClientset *kubernetes.Clientset, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Fetched Kubeconfig for instance"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionRead) != true {
+			return
+		}
+
+		ingresses, err := instances.KubernetesGetInstanceIngresses(kubernetesClientset, name)
+		if len(ingresses) == 0 && err == nil {
+			responseCode = http.StatusNotFound
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Resource not found",
+				},
+				Spec: []instances.Ingress{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec: []instances.Ingress{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+			List: ingresses,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// GetKubernetesManifests ...
+// handler for exporting the management cluster resources of an instance, as YAML or JSON
+func GetKubernetesManifests(dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Fetched manifests for instance"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionRead) != true {
+			return
+		}
+
+		manifests, err := instances.KubernetesGetManifests(name, dynamicClient)
+		if err != nil {
+			log.Println(err)
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			responseCode = http.StatusOK
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: response,
+				},
+				Spec: manifests,
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		manifestsYAML, err := manifests.YAML()
+		if err != nil {
+			log.Println(err)
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(manifestsYAML))
+	}
+}
+
+// PostKubernetesDNSManage ...
+// handler for initiating DNS management for an instance
+func PostKubernetesDNSManage(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Failed to initiate DNS management"
 		responseCode := http.StatusInternalServerError
 
 		vars := mux.Vars(r)
 		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
 
 		instance, err := instances.KubernetesGet(name, dynamicClient, clientset)
 		if instance.Spec.Name == "" && err == nil {
@@ -556,6 +1743,9 @@ func PostKubernetesCertManage(clientset *kubernetes.Clientset, dynamicClient dyn
 
 		vars := mux.Vars(r)
 		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
 
 		instance, err := instances.KubernetesGet(name, dynamicClient, clientset)
 		if instance.Spec.Name == "" && err == nil {
@@ -608,6 +1798,9 @@ func PostKubernetesUpdateInstanceNodeProviderID(clientset *kubernetes.Clientset,
 
 		vars := mux.Vars(r)
 		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypeKubernetes, instances.InstanceActionManage) != true {
+			return
+		}
 
 		instance, err := instances.KubernetesGet(name, dynamicClient, clientset)
 		if instance.Spec.Name == "" && err == nil {
@@ -650,6 +1843,300 @@ func PostKubernetesUpdateInstanceNodeProviderID(clientset *kubernetes.Clientset,
 	}
 }
 
+// ListInstancesPlain ...
+// handler for listing Plain instances
+func ListInstancesPlain(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Listing all Plain instances"
+		responseCode := http.StatusInternalServerError
+
+		instanceFilterUsername := r.FormValue("username")
+		options := instances.InstanceListOptions{
+			Filter: instances.InstanceFilter{
+				Username: instanceFilterUsername,
+			},
+		}
+
+		availableInstances, err := instances.PlainList(dynamicClient, clientset, options)
+		availableInstances = filterInstancesForRequest(r, availableInstances)
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				List: []instances.Instance{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		if len(availableInstances) == 0 {
+			response = "No Plain instances found"
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+			List: availableInstances,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// GetInstancePlain ...
+// handler for getting a Plain instance type
+func GetInstancePlain(dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypePlain, instances.InstanceActionRead) != true {
+			return
+		}
+
+		instance, err := instances.PlainGet(name, dynamicClient, clientset)
+		if instance.Spec.Name == "" && err == nil {
+			responseCode = http.StatusNotFound
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Resource not found",
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Fetched Plain instance",
+			},
+			Spec:   instance.Spec,
+			Status: instance.Status,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// DeleteInstancePlain ...
+// handler for deleting a Plain instance type
+func DeleteInstancePlain(dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypePlain, instances.InstanceActionDelete) != true {
+			return
+		}
+
+		err := instances.PlainDelete(name, dynamicClient)
+		if err != nil {
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: err.Error(),
+				},
+				Spec:   instances.InstanceSpec{},
+				Status: instances.InstanceStatus{},
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: "Deleting instance",
+			},
+			Status: instances.InstanceStatus{
+				Phase: instances.InstanceStatusPhaseDeleting,
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// GetPlainTmateSSHSession ...
+// handler for getting a Plain instance's tmate SSH session
+func GetPlainTmateSSHSession(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Fetched Tmate session for instance"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypePlain, instances.InstanceActionAttach) != true {
+			return
+		}
+
+		session, err := instances.PlainGetTmateSSHSession(dynamicClient, clientset, name)
+		if firstSnippit := strings.Split(session, " "); firstSnippit[0] != "ssh" || err != nil {
+			if err != nil {
+				log.Println(err)
+			}
+			responseCode = http.StatusNotFound
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Resource not found",
+				},
+				Spec: "",
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+			Spec: session,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// GetPlainTmateWebSession ...
+// handler for getting a Plain instance's tmate web session
+func GetPlainTmateWebSession(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Fetched Tmate session for instance"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypePlain, instances.InstanceActionAttach) != true {
+			return
+		}
+
+		session, err := instances.PlainGetTmateWebSession(dynamicClient, clientset, name)
+		if firstSnippit := strings.Split(session, ":"); firstSnippit[0] != "https" || err != nil {
+			if err != nil {
+				log.Println(err)
+			}
+			responseCode = http.StatusNotFound
+			JSONresp := types.JSONMessageResponse{
+				Metadata: types.JSONResponseMetadata{
+					Response: "Resource not found",
+				},
+				Spec: "",
+			}
+			common.JSONResponse(r, w, responseCode, JSONresp)
+			return
+		}
+		responseCode = http.StatusOK
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+			Spec: session,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// PostPlainDNSManage ...
+// handler for initiating DNS management for a Plain instance
+func PostPlainDNSManage(dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Failed to initiate DNS management"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypePlain, instances.InstanceActionManage) != true {
+			return
+		}
+
+		err := instances.PlainAddMachineIPToDNS(dynamicClient, name)
+		if err != nil {
+			response = fmt.Sprintf("%v: %v", response, err.Error())
+		} else {
+			response = "DNS records synced"
+			responseCode = http.StatusOK
+		}
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// PostPlainSetupManage ...
+// deliver the setup Secret of a Plain instance to it's machine, once it's session server is up
+func PostPlainSetupManage(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Failed to deliver setup Secret"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instances.InstanceTypePlain, instances.InstanceActionManage) != true {
+			return
+		}
+
+		delivered, err := instances.PlainDeliverSetupSecret(name, clientset, dynamicClient)
+		if err != nil {
+			response = fmt.Sprintf("%v: %v", response, err.Error())
+		} else if delivered == true {
+			response = "Delivered setup Secret"
+			responseCode = http.StatusOK
+		} else {
+			response = "No setup Secret to deliver"
+			responseCode = http.StatusOK
+		}
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
+// PostInstanceStatusManage ...
+// record the observed status of an instance on it's PairInstance
+func PostInstanceStatusManage(instanceType instances.InstanceType, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := "Failed to sync instance status"
+		responseCode := http.StatusInternalServerError
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+		if authorizeInstance(w, r, dynamicClient, name, instanceType, instances.InstanceActionManage) != true {
+			return
+		}
+
+		status, err := instances.SyncPairInstanceStatus(name, instanceType, dynamicClient, clientset)
+		if err != nil {
+			response = fmt.Sprintf("%v: %v", response, err.Error())
+		} else {
+			response = "Instance status synced"
+			responseCode = http.StatusOK
+		}
+		JSONresp := types.JSONMessageResponse{
+			Metadata: types.JSONResponseMetadata{
+				Response: response,
+			},
+			Spec: status,
+		}
+		common.JSONResponse(r, w, responseCode, JSONresp)
+	}
+}
+
 // GetRoot ...
 // get root of API
 func GetRoot(w http.ResponseWriter, r *http.Request) {
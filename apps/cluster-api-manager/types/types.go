@@ -64,6 +64,8 @@ type SetupSpec struct {
 	KubernetesVersion     string              `json:"kubernetesVersion,omitempty"`
 	EnvironmentRepository string              `json:"environmentRepository"`
 	EnvironmentVersion    string              `json:"environmentVersion"`
+	// RestoreBackup is a backup of the user to restore the home directory of a new Kubernetes instance from
+	RestoreBackup string `json:"restoreBackup,omitempty"`
 
 	GuestsNamesFlat string `json:"-"`
 	UserLowercase   string `json:"-"`
@@ -75,3 +77,19 @@ type SetupSpec struct {
 type MetaResponse struct {
 	Metadata JSONResponseMetadata `json:"metadata"`
 }
+
+// identity authentication methods
+var (
+	IdentityMethodToken = "token"
+	IdentityMethodOIDC  = "oidc"
+)
+
+// Identity ...
+// the authenticated caller of a request
+type Identity struct {
+	Username     string   `json:"username"`
+	Groups       []string `json:"groups,omitempty"`
+	Admin        bool     `json:"admin"`
+	Method       string   `json:"method"`
+	Impersonator string   `json:"impersonator,omitempty"`
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sharingio/pair/apps/cluster-api-manager/common"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	clusterAPIv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// watched resources
+var (
+	clusterGroupVersionResource      = clusterAPIv1beta1.GroupVersion.WithResource("clusters")
+	machineGroupVersionResource      = clusterAPIv1beta1.GroupVersion.WithResource("machines")
+	pairInstanceGroupVersionResource = schema.GroupVersionResource{Version: "v1alpha1", Group: "pair.sharing.io", Resource: "pairinstances"}
+)
+
+// infrastructureMachineGroupVersionResource returns the machines of an infrastructure provider, such as packetmachines
+func infrastructureMachineGroupVersionResource(provider string) schema.GroupVersionResource {
+	return schema.GroupVersionResource{Version: common.ClusterAPIVersion, Group: "infrastructure.cluster.x-k8s.io", Resource: provider + "machines"}
+}
+
+// runController watches the resources of instances, reconciling each instance which changes until ctx is cancelled
+func (r *Reconciler) runController(ctx context.Context) {
+	defer r.queue.ShutDown()
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(r.dynamicClientset, time.Duration(r.sleepTime)*time.Second, r.targetNamespace, nil)
+	clusterInformer := factory.ForResource(common.ClusterAPIServedResource(clusterGroupVersionResource))
+	clusterInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    r.enqueueCluster,
+		UpdateFunc: func(_, obj interface{}) { r.enqueueCluster(obj) },
+	})
+	for _, groupVersionResource := range []schema.GroupVersionResource{machineGroupVersionResource, infrastructureMachineGroupVersionResource(r.infrastructureProvider)} {
+		factory.ForResource(common.ClusterAPIServedResource(groupVersionResource)).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    r.enqueueClusterOf,
+			UpdateFunc: func(_, obj interface{}) { r.enqueueClusterOf(obj) },
+		})
+	}
+	r.clusterLister = clusterInformer.Lister()
+	// instances being resumed only have their PairInstance, until their Cluster is replaced
+	pairInstanceInformer := factory.ForResource(pairInstanceGroupVersionResource)
+	pairInstanceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    r.enqueueCluster,
+		UpdateFunc: func(_, obj interface{}) { r.enqueueCluster(obj) },
+	})
+	r.pairInstanceLister = pairInstanceInformer.Lister()
+
+	factory.Start(ctx.Done())
+	for groupVersionResource, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if synced != true {
+			log.Printf("Failed to sync cache for %v\n", groupVersionResource.Resource)
+			return
+		}
+	}
+
+	log.Printf("Starting %v workers\n", r.workers)
+	done := make(chan struct{})
+	for i := 0; i < r.workers; i++ {
+		go func() {
+			for r.processNextItem() {
+			}
+			done <- struct{}{}
+		}()
+	}
+	<-ctx.Done()
+	log.Println("Stopping workers")
+	r.queue.ShutDown()
+	for i := 0; i < r.workers; i++ {
+		<-done
+	}
+}
+
+// enqueueCluster queues a Cluster or PairInstance to be reconciled, if it's an instance
+func (r *Reconciler) enqueueCluster(obj interface{}) {
+	cluster, ok := obj.(*unstructured.Unstructured)
+	if ok != true || cluster.GetLabels()["io.sharing.pair"] != "instance" {
+		return
+	}
+	r.queue.Add(cluster.GetName())
+}
+
+// enqueueClusterOf queues the Cluster which a Machine or infrastructure machine belongs to
+func (r *Reconciler) enqueueClusterOf(obj interface{}) {
+	item, ok := obj.(*unstructured.Unstructured)
+	if ok != true {
+		return
+	}
+	clusterName := item.GetLabels()["cluster.x-k8s.io/cluster-name"]
+	if clusterName == "" {
+		return
+	}
+	r.queue.Add(clusterName)
+}
+
+// processNextItem reconciles the next instance in the queue, returning false when the queue is shut down
+func (r *Reconciler) processNextItem() bool {
+	key, shutdown := r.queue.Get()
+	if shutdown == true {
+		return false
+	}
+	defer r.queue.Done(key)
+
+	name := key.(string)
+	err := r.reconcile(name)
+	if err != nil {
+		log.Printf("Failed to reconcile '%v' (attempt %v), retrying; %v\n", name, r.queue.NumRequeues(key)+1, err)
+		r.queue.AddRateLimited(key)
+		return true
+	}
+	r.queue.Forget(key)
+	return true
+}
+
+// reconcile calls each cluster-api-manager endpoint for an instance, given it's name
+func (r *Reconciler) reconcile(name string) (err error) {
+	obj, err := r.clusterLister.ByNamespace(r.targetNamespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return r.resumeInstance(name)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to get Cluster '%v', %v", name, err)
+	}
+	cluster, ok := obj.(*unstructured.Unstructured)
+	if ok != true || cluster.GetLabels()["io.sharing.pair"] != "instance" || cluster.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	// NOTE the spec of an instance is only in it's PairInstance, which is reconciled once it's created
+	obj, err = r.pairInstanceLister.ByNamespace(r.targetNamespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		log.Printf("Instance '%v' has no PairInstance yet, not reconciling\n", name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to get PairInstance '%v', %v", name, err)
+	}
+	pairInstance, ok := obj.(*unstructured.Unstructured)
+	if ok != true {
+		return nil
+	}
+
+	log.Printf("Reconciling instance '%v'\n", name)
+	instanceType, _, _ := unstructured.NestedString(pairInstance.Object, "spec", "type")
+	if instanceType == "" {
+		instanceType = "Kubernetes"
+	}
+	expired, err := r.checkExpiry(pairInstance)
+	if err != nil {
+		log.Printf("Error with expiry '%v'\n", err)
+	} else if expired == true {
+		return r.deleteExpiredInstance(name, instanceType)
+	}
+	if cluster.GetAnnotations()["io.sharing.pair-hibernatedAt"] != "" {
+		log.Printf("Instance '%v' is hibernated, not reconciling\n", name)
+		return nil
+	}
+	failed := []string{}
+	for _, endpoint := range endpointsForReconciliation[instanceType] {
+		url := fmt.Sprintf("%s/api/instance/%s/%s/%s", r.clusterAPIManagerHost, strings.ToLower(instanceType), name, endpoint)
+		resp, err := httpGetJSON(url, r.clusterAPIManagerToken)
+		if err != nil {
+			log.Printf("Error from cluster-api-manager endpoint '%s', %v\n", url, err)
+			failed = append(failed, endpoint)
+			continue
+		}
+		log.Printf("Response from cluster-api-manager endpoint '%s': %s\n", url, resp)
+	}
+	err = r.removeExpiredCertificate(name)
+	if err != nil {
+		log.Printf("Error with certificates '%v'\n", err)
+		failed = append(failed, "certificates")
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to reconcile %v", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// checkExpiry returns if an instance has expired from it's PairInstance, warning when it's about to and queueing it for when it does
+func (r *Reconciler) checkExpiry(pairInstance *unstructured.Unstructured) (expired bool, err error) {
+	expiresAtSpec, _, _ := unstructured.NestedString(pairInstance.Object, "spec", "expiresAt")
+	if expiresAtSpec == "" {
+		return false, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, expiresAtSpec)
+	if err != nil {
+		return false, fmt.Errorf("Failed to parse expiry of '%v', %v", pairInstance.GetName(), err)
+	}
+	remaining := time.Until(expiresAt)
+	if remaining <= 0 {
+		return true, nil
+	}
+	if remaining > r.expiryWarning {
+		return false, nil
+	}
+	// warn once for each expiry, so extending an instance warns again
+	if _, warned := r.expiryWarned.LoadOrStore(pairInstance.GetName()+"/"+expiresAtSpec, true); warned != true {
+		user, _, _ := unstructured.NestedString(pairInstance.Object, "spec", "setup", "user")
+		log.Printf("Warning: instance '%v' of '%v' expires in %v, at %v\n", pairInstance.GetName(), user, remaining.Round(time.Minute), expiresAtSpec)
+	}
+	r.queue.AddAfter(pairInstance.GetName(), remaining)
+	return false, nil
+}
+
+// deleteExpiredInstance deletes an instance through cluster-api-manager, once it has expired
+func (r *Reconciler) deleteExpiredInstance(name string, instanceType string) (err error) {
+	log.Printf("Instance '%v' has expired, deleting\n", name)
+	url := fmt.Sprintf("%s/api/instance/%s/%s", r.clusterAPIManagerHost, strings.ToLower(instanceType), name)
+	resp, err := httpDeleteJSON(url, r.clusterAPIManagerToken)
+	if err != nil {
+		return fmt.Errorf("Failed to delete expired instance '%v', %v", name, err)
+	}
+	log.Printf("Response from cluster-api-manager endpoint '%s': %s\n", url, resp)
+	return nil
+}
+
+// resumeInstance reprovisions an instance through cluster-api-manager, once the Cluster of it's hibernated instance is deleted
+func (r *Reconciler) resumeInstance(name string) (err error) {
+	obj, err := r.pairInstanceLister.ByNamespace(r.targetNamespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to get PairInstance '%v', %v", name, err)
+	}
+	pairInstance, ok := obj.(*unstructured.Unstructured)
+	if ok != true || pairInstance.GetAnnotations()["io.sharing.pair-resume"] == "" {
+		return nil
+	}
+	instanceType, _, _ := unstructured.NestedString(pairInstance.Object, "spec", "type")
+	if instanceType == "" {
+		instanceType = "Kubernetes"
+	}
+	log.Printf("Resuming instance '%v'\n", name)
+	url := fmt.Sprintf("%s/api/instance/%s/%s/resume", r.clusterAPIManagerHost, strings.ToLower(instanceType), name)
+	resp, err := httpPostJSON(url, r.clusterAPIManagerToken)
+	if err != nil {
+		return fmt.Errorf("Failed to resume instance '%v', %v", name, err)
+	}
+	log.Printf("Response from cluster-api-manager endpoint '%s': %s\n", url, resp)
+	return nil
+}
+
+// newRateLimitingQueue returns a queue which retries each instance with exponential backoff
+func newRateLimitingQueue(baseDelay time.Duration, maxDelay time.Duration) workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay), "instances")
+}
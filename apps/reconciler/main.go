@@ -7,9 +7,14 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"github.com/sharingio/pair/apps/cluster-api-manager/common"
 	camk8s "github.com/sharingio/pair/apps/cluster-api-manager/kubernetes"
@@ -18,12 +23,13 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	clusterAPIv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/util/workqueue"
 )
 
 // overwritable variables
@@ -32,24 +38,49 @@ var (
 	AppBuildHash               = "???"
 	AppBuildDate               = "???"
 	AppBuildMode               = "development"
-	endpointsForReconciliation = []string{
-		"certmanage",
-		"dnsmanage",
-		"syncProviderID",
+	endpointsForReconciliation = map[string][]string{
+		"Kubernetes": {
+			"setupmanage",
+			"certmanage",
+			"dnsmanage",
+			"syncProviderID",
+			"homemanage",
+			"homebackup",
+			"statusmanage",
+		},
+		"Plain": {
+			"setupmanage",
+			"dnsmanage",
+			"statusmanage",
+		},
 	}
 	defaultSleepTime                 = 60
 	defaultCertDaysToPreExpireString = time.Duration(5)
+	defaultWorkers                   = 4
+	defaultRetryBaseDelay            = 1
+	defaultRetryMaxDelay             = 300
+	defaultExpiryWarningHours        = 24
 )
 
 // Reconciler fields needed to initialise
 type Reconciler struct {
-	clientset             *kubernetes.Clientset
-	dynamicClientset      dynamic.Interface
-	restConfig            *rest.Config
-	targetNamespace       string
-	clusterAPIManagerHost string
-	sleepTime             int
-	certDaysToPreExpire   time.Duration
+	clientset              *kubernetes.Clientset
+	dynamicClientset       dynamic.Interface
+	restConfig             *rest.Config
+	targetNamespace        string
+	clusterAPIManagerHost  string
+	clusterAPIManagerToken string
+	sleepTime              int
+	certDaysToPreExpire    time.Duration
+	workers                int
+	leaseLockName          string
+	identity               string
+	infrastructureProvider string
+	expiryWarning          time.Duration
+	expiryWarned           *sync.Map
+	queue                  workqueue.RateLimitingInterface
+	clusterLister          cache.GenericLister
+	pairInstanceLister     cache.GenericLister
 }
 
 // NewReconciler returns a reconciler struct
@@ -78,6 +109,7 @@ func NewReconciler() (r Reconciler, err error) {
 
 	targetNamespace := common.GetTargetNamespace()
 	clusterAPIManagerHost := common.GetEnvOrDefault("APP_CLUSTER_API_MANAGER_HOST", "http://sharingio-pair-clusterapimanager:8080")
+	clusterAPIManagerToken := common.GetEnvOrDefault("APP_CLUSTER_API_MANAGER_TOKEN", "")
 	sleepTimeString := common.GetEnvOrDefault("APP_SLEEP_TIME", "60")
 	sleepTime, _ := strconv.Atoi(sleepTimeString)
 	if sleepTime == 0 {
@@ -88,49 +120,46 @@ func NewReconciler() (r Reconciler, err error) {
 	if certDaysToPreExpire == 0 {
 		certDaysToPreExpire = int(defaultCertDaysToPreExpireString)
 	}
+	workers, _ := strconv.Atoi(common.GetEnvOrDefault("APP_WORKERS", strconv.Itoa(defaultWorkers)))
+	if workers < 1 {
+		workers = defaultWorkers
+	}
+	retryBaseDelay, _ := strconv.Atoi(common.GetEnvOrDefault("APP_RETRY_BASE_DELAY", strconv.Itoa(defaultRetryBaseDelay)))
+	if retryBaseDelay < 1 {
+		retryBaseDelay = defaultRetryBaseDelay
+	}
+	retryMaxDelay, _ := strconv.Atoi(common.GetEnvOrDefault("APP_RETRY_MAX_DELAY", strconv.Itoa(defaultRetryMaxDelay)))
+	if retryMaxDelay < retryBaseDelay {
+		retryMaxDelay = defaultRetryMaxDelay
+	}
+	leaseLockName := common.GetEnvOrDefault("APP_LEASE_LOCK_NAME", "sharingio-pair-reconciler")
+	hostname, _ := os.Hostname()
+	identity := common.GetEnvOrDefault("APP_LEADER_IDENTITY", hostname+"_"+uuid.New().String())
+	infrastructureProvider := common.GetEnvOrDefault("APP_INFRASTRUCTURE_PROVIDER", "packet")
+	expiryWarningHours, _ := strconv.Atoi(common.GetEnvOrDefault("APP_EXPIRY_WARNING_HOURS", strconv.Itoa(defaultExpiryWarningHours)))
+	if expiryWarningHours < 1 {
+		expiryWarningHours = defaultExpiryWarningHours
+	}
 
 	return Reconciler{
-		clientset:             clientset,
-		dynamicClientset:      dynamicClientset,
-		restConfig:            restConfig,
-		targetNamespace:       targetNamespace,
-		clusterAPIManagerHost: clusterAPIManagerHost,
-		sleepTime:             sleepTime,
-		certDaysToPreExpire:   time.Duration(certDaysToPreExpire),
+		clientset:              clientset,
+		dynamicClientset:       dynamicClientset,
+		restConfig:             restConfig,
+		targetNamespace:        targetNamespace,
+		clusterAPIManagerHost:  clusterAPIManagerHost,
+		clusterAPIManagerToken: clusterAPIManagerToken,
+		sleepTime:              sleepTime,
+		certDaysToPreExpire:    time.Duration(certDaysToPreExpire),
+		workers:                workers,
+		leaseLockName:          leaseLockName,
+		identity:               identity,
+		infrastructureProvider: infrastructureProvider,
+		expiryWarning:          time.Duration(expiryWarningHours) * time.Hour,
+		expiryWarned:           &sync.Map{},
+		queue:                  newRateLimitingQueue(time.Duration(retryBaseDelay)*time.Second, time.Duration(retryMaxDelay)*time.Second),
 	}, err
 }
 
-// getClustersList returns a list of clusters using the backend
-func (r *Reconciler) getClustersList() (clusters []clusterAPIv1alpha3.Cluster, err error) {
-	groupVersion := clusterAPIv1alpha3.GroupVersion
-	groupVersionResource := schema.GroupVersionResource{
-		Version:  groupVersion.Version,
-		Group:    groupVersion.Group,
-		Resource: "clusters",
-	}
-	items, err := r.dynamicClientset.
-		Resource(groupVersionResource).
-		Namespace(r.targetNamespace).
-		List(context.TODO(), metav1.ListOptions{})
-	if err != nil && apierrors.IsNotFound(err) != true {
-		log.Printf("%#v\n", err)
-		return clusters, fmt.Errorf("Failed to list Cluster, %#v", err)
-	}
-	for _, item := range items.Items {
-		var c clusterAPIv1alpha3.Cluster
-		err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &c)
-		if err != nil {
-			return []clusterAPIv1alpha3.Cluster{}, fmt.Errorf("Failed to restructure %T: error: %v", c, err)
-		}
-		if c.ObjectMeta.Labels["io.sharing.pair"] != "instance" {
-			log.Printf("Not using object %s/%T/%s - not an instance managed by sharingio/pair\n", r.targetNamespace, c, c.ObjectMeta.Name)
-			continue
-		}
-		clusters = append(clusters, c)
-	}
-	return clusters, err
-}
-
 // getCertForInstance returns an x509 cert, given an instance name
 func (r *Reconciler) getCertForInstance(name string) (certificate *x509.Certificate, exists bool, err error) {
 	templatedSecretName := fmt.Sprintf("%v-tls", name)
@@ -174,17 +203,35 @@ func (r *Reconciler) removeExpiredCertificate(name string) (err error) {
 	return nil
 }
 
-// httpGetJSON makes a HTTP get request, given a URL, returns as a strings
-func httpGetJSON(url string) (response string, err error) {
+// httpGetJSON makes a HTTP get request, given a URL and bearer token, returns as a strings
+func httpGetJSON(url string, token string) (response string, err error) {
+	return httpRequestJSON(http.MethodGet, url, token)
+}
+
+// httpPostJSON makes a HTTP post request, given a URL and bearer token, returns as a strings
+func httpPostJSON(url string, token string) (response string, err error) {
+	return httpRequestJSON(http.MethodPost, url, token)
+}
+
+// httpDeleteJSON makes a HTTP delete request, given a URL and bearer token, returns as a strings
+func httpDeleteJSON(url string, token string) (response string, err error) {
+	return httpRequestJSON(http.MethodDelete, url, token)
+}
+
+// httpRequestJSON makes a HTTP request of a method, given a URL and bearer token, returns as a strings
+func httpRequestJSON(method string, url string, token string) (response string, err error) {
 	if url[:1] == "/" {
 		url = url[1:]
 	}
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
 		return "", err
 	}
 	req.Header.Add("Accept", "application/json")
-	client := &http.Client{}
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -192,6 +239,9 @@ func httpGetJSON(url string) (response string, err error) {
 
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
+	if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		err = fmt.Errorf("Request failed with status %v", resp.StatusCode)
+	}
 	return string(body), err
 }
 
@@ -204,35 +254,54 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	err = common.DiscoverClusterAPIVersions(r.clientset.Discovery())
+	if err != nil {
+		panic(err)
+	}
 
-list:
-	for {
-		clusters, err := r.getClustersList()
-		if err != nil {
-			log.Printf("Failed to list cluster: %s\n", err)
-			continue list
-		}
-		log.Println("Listing clusters...")
-		for _, c := range clusters {
-			log.Println("Cluster: ", c.ObjectMeta.Name)
-			for _, endpoint := range endpointsForReconciliation {
-				url := fmt.Sprintf("%s/api/instance/kubernetes/%s/%s", r.clusterAPIManagerHost, c.ObjectMeta.Name, endpoint)
-				log.Printf("Trying cluster-api-manager endpoint '%s' (%s)\n", endpoint, url)
-				go func() {
-					resp, err := httpGetJSON(url)
-					if err != nil {
-						log.Printf("Error from cluster-api-manager endpoint '%s'\n", err)
-					}
-					log.Printf("Response from cluster-api-manager endpoint '%s'\n", endpoint, resp)
-				}()
-				err := r.removeExpiredCertificate(c.ObjectMeta.Name)
-				if err != nil {
-					log.Printf("Error with certificates '%v'\n", err)
-				}
-			}
-		}
+	// stop reconciling and give up the lease on termination
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		log.Println("Received termination, signaling shutdown")
+		cancel()
+	}()
 
-		log.Printf("Sleeping for %v seconds", r.sleepTime)
-		time.Sleep(time.Duration(r.sleepTime) * time.Second)
+	// only one replica reconciles at a time
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      r.leaseLockName,
+			Namespace: r.targetNamespace,
+		},
+		Client: r.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: r.identity,
+		},
 	}
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   60 * time.Second,
+		RenewDeadline:   15 * time.Second,
+		RetryPeriod:     5 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Printf("Started leading as '%v'\n", r.identity)
+				r.runController(ctx)
+			},
+			OnStoppedLeading: func() {
+				log.Printf("Leader lost: %v\n", r.identity)
+				os.Exit(0)
+			},
+			OnNewLeader: func(identity string) {
+				if identity == r.identity {
+					return
+				}
+				log.Printf("New leader elected: %v\n", identity)
+			},
+		},
+	})
 }